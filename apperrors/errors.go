@@ -0,0 +1,137 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Code is the machine readable identifier of an error, clients can rely on it not changing
+type Code string
+
+const (
+	CodeBadRequest       Code = "bad_request"
+	CodeValidation       Code = "validation_failed"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodeTooManyRequests  Code = "too_many_requests"
+	CodeInternal         Code = "internal_error"
+)
+
+// Error is a domain error that can be returned by models and controllers and knows how to be rendered
+type Error struct {
+	Code    Code
+	Message string
+	Details []FieldError
+	// The underlying cause, only logged and never sent to the client
+	Err error
+}
+
+// A single violation of a field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Allows errors.Is(err, apperrors.ErrNotFound) to match any error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.Message == ""
+}
+
+// Keeps the code and message but records the cause
+func (e *Error) Wrap(err error) *Error {
+	copy := *e
+	copy.Err = err
+	return &copy
+}
+
+func (e *Error) Status() int {
+	switch e.Code {
+	case CodeBadRequest:
+		return http.StatusBadRequest
+	case CodeValidation:
+		return http.StatusBadRequest
+	case CodeUnauthorized:
+		return http.StatusUnauthorized
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case CodeConflict:
+		return http.StatusConflict
+	case CodeTooManyRequests:
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Sentinels for errors.Is, they match any error with the same code
+var (
+	ErrBadRequest   = &Error{Code: CodeBadRequest}
+	ErrValidation   = &Error{Code: CodeValidation}
+	ErrUnauthorized = &Error{Code: CodeUnauthorized}
+	ErrForbidden    = &Error{Code: CodeForbidden}
+	ErrNotFound     = &Error{Code: CodeNotFound}
+	ErrConflict     = &Error{Code: CodeConflict}
+)
+
+func BadRequest(message string) *Error {
+	return &Error{Code: CodeBadRequest, Message: message}
+}
+
+func Validation(message string, details ...FieldError) *Error {
+	return &Error{Code: CodeValidation, Message: message, Details: details}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Code: CodeUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Code: CodeForbidden, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Code: CodeNotFound, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Message: message}
+}
+
+func TooManyRequests(message string) *Error {
+	return &Error{Code: CodeTooManyRequests, Message: message}
+}
+
+func Internal(err error) *Error {
+	return &Error{Code: CodeInternal, Message: "Internal server error", Err: err}
+}
+
+// Returns the domain error inside err, turning anything unknown into an internal error
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	return Internal(err)
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/preguntame/preguntame-backend/config"
+	"github.com/preguntame/preguntame-backend/email"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+var (
+	ErrInvalidAccountToken  = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	ErrEmailCooldown        = errors.New("an email of the same kind was sent recently")
+)
+
+/**
+ * Accounts sends the emails that prove the user owns their email address: the verification
+ * after registering and the password reset. The links carry single use tokens that expire.
+ */
+type Accounts struct {
+	cfg       config.AccountsConfig
+	users     models.UserStore
+	tokens    models.AccountTokenStore
+	passwords *Passwords
+	logins    *LoginGuard
+	auth      *Authenticator
+	mailer    email.Mailer
+}
+
+func NewAccounts(
+	cfg config.AccountsConfig,
+	users models.UserStore,
+	tokens models.AccountTokenStore,
+	passwords *Passwords,
+	logins *LoginGuard,
+	authenticator *Authenticator,
+	mailer email.Mailer,
+) *Accounts {
+	return &Accounts{
+		cfg:       cfg,
+		users:     users,
+		tokens:    tokens,
+		passwords: passwords,
+		logins:    logins,
+		auth:      authenticator,
+		mailer:    mailer,
+	}
+}
+
+// Emails the user a link to verify their email
+func (a *Accounts) SendVerification(ctx context.Context, user models.User) error {
+	if user.EmailVerificationDate.Valid {
+		return ErrEmailAlreadyVerified
+	}
+
+	link, err := a.issue(ctx, user.Id, models.TokenVerifyEmail, a.cfg.VerificationTokenTTL, a.cfg.VerifyURL)
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, email.Message{
+		To:      user.Email,
+		Subject: "Confirma tu email en Preguntame",
+		Body: fmt.Sprintf(
+			"%s\n\nPara confirmar tu email entra a este link:\n\n%s\n\nEl link vence en %s. Si no creaste una cuenta en Preguntame ignora este email.\n",
+			greeting(user), link, formatTTL(a.cfg.VerificationTokenTTL),
+		),
+	})
+}
+
+func (a *Accounts) VerifyEmail(ctx context.Context, token string) error {
+	now := time.Now()
+
+	consumed, err := a.tokens.ConsumeAccountToken(ctx, models.TokenVerifyEmail, hashOpaqueToken(token), now)
+	if err != nil {
+		return err
+	}
+	if consumed == nil {
+		return ErrInvalidAccountToken
+	}
+
+	// False only means it was already verified with another link
+	_, err = a.users.MarkEmailVerified(ctx, consumed.UserId, now)
+	return err
+}
+
+/**
+ * Emails a link to reset the password when the email is registered. Unknown emails
+ * and users that just got one are silently ignored, so the caller can't tell them apart.
+ */
+func (a *Accounts) ForgotPassword(ctx context.Context, address string) error {
+	user, err := a.users.FindUserByEmail(ctx, address)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		slog.Info("Password reset requested for unknown email")
+		return nil
+	}
+
+	link, err := a.issue(ctx, user.Id, models.TokenResetPassword, a.cfg.ResetTokenTTL, a.cfg.ResetURL)
+	if errors.Is(err, ErrEmailCooldown) {
+		slog.Info("Password reset requested again too soon", "user_id", user.Id)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, email.Message{
+		To:      user.Email,
+		Subject: "Cambia tu contraseña de Preguntame",
+		Body: fmt.Sprintf(
+			"%s\n\nPara elegir una nueva contraseña entra a este link:\n\n%s\n\nEl link vence en %s y se puede usar una sola vez. Si no pediste cambiar tu contraseña ignora este email, la actual sigue funcionando.\n",
+			greeting(*user), link, formatTTL(a.cfg.ResetTokenTTL),
+		),
+	})
+}
+
+/**
+ * Sets the new password and closes every session, whoever knew the old password is logged out.
+ * Opening the link also proves the user owns the email, so it gets verified and unlocked.
+ */
+func (a *Accounts) ResetPassword(ctx context.Context, token string, password string) error {
+	now := time.Now()
+
+	// Hashed first, so a password that can't be hashed doesn't burn the link
+	hash, err := a.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	consumed, err := a.tokens.ConsumeAccountToken(ctx, models.TokenResetPassword, hashOpaqueToken(token), now)
+	if err != nil {
+		return err
+	}
+	if consumed == nil {
+		return ErrInvalidAccountToken
+	}
+
+	updated, err := a.users.UpdateUserPassword(ctx, consumed.UserId, hash)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrInvalidAccountToken
+	}
+
+	if err := a.tokens.InvalidateAccountTokens(ctx, consumed.UserId, models.TokenResetPassword, now); err != nil {
+		return err
+	}
+	if _, err := a.users.MarkEmailVerified(ctx, consumed.UserId, now); err != nil {
+		return err
+	}
+	if err := a.logins.Succeeded(ctx, consumed.UserId); err != nil {
+		return err
+	}
+
+	slog.Info("Password reset", "user_id", consumed.UserId)
+	return a.auth.LogoutAll(ctx, consumed.UserId)
+}
+
+// Periodically deletes the expired tokens until the context is done
+func (a *Accounts) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := a.tokens.PurgeExpiredAccountTokens(ctx, now); err != nil {
+				slog.Error("Error purging account tokens", "error", err)
+			}
+		}
+	}
+}
+
+// Stores a new token and returns the link of the email with it
+func (a *Accounts) issue(ctx context.Context, userId models.UserID, purpose models.AccountTokenPurpose, ttl time.Duration, page string) (string, error) {
+	now := time.Now()
+
+	latest, err := a.tokens.FindLatestAccountTokenDate(ctx, userId, purpose)
+	if err != nil {
+		return "", err
+	}
+	if latest.Valid && now.Sub(latest.Time) < a.cfg.EmailCooldown {
+		return "", ErrEmailCooldown
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.tokens.InsertAccountToken(ctx, models.AccountToken{
+		Id:             id.String(),
+		UserId:         userId,
+		Purpose:        purpose,
+		TokenHash:      hashOpaqueToken(token),
+		CreationDate:   now,
+		ExpirationDate: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	link, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
+
+func greeting(user models.User) string {
+	if user.Name == "" {
+		return "Hola,"
+	}
+	return fmt.Sprintf("Hola %s,", user.Name)
+}
+
+func formatTTL(ttl time.Duration) string {
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		if ttl == time.Hour {
+			return "1 hora"
+		}
+		return fmt.Sprintf("%d horas", int(ttl.Hours()))
+	}
+
+	return fmt.Sprintf("%d minutos", int(ttl.Minutes()))
+}
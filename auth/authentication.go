@@ -1,16 +1,32 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/config"
 	"github.com/preguntame/preguntame-backend/models"
 )
 
-const JWT_SECRET = "Zoy Un Zecreto Muy Zecretozo"
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrRevokedToken        = errors.New("token has been revoked")
+	ErrAccountSuspended    = errors.New("account suspended")
+	ErrTokenExpired        = errors.New("token expired")
+	ErrRoleChanged         = errors.New("role changed")
+)
 
 type JwtHeaders struct {
 	JWT string `header:"authorization"`
@@ -20,57 +36,288 @@ type UserClaims struct {
 	Id    string `json:"id"`
 	Name  string `json:"name"`
 	Email string `json:"email"`
+	// Role when the token was issued, RequireAuth reads the current one for roles above user
+	Role models.Role `json:"role"`
+	// Refresh token family the access token was issued with, logging out revokes it
+	SessionId string `json:"sid"`
 
+	// StandardClaims.Id is the jti, it's shadowed by the user id above
 	jwt.StandardClaims
 }
 
-func NewTokenForUser(user models.User) (string, error) {
-	claims := UserClaims {
-		Id:    user.Id,
-		Name:  user.Name,
-		Email: user.Email,
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
 
-		StandardClaims: jwt.StandardClaims {
-			IssuedAt:  time.Now().Unix(),
-			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
-		},
+// Authenticator issues and verifies the JWT of the logged users and their refresh tokens
+type Authenticator struct {
+	keyring         *Keyring
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	users  models.UserStore
+	tokens models.TokenStore
+}
+
+func NewAuthenticator(cfg config.AuthConfig, users models.UserStore, tokens models.TokenStore) (*Authenticator, error) {
+	keyring, err := NewKeyring(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{
+		keyring:         keyring,
+		accessTokenTTL:  cfg.AccessTokenTTL,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+
+		users:  users,
+		tokens: tokens,
+	}, nil
+}
+
+// Starts a new session for the user, returning an access token and its refresh token
+func (a *Authenticator) IssueTokens(ctx context.Context, user models.User) (TokenPair, error) {
+	familyId, err := uuid.NewRandom()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return a.issueTokens(ctx, user, familyId.String())
+}
+
+/**
+ * Rotates the refresh token, the given one can't be used again.
+ * Using an already rotated or revoked token means it was stolen, so the whole family gets revoked.
+ */
+func (a *Authenticator) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	stored, err := a.tokens.FindRefreshTokenByHash(ctx, hashOpaqueToken(refreshToken))
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if stored == nil {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	now := time.Now()
+
+	if stored.UsedDate.Valid || stored.RevocationDate.Valid {
+		return TokenPair{}, a.revokeReusedFamily(ctx, *stored, now)
+	}
+
+	if now.After(stored.ExpirationDate) {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	marked, err := a.tokens.MarkRefreshTokenUsed(ctx, stored.Id, now)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	// Someone else rotated it between the read and the update
+	if !marked {
+		return TokenPair{}, a.revokeReusedFamily(ctx, *stored, now)
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	user, err := a.users.FindUserById(ctx, stored.UserId)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if user == nil {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+	if user.IsSuspended(now) {
+		return TokenPair{}, ErrAccountSuspended
+	}
 
-	return accessToken.SignedString([]byte(JWT_SECRET))
+	return a.issueTokens(ctx, *user, stored.FamilyId)
 }
 
-func DecodeUserToken(e echo.Context) (models.User, error) {
+// Revokes the access token and the session it belongs to
+func (a *Authenticator) Logout(ctx context.Context, principal Principal) error {
+	err := a.tokens.DenyAccessToken(ctx, principal.TokenId, principal.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return a.tokens.RevokeRefreshTokenFamily(ctx, principal.SessionId, time.Now())
+}
+
+// Revokes every session of the user
+func (a *Authenticator) LogoutAll(ctx context.Context, userId models.UserID) error {
+	return a.tokens.RevokeUserRefreshTokens(ctx, userId, time.Now())
+}
+
+// Validates the bearer token of the request and checks it wasn't revoked
+func (a *Authenticator) DecodeToken(e echo.Context) (UserClaims, error) {
 	headerString := e.Request().Header.Get("Authorization")
 
 	if !strings.HasPrefix(headerString, "Bearer ") {
-		return models.User{}, fmt.Errorf("Wrong prefix")
+		return UserClaims{}, fmt.Errorf("Wrong prefix")
 	}
 
 	tokenString := strings.TrimPrefix(headerString, "Bearer ")
 
-	claims := UserClaims {}
-	_, err := jwt.ParseWithClaims(tokenString, &claims, getSecretForToken)
+	claims := UserClaims{}
+	err := a.keyring.Parse(tokenString, &claims)
 	if err != nil {
-		return models.User{}, err
+		return UserClaims{}, err
 	}
 
 	err = claims.Valid()
 	if err != nil {
-		return models.User{}, err
+		return UserClaims{}, err
+	}
+
+	denied, err := a.tokens.IsAccessTokenDenied(e.Request().Context(), claims.StandardClaims.Id)
+	if err != nil {
+		return UserClaims{}, err
+	}
+	if denied {
+		return UserClaims{}, ErrRevokedToken
+	}
+
+	return claims, nil
+}
+
+/**
+ * Checks again the principal of a connection that outlives a request: the token must not have
+ * expired nor been revoked by a logout, and the user must still exist, not be suspended and
+ * keep the role the connection was opened with.
+ */
+func (a *Authenticator) Revalidate(ctx context.Context, principal Principal, now time.Time) error {
+	if !now.Before(principal.ExpiresAt) {
+		return ErrTokenExpired
+	}
+
+	denied, err := a.tokens.IsAccessTokenDenied(ctx, principal.TokenId)
+	if err != nil {
+		return err
+	}
+	if denied {
+		return ErrRevokedToken
+	}
+
+	user, err := a.users.FindUserById(ctx, principal.UserId)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrRevokedToken
+	}
+	if user.IsSuspended(now) {
+		return ErrAccountSuspended
+	}
+	if user.Role != principal.Role {
+		return ErrRoleChanged
+	}
+
+	return nil
+}
+
+// Public keys other services can use to verify our tokens
+func (a *Authenticator) JWKS() JWKSet {
+	return a.keyring.JWKS()
+}
+
+// Periodically removes expired refresh tokens and denylist entries until the context is done
+func (a *Authenticator) RunTokenCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := a.tokens.PurgeExpiredTokens(ctx, now); err != nil {
+				slog.Error("Error purging expired tokens", "error", err)
+			}
+		}
+	}
+}
+
+func (a *Authenticator) issueTokens(ctx context.Context, user models.User, familyId string) (TokenPair, error) {
+	now := time.Now()
+
+	accessTokenId, err := uuid.NewRandom()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refreshTokenId, err := uuid.NewRandom()
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	claims := UserClaims{
+		Id:        user.Id,
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionId: familyId,
+
+		StandardClaims: jwt.StandardClaims{
+			Id:        accessTokenId.String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(a.accessTokenTTL).Unix(),
+		},
 	}
 
-	user := models.User {
-		Id:    claims.Id,
-		Name:  claims.Name,
-		Email: claims.Email,
+	accessToken, err := a.keyring.Sign(claims)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return TokenPair{}, err
 	}
 
-	return user, nil
+	err = a.tokens.InsertRefreshToken(ctx, models.RefreshToken{
+		Id:                   refreshTokenId.String(),
+		FamilyId:             familyId,
+		UserId:               user.Id,
+		TokenHash:            hashOpaqueToken(refreshToken),
+		AccessTokenId:        accessTokenId.String(),
+		AccessTokenExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		CreationDate:         now,
+		ExpirationDate:       now.Add(a.refreshTokenTTL),
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(a.accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func (a *Authenticator) revokeReusedFamily(ctx context.Context, token models.RefreshToken, now time.Time) error {
+	slog.Warn("Refresh token reused, revoking its family", "user_id", token.UserId, "family_id", token.FamilyId)
+
+	if err := a.tokens.RevokeRefreshTokenFamily(ctx, token.FamilyId, now); err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
 }
 
-//TODO(fepalacios): Validate that the agl of the token is what we expected
-func getSecretForToken(token *jwt.Token) (interface{}, error) {
-	return []byte(JWT_SECRET), nil
-}
\ No newline at end of file
+// Random token only the client knows, like refresh tokens and the tokens of the email links
+func newOpaqueToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// Opaque tokens are random enough that a fast hash is safe, unlike passwords
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/config"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+func newTestAuthenticator(t *testing.T) (*Authenticator, *models.MemoryStore, models.User) {
+	t.Helper()
+
+	store := models.NewMemoryStore()
+	user := models.User{Id: "11111111-1111-1111-1111-111111111111", Name: "ana", Email: "ana@example.com", Role: models.RoleUser}
+	if err := store.InsertUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err := NewAuthenticator(config.AuthConfig{
+		JWTSecret:       "0123456789abcdef0123456789abcdef",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, store, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return authenticator, store, user
+}
+
+// Decodes the access token the way RequireAuth does
+func decodeAccessToken(authenticator *Authenticator, accessToken string) (UserClaims, error) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+accessToken)
+
+	return authenticator.DecodeToken(echo.New().NewContext(req, httptest.NewRecorder()))
+}
+
+func TestRefreshRotatesTheTokens(t *testing.T) {
+	authenticator, _, user := newTestAuthenticator(t)
+	ctx := context.Background()
+
+	first, err := authenticator.IssueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := authenticator.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Fatal("refreshing didn't rotate the tokens")
+	}
+
+	claims, err := decodeAccessToken(authenticator, second.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstClaims, err := decodeAccessToken(authenticator, first.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Id != user.Id || claims.SessionId != firstClaims.SessionId {
+		t.Errorf("claims = %+v, want the same user and session", claims)
+	}
+
+	if _, err := authenticator.Refresh(ctx, "not-a-refresh-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown refresh token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestReusedRefreshTokensRevokeTheirFamily(t *testing.T) {
+	authenticator, _, user := newTestAuthenticator(t)
+	ctx := context.Background()
+
+	first, err := authenticator.IssueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := authenticator.IssueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := authenticator.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Whoever stole the first token uses it after the client rotated it
+	if _, err := authenticator.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused refresh token: err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	tests := []struct {
+		name      string
+		refresh   string
+		access    string
+		wantValid bool
+	}{
+		{"the latest token of the family", second.RefreshToken, second.AccessToken, false},
+		{"another session of the user", other.RefreshToken, other.AccessToken, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, accessErr := decodeAccessToken(authenticator, test.access)
+			_, refreshErr := authenticator.Refresh(ctx, test.refresh)
+
+			if test.wantValid && (accessErr != nil || refreshErr != nil) {
+				t.Errorf("access err = %v, refresh err = %v, want both valid", accessErr, refreshErr)
+			}
+			if !test.wantValid && (!errors.Is(accessErr, ErrRevokedToken) || refreshErr == nil) {
+				t.Errorf("access err = %v, refresh err = %v, want both revoked", accessErr, refreshErr)
+			}
+		})
+	}
+}
+
+func TestDeniedAccessTokensAreRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(a *Authenticator, principal Principal) error
+	}{
+		{"logout", func(a *Authenticator, principal Principal) error {
+			return a.Logout(context.Background(), principal)
+		}},
+		{"logout of every session", func(a *Authenticator, principal Principal) error {
+			return a.LogoutAll(context.Background(), principal.UserId)
+		}},
+		{"denylisted jti", func(a *Authenticator, principal Principal) error {
+			return a.tokens.DenyAccessToken(context.Background(), principal.TokenId, principal.ExpiresAt)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator, _, user := newTestAuthenticator(t)
+
+			tokens, err := authenticator.IssueTokens(context.Background(), user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := decodeAccessToken(authenticator, tokens.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			principal := principalFromClaims(claims)
+			if err := test.revoke(authenticator, principal); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := decodeAccessToken(authenticator, tokens.AccessToken); !errors.Is(err, ErrRevokedToken) {
+				t.Errorf("err = %v, want ErrRevokedToken", err)
+			}
+			if err := authenticator.Revalidate(context.Background(), principal, time.Now()); !errors.Is(err, ErrRevokedToken) {
+				t.Errorf("revalidating: err = %v, want ErrRevokedToken", err)
+			}
+		})
+	}
+}
+
+func TestSuspendedUsersCantRefresh(t *testing.T) {
+	authenticator, store, user := newTestAuthenticator(t)
+	ctx := context.Background()
+
+	tokens, err := authenticator.IssueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.SuspendUser(ctx, user.Id, time.Now(), sql.NullTime{}, "Spam"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := authenticator.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrAccountSuspended) {
+		t.Errorf("err = %v, want ErrAccountSuspended", err)
+	}
+}
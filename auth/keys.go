@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+var (
+	ErrUnknownKey          = errors.New("unknown signing key")
+	ErrUnexpectedAlgorithm = errors.New("unexpected signing algorithm")
+)
+
+// A key that verifies tokens and, when its private part is known, signs them
+type SigningKey struct {
+	Id     string
+	Method jwt.SigningMethod
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+/**
+ * Keyring holds every key accepted for verification, identified by the `kid` header,
+ * and the one used to sign new tokens. Old keys can stay in the keyring after a
+ * rotation until every token they signed has expired.
+ */
+type Keyring struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+// Public key in JWK format, see RFC 7517 and RFC 8037
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+/**
+ * Loads the keys of the configuration. When no keys are configured the legacy
+ * jwt_secret is used as an HS256 key.
+ */
+func NewKeyring(cfg config.AuthConfig) (*Keyring, error) {
+	keyring := &Keyring{keys: map[string]*SigningKey{}}
+
+	keyConfigs := cfg.Keys
+	signingKeyId := cfg.SigningKeyId
+	if len(keyConfigs) == 0 {
+		keyConfigs = []config.JWTKeyConfig{{
+			Id:        config.LegacySecretKeyId,
+			Algorithm: jwt.SigningMethodHS256.Alg(),
+			Secret:    cfg.JWTSecret,
+		}}
+		signingKeyId = config.LegacySecretKeyId
+	}
+
+	for _, keyConfig := range keyConfigs {
+		key, err := loadKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("loading jwt key %q: %w", keyConfig.Id, err)
+		}
+		keyring.keys[key.Id] = key
+	}
+
+	signing, ok := keyring.keys[signingKeyId]
+	if !ok || signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %q must be configured with its private key or secret", signingKeyId)
+	}
+	keyring.signing = signing
+
+	return keyring, nil
+}
+
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.Id
+
+	return token.SignedString(k.signing.signKey)
+}
+
+// Parses the token only accepting the algorithms of the keyring and the algorithm of the key named by its kid
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims) error {
+	parser := jwt.Parser{ValidMethods: k.algorithms()}
+
+	_, err := parser.ParseWithClaims(tokenString, claims, k.keyForToken)
+	return err
+}
+
+// Only asymmetric keys are published, HMAC secrets never leave the server
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	for _, key := range k.keys {
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.Id,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.Id,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+func (k *Keyring) keyForToken(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	// Without this check a token could be verified with a public key used as an HMAC secret
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrUnexpectedAlgorithm
+	}
+
+	return key.verifyKey, nil
+}
+
+func (k *Keyring) algorithms() []string {
+	seen := map[string]bool{}
+	algorithms := []string{}
+
+	for _, key := range k.keys {
+		if !seen[key.Method.Alg()] {
+			seen[key.Method.Alg()] = true
+			algorithms = append(algorithms, key.Method.Alg())
+		}
+	}
+
+	return algorithms
+}
+
+func loadKey(cfg config.JWTKeyConfig) (*SigningKey, error) {
+	key := &SigningKey{Id: cfg.Id}
+
+	switch cfg.Algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		key.Method = jwt.SigningMethodHS256
+		key.signKey = []byte(cfg.Secret.Reveal())
+		key.verifyKey = []byte(cfg.Secret.Reveal())
+		return key, nil
+
+	case jwt.SigningMethodRS256.Alg():
+		key.Method = jwt.SigningMethodRS256
+
+	case jwt.SigningMethodEdDSA.Alg():
+		key.Method = jwt.SigningMethodEdDSA
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	if cfg.PrivateKeyFile != "" {
+		private, err := readPrivateKey(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		switch private := private.(type) {
+		case *rsa.PrivateKey:
+			key.signKey = private
+			key.verifyKey = &private.PublicKey
+		case ed25519.PrivateKey:
+			key.signKey = private
+			key.verifyKey = private.Public()
+		}
+	} else {
+		public, err := readPublicKey(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key.verifyKey = public
+	}
+
+	if !keyMatchesMethod(key.verifyKey, key.Method) {
+		return nil, fmt.Errorf("key type %T can't be used with %s", key.verifyKey, key.Method.Alg())
+	}
+
+	return key, nil
+}
+
+func keyMatchesMethod(verifyKey interface{}, method jwt.SigningMethod) bool {
+	switch verifyKey.(type) {
+	case *rsa.PublicKey:
+		return method == jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		return method == jwt.SigningMethodEdDSA
+	}
+
+	return false
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s doesn't contain a PEM block", path)
+	}
+
+	return block, nil
+}
+
+func readPrivateKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+func readPublicKey(path string) (interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+// Files with a fresh RSA and Ed25519 key pair
+type testKeyFiles struct {
+	rsaPrivate, rsaPublic         string
+	ed25519Private, ed25519Public string
+	rsaKey                        *rsa.PrivateKey
+	ed25519Key                    ed25519.PrivateKey
+}
+
+func writeTestKeys(t *testing.T) *testKeyFiles {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	write := func(name string, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	marshal := func(der []byte, err error) []byte {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testKeyFiles{
+		rsaPrivate:     write("rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)),
+		rsaPublic:      write("rsa.pub", "PUBLIC KEY", marshal(x509.MarshalPKIXPublicKey(&rsaKey.PublicKey))),
+		ed25519Private: write("ed25519.pem", "PRIVATE KEY", marshal(x509.MarshalPKCS8PrivateKey(ed25519Key))),
+		ed25519Public:  write("ed25519.pub", "PUBLIC KEY", marshal(x509.MarshalPKIXPublicKey(ed25519Key.Public()))),
+		rsaKey:         rsaKey,
+		ed25519Key:     ed25519Key,
+	}
+}
+
+func newTestKeyring(t *testing.T, signingKeyId string, keys ...config.JWTKeyConfig) *Keyring {
+	t.Helper()
+
+	keyring, err := NewKeyring(config.AuthConfig{Keys: keys, SigningKeyId: signingKeyId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func testClaims() UserClaims {
+	return UserClaims{
+		Id: "11111111-1111-1111-1111-111111111111",
+		StandardClaims: jwt.StandardClaims{
+			Id:        "22222222-2222-2222-2222-222222222222",
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+	}
+}
+
+// Signs the claims with any method and key, setting the kid header when it isn't empty
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, testClaims())
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestKeyringOnlyAcceptsTheAlgorithmOfEachKey(t *testing.T) {
+	keys := writeTestKeys(t)
+	rsaPEM, err := os.ReadFile(keys.rsaPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519PEM, err := os.ReadFile(keys.ed25519Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := newTestKeyring(t, "rsa",
+		config.JWTKeyConfig{Id: "rsa", Algorithm: "RS256", PrivateKeyFile: keys.rsaPrivate},
+		config.JWTKeyConfig{Id: "ed", Algorithm: "EdDSA", PrivateKeyFile: keys.ed25519Private},
+	)
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"RS256 with the RSA key", signTestToken(t, jwt.SigningMethodRS256, "rsa", keys.rsaKey), true},
+		{"EdDSA with the Ed25519 key", signTestToken(t, jwt.SigningMethodEdDSA, "ed", keys.ed25519Key), true},
+		// The public keys are public, an attacker can use them as HMAC secrets
+		{"HS256 with the RSA public key as secret", signTestToken(t, jwt.SigningMethodHS256, "rsa", rsaPEM), false},
+		{"HS256 with the Ed25519 public key as secret", signTestToken(t, jwt.SigningMethodHS256, "ed", ed25519PEM), false},
+		{"EdDSA under the kid of the RSA key", signTestToken(t, jwt.SigningMethodEdDSA, "rsa", keys.ed25519Key), false},
+		{"unsigned", signTestToken(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := keyring.Parse(test.token, &UserClaims{})
+			if test.valid && err != nil {
+				t.Fatalf("err = %v, want the token accepted", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("the token was accepted")
+			}
+		})
+	}
+}
+
+func TestKeyringRejectsUnknownAndRotatedKeys(t *testing.T) {
+	keys := writeTestKeys(t)
+
+	rsaKey := config.JWTKeyConfig{Id: "2025", Algorithm: "RS256", PrivateKeyFile: keys.rsaPrivate}
+	edKey := config.JWTKeyConfig{Id: "2026", Algorithm: "EdDSA", PrivateKeyFile: keys.ed25519Private}
+	// After the rotation the old key is only kept to verify, with its public part
+	retiredKey := config.JWTKeyConfig{Id: "2025", Algorithm: "RS256", PublicKeyFile: keys.rsaPublic}
+
+	before := newTestKeyring(t, "2025", rsaKey)
+	oldToken, err := before.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	during := newTestKeyring(t, "2026", edKey, retiredKey)
+	newToken, err := during.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after := newTestKeyring(t, "2026", edKey)
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		token   string
+		valid   bool
+	}{
+		{"old token while its key is kept", during, oldToken, true},
+		{"new token during the rotation", during, newToken, true},
+		{"old token once its key was removed", after, oldToken, false},
+		{"new token after the rotation", after, newToken, true},
+		{"new token before the rotation", before, newToken, false},
+		{"token without kid", during, signTestToken(t, jwt.SigningMethodEdDSA, "", keys.ed25519Key), false},
+		{"token with an unknown kid", during, signTestToken(t, jwt.SigningMethodEdDSA, "2027", keys.ed25519Key), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.keyring.Parse(test.token, &UserClaims{})
+			if test.valid && err != nil {
+				t.Fatalf("err = %v, want the token accepted", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("the token was accepted")
+			}
+		})
+	}
+
+	// Algorithms the keyring has are rejected by the kid, the rest before looking at it
+	err = during.Parse(signTestToken(t, jwt.SigningMethodEdDSA, "2027", keys.ed25519Key), &UserClaims{})
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Inner != ErrUnknownKey {
+		t.Errorf("err = %v, want ErrUnknownKey", err)
+	}
+
+	// A key that only verifies can't sign
+	if _, err := NewKeyring(config.AuthConfig{Keys: []config.JWTKeyConfig{retiredKey}, SigningKeyId: "2025"}); err == nil {
+		t.Error("a public key was accepted as the signing key")
+	}
+}
+
+func TestJWKSPublishesOnlyPublicKeys(t *testing.T) {
+	keys := writeTestKeys(t)
+
+	keyring := newTestKeyring(t, "rsa",
+		config.JWTKeyConfig{Id: "rsa", Algorithm: "RS256", PrivateKeyFile: keys.rsaPrivate},
+		config.JWTKeyConfig{Id: "ed", Algorithm: "EdDSA", PublicKeyFile: keys.ed25519Public},
+		config.JWTKeyConfig{Id: "hmac", Algorithm: "HS256", Secret: "0123456789abcdef0123456789abcdef"},
+	)
+
+	set := keyring.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("keys = %+v, want the RSA and Ed25519 ones", set.Keys)
+	}
+
+	ed, rsaJWK := set.Keys[0], set.Keys[1]
+	if ed.Kid != "ed" || ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("Ed25519 key = %+v", ed)
+	}
+	if ed.X != base64.RawURLEncoding.EncodeToString(keys.ed25519Key.Public().(ed25519.PublicKey)) {
+		t.Errorf("x = %q doesn't encode the public key", ed.X)
+	}
+
+	if rsaJWK.Kid != "rsa" || rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.Use != "sig" {
+		t.Errorf("RSA key = %+v", rsaJWK)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	if err != nil || new(big.Int).SetBytes(n).Cmp(keys.rsaKey.N) != 0 {
+		t.Errorf("n = %q doesn't encode the modulus", rsaJWK.N)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(rsaJWK.E)
+	if err != nil || new(big.Int).SetBytes(e).Int64() != int64(keys.rsaKey.E) {
+		t.Errorf("e = %q doesn't encode the exponent", rsaJWK.E)
+	}
+	if rsaJWK.X != "" || ed.N != "" {
+		t.Error("keys have the fields of the other key type")
+	}
+}
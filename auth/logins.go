@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/config"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+/**
+ * LoginGuard slows down password guessing on a single account. Every failed login
+ * counts against the account, see config.LoginsConfig for how long it gets locked.
+ * Guessing across many accounts is limited per IP by the rate limits instead.
+ * Emails that aren't registered are locked the same way, otherwise getting locked
+ * would tell that an email is registered.
+ */
+type LoginGuard struct {
+	cfg    config.LoginsConfig
+	logins models.LoginStore
+}
+
+func NewLoginGuard(cfg config.LoginsConfig, logins models.LoginStore) *LoginGuard {
+	return &LoginGuard{cfg: cfg, logins: logins}
+}
+
+// Returns how long the account stays locked, zero when it can log in
+func (g *LoginGuard) LockedFor(ctx context.Context, userId models.UserID, now time.Time) (time.Duration, error) {
+	failures, err := g.logins.FindLoginFailures(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return lockedFor(failures, now), nil
+}
+
+// Counts the failure and locks the account for as long as the failures so far deserve
+func (g *LoginGuard) Failed(ctx context.Context, userId models.UserID, now time.Time) error {
+	count, err := g.logins.AddLoginFailure(ctx, userId, now, now.Add(-g.cfg.FailureWindow))
+	if err != nil {
+		return err
+	}
+
+	lock := g.lockFor(count)
+	if lock == 0 {
+		return nil
+	}
+
+	slog.Warn("Locking account after failed logins", "user_id", userId, "failures", count, "lock", lock)
+	return g.logins.LockLogin(ctx, userId, now.Add(lock))
+}
+
+// Like LockedFor, for an email that isn't registered
+func (g *LoginGuard) UnknownLockedFor(ctx context.Context, email string, now time.Time) (time.Duration, error) {
+	failures, err := g.logins.FindUnknownLoginFailures(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+
+	return lockedFor(failures, now), nil
+}
+
+// Like Failed, for an email that isn't registered
+func (g *LoginGuard) UnknownFailed(ctx context.Context, email string, now time.Time) error {
+	count, err := g.logins.AddUnknownLoginFailure(ctx, email, now, now.Add(-g.cfg.FailureWindow))
+	if err != nil {
+		return err
+	}
+
+	lock := g.lockFor(count)
+	if lock == 0 {
+		return nil
+	}
+
+	return g.logins.LockUnknownLogin(ctx, email, now.Add(lock))
+}
+
+func lockedFor(failures models.LoginFailures, now time.Time) time.Duration {
+	if !failures.LockedUntil.Valid || !failures.LockedUntil.Time.After(now) {
+		return 0
+	}
+
+	return failures.LockedUntil.Time.Sub(now)
+}
+
+func (g *LoginGuard) Succeeded(ctx context.Context, userId models.UserID) error {
+	return g.logins.ResetLoginFailures(ctx, userId)
+}
+
+func (g *LoginGuard) lockFor(failures int) time.Duration {
+	if failures >= g.cfg.LockoutAttempts {
+		return g.cfg.LockoutDuration
+	}
+	if failures <= g.cfg.FreeAttempts {
+		return 0
+	}
+
+	lock := g.cfg.BackoffBase << (failures - g.cfg.FreeAttempts - 1)
+	// The shift overflows long before the count gets large
+	if lock <= 0 || lock > g.cfg.LockoutDuration {
+		return g.cfg.LockoutDuration
+	}
+
+	return lock
+}
+
+// Periodically deletes the login attempts older than the audit retention and the forgotten failures
+// of unknown emails until the context is done
+func (g *LoginGuard) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := g.logins.DeleteLoginAttemptsBefore(ctx, now.Add(-g.cfg.AuditRetention)); err != nil {
+				slog.Error("Error purging login attempts", "error", err)
+			}
+			if err := g.logins.PurgeUnknownLoginFailures(ctx, now.Add(-g.cfg.FailureWindow), now); err != nil {
+				slog.Error("Error purging unknown login failures", "error", err)
+			}
+		}
+	}
+}
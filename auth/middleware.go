@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+const principalContextKey = "auth.principal"
+
+// Principal is the authenticated user of a request, taken from a valid access token
+type Principal struct {
+	UserId    models.UserID
+	Name      string
+	Email     string
+	Role      models.Role
+	SessionId string
+	TokenId   string
+	ExpiresAt time.Time
+}
+
+/**
+ * Middleware that rejects requests without a valid bearer token and stores the principal in the context.
+ * Tokens keep the role they were issued with, so roles above user are read again from the store and
+ * demoting someone takes effect right away instead of when their access token expires.
+ */
+func (a *Authenticator) RequireAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		claims, err := a.DecodeToken(e)
+		if err != nil {
+			slog.Warn("Invalid/Missing jwt", "error", err)
+			return apperrors.Unauthorized("Invalid/Missing jwt")
+		}
+
+		principal := principalFromClaims(claims)
+		if principal.Role != models.RoleUser {
+			user, err := a.users.FindUserById(e.Request().Context(), principal.UserId)
+			if err != nil {
+				slog.Error("Error getting user from db", "user_id", principal.UserId, "error", err)
+				return err
+			}
+			if user == nil {
+				return apperrors.Unauthorized("Invalid/Missing jwt")
+			}
+
+			principal.Role = user.Role
+		}
+
+		e.Set(principalContextKey, principal)
+		return next(e)
+	}
+}
+
+/**
+ * Middleware for public routes that show more to the logged user. Requests without
+ * an Authorization header go through anonymously, but a bad token is still rejected.
+ */
+func (a *Authenticator) OptionalAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		if e.Request().Header.Get("Authorization") == "" {
+			return next(e)
+		}
+
+		return a.RequireAuth(next)(e)
+	}
+}
+
+/**
+ * Browsers can't set headers on EventSource and WebSocket connections, so routes for them can
+ * take the access token from the query instead. It must run before RequireAuth.
+ */
+func TokenFromQuery(param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(e echo.Context) error {
+			token := e.QueryParam(param)
+			if token != "" && e.Request().Header.Get("Authorization") == "" {
+				e.Request().Header.Set("Authorization", "Bearer "+token)
+			}
+
+			return next(e)
+		}
+	}
+}
+
+func principalFromClaims(claims UserClaims) Principal {
+	// Tokens issued before roles existed don't have one
+	role := claims.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+
+	return Principal{
+		UserId:    claims.Id,
+		Name:      claims.Name,
+		Email:     claims.Email,
+		Role:      role,
+		SessionId: claims.SessionId,
+		TokenId:   claims.StandardClaims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}
+}
+
+// Returns the principal stored by RequireAuth, ok is false when the route isn't authenticated
+func PrincipalFrom(e echo.Context) (Principal, bool) {
+	principal, ok := e.Get(principalContextKey).(Principal)
+	return principal, ok
+}
+
+// Same as PrincipalFrom for handlers that are always behind RequireAuth
+func CurrentPrincipal(e echo.Context) Principal {
+	principal, _ := PrincipalFrom(e)
+	return principal
+}
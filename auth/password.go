@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/preguntame/preguntame-backend/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// Bounds of the parameters read from stored argon2id hashes, so a tampered row can't make verifying panic or take any amount of memory
+const (
+	argon2MaxMemory = 1024 * 1024 // KiB
+	argon2MaxTime   = 64
+	argon2MinKeyLen = 16
+)
+
+// PasswordHasher hashes passwords into PHC formatted strings
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Checks the password against an encoded hash generated by this hasher.
+	// needsRehash is true when the hash was generated with weaker parameters than the current ones.
+	Verify(password string, encoded string) (ok bool, needsRehash bool, err error)
+	// Reports whether the encoded hash was generated by this algorithm
+	Recognizes(encoded string) bool
+}
+
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+/**
+ * Passwords hashes new passwords with the preferred hasher and verifies
+ * hashes from every supported algorithm, and legacy plaintext rows when allowed.
+ */
+type Passwords struct {
+	preferred      PasswordHasher
+	hashers        []PasswordHasher
+	allowPlaintext bool
+	// Hash of a random password, verified for emails that aren't registered
+	dummyHash string
+}
+
+func NewPasswords(cfg config.PasswordsConfig) (*Passwords, error) {
+	argon := &Argon2idHasher{
+		Memory:  cfg.Argon2Memory,
+		Time:    cfg.Argon2Time,
+		Threads: cfg.Argon2Threads,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+	bcryptHasher := &BcryptHasher{Cost: cfg.BcryptCost}
+
+	passwords := &Passwords{hashers: []PasswordHasher{argon, bcryptHasher}, allowPlaintext: cfg.AllowPlaintext}
+
+	switch cfg.Algorithm {
+	case config.PasswordArgon2id:
+		passwords.preferred = argon
+	case config.PasswordBcrypt:
+		passwords.preferred = bcryptHasher
+	default:
+		return nil, fmt.Errorf("unknown password algorithm %q", cfg.Algorithm)
+	}
+
+	dummy := make([]byte, 32)
+	if _, err := rand.Read(dummy); err != nil {
+		return nil, err
+	}
+	dummyHash, err := passwords.preferred.Hash(base64.RawStdEncoding.EncodeToString(dummy))
+	if err != nil {
+		return nil, err
+	}
+	passwords.dummyHash = dummyHash
+
+	return passwords, nil
+}
+
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.preferred.Hash(password)
+}
+
+/**
+ * Checks the password against the stored value.
+ * needsRehash is true when the stored value is plaintext, uses another algorithm
+ * than the preferred one or uses outdated parameters.
+ */
+func (p *Passwords) Verify(password string, stored string) (ok bool, needsRehash bool, err error) {
+	for _, hasher := range p.hashers {
+		if !hasher.Recognizes(stored) {
+			continue
+		}
+
+		ok, needsRehash, err = hasher.Verify(password, stored)
+		if err != nil || !ok {
+			return false, false, err
+		}
+
+		return true, needsRehash || hasher != p.preferred, nil
+	}
+
+	// Legacy rows stored the password in plaintext, they're only accepted until hash-passwords runs
+	if !p.allowPlaintext {
+		return false, false, ErrInvalidHash
+	}
+	ok = subtle.ConstantTimeCompare([]byte(password), []byte(stored)) == 1
+	return ok, ok, nil
+}
+
+/**
+ * Takes as long as verifying a password of a registered user, so the response time
+ * doesn't tell whether an email is registered. It never matches.
+ */
+func (p *Passwords) VerifyUnknownUser(password string) {
+	p.preferred.Verify(password, p.dummyHash)
+}
+
+// Reports whether the stored value is a hash generated by any supported algorithm
+func (p *Passwords) IsHashed(stored string) bool {
+	for _, hasher := range p.hashers {
+		if hasher.Recognizes(stored) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password string, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrInvalidHash
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false, ErrInvalidHash
+	}
+	if threads < 1 || time < 1 || time > argon2MaxTime || memory < 8*uint32(threads) || memory > argon2MaxMemory {
+		return false, false, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrInvalidHash
+	}
+
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(expected) < argon2MinKeyLen {
+		return false, false, ErrInvalidHash
+	}
+
+	key := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(expected)))
+	if subtle.ConstantTimeCompare(key, expected) != 1 {
+		return false, false, nil
+	}
+
+	needsRehash := memory < h.Memory || time < h.Time || threads < h.Threads || uint32(len(expected)) < h.KeyLen
+	return true, needsRehash, nil
+}
+
+func (h *Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h *BcryptHasher) Verify(password string, encoded string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, cost < h.Cost, nil
+}
+
+func (h *BcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+// Cheap parameters, the tests don't need slow hashes
+func testPasswordsConfig(algorithm string) config.PasswordsConfig {
+	return config.PasswordsConfig{
+		Algorithm:     algorithm,
+		Argon2Memory:  8 * 1024,
+		Argon2Time:    1,
+		Argon2Threads: 1,
+		BcryptCost:    4,
+	}
+}
+
+func newTestPasswords(t *testing.T, cfg config.PasswordsConfig) *Passwords {
+	t.Helper()
+
+	passwords, err := NewPasswords(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return passwords
+}
+
+func TestPasswordsHashAndVerify(t *testing.T) {
+	for _, algorithm := range []string{config.PasswordArgon2id, config.PasswordBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			passwords := newTestPasswords(t, testPasswordsConfig(algorithm))
+
+			hash, err := passwords.Hash("Abcdefg1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash == "Abcdefg1" || !passwords.IsHashed(hash) {
+				t.Fatalf("hash %q isn't recognized", hash)
+			}
+
+			other, err := passwords.Hash("Abcdefg1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other == hash {
+				t.Error("two hashes of the same password are equal, the salt isn't random")
+			}
+
+			ok, needsRehash, err := passwords.Verify("Abcdefg1", hash)
+			if err != nil || !ok || needsRehash {
+				t.Errorf("right password: ok = %v, needsRehash = %v, err = %v", ok, needsRehash, err)
+			}
+
+			ok, needsRehash, err = passwords.Verify("Abcdefg2", hash)
+			if err != nil || ok || needsRehash {
+				t.Errorf("wrong password: ok = %v, needsRehash = %v, err = %v", ok, needsRehash, err)
+			}
+		})
+	}
+}
+
+func TestPasswordsDetectHashesToRehash(t *testing.T) {
+	weak := testPasswordsConfig(config.PasswordArgon2id)
+	strong := weak
+	strong.Argon2Time = 2
+	strong.BcryptCost = 5
+	bcryptCfg := weak
+	bcryptCfg.Algorithm = config.PasswordBcrypt
+	strongBcrypt := strong
+	strongBcrypt.Algorithm = config.PasswordBcrypt
+
+	tests := []struct {
+		name   string
+		hashed config.PasswordsConfig
+		now    config.PasswordsConfig
+		want   bool
+	}{
+		{"same argon2id parameters", weak, weak, false},
+		{"more argon2id iterations", weak, strong, true},
+		{"fewer argon2id iterations", strong, weak, false},
+		{"same bcrypt cost", bcryptCfg, bcryptCfg, false},
+		{"higher bcrypt cost", bcryptCfg, strongBcrypt, true},
+		{"bcrypt to argon2id", bcryptCfg, weak, true},
+		{"argon2id to bcrypt", weak, bcryptCfg, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash, err := newTestPasswords(t, test.hashed).Hash("Abcdefg1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ok, needsRehash, err := newTestPasswords(t, test.now).Verify("Abcdefg1", hash)
+			if err != nil || !ok {
+				t.Fatalf("ok = %v, err = %v", ok, err)
+			}
+			if needsRehash != test.want {
+				t.Errorf("needsRehash = %v, want %v", needsRehash, test.want)
+			}
+		})
+	}
+}
+
+func TestPlaintextPasswordsAreOnlyAcceptedWhenAllowed(t *testing.T) {
+	cfg := testPasswordsConfig(config.PasswordArgon2id)
+
+	if _, _, err := newTestPasswords(t, cfg).Verify("Abcdefg1", "Abcdefg1"); !errors.Is(err, ErrInvalidHash) {
+		t.Fatalf("err = %v, want ErrInvalidHash", err)
+	}
+
+	cfg.AllowPlaintext = true
+	passwords := newTestPasswords(t, cfg)
+
+	ok, needsRehash, err := passwords.Verify("Abcdefg1", "Abcdefg1")
+	if err != nil || !ok || !needsRehash {
+		t.Errorf("right password: ok = %v, needsRehash = %v, err = %v", ok, needsRehash, err)
+	}
+	if ok, _, _ := passwords.Verify("Abcdefg2", "Abcdefg1"); ok {
+		t.Error("wrong password matched the plaintext")
+	}
+}
+
+func TestArgon2idRejectsParametersOutOfBounds(t *testing.T) {
+	passwords := newTestPasswords(t, testPasswordsConfig(config.PasswordArgon2id))
+
+	// A valid salt and key, only the parameters change
+	hash, err := passwords.Hash("Abcdefg1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(hash, "$")
+
+	tests := []struct {
+		name   string
+		params string
+		key    string
+	}{
+		{"no threads", "m=8192,t=1,p=0", parts[5]},
+		{"no iterations", "m=8192,t=0,p=1", parts[5]},
+		{"too many iterations", "m=8192,t=1000000,p=1", parts[5]},
+		{"too much memory", "m=4294967295,t=1,p=1", parts[5]},
+		{"less than 8 KiB per thread", "m=8,t=1,p=2", parts[5]},
+		{"not numbers", "m=a,t=1,p=1", parts[5]},
+		{"empty key", parts[3], ""},
+		{"short key", parts[3], parts[5][:8]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tampered := strings.Join([]string{"", parts[1], parts[2], test.params, parts[4], test.key}, "$")
+
+			ok, _, err := passwords.Verify("Abcdefg1", tampered)
+			if ok || !errors.Is(err, ErrInvalidHash) {
+				t.Errorf("ok = %v, err = %v, want ErrInvalidHash", ok, err)
+			}
+		})
+	}
+}
+
+func TestVerifyUnknownUserTakesAsLongAsAWrongPassword(t *testing.T) {
+	cfg := testPasswordsConfig(config.PasswordArgon2id)
+	cfg.Argon2Memory = 32 * 1024
+	cfg.Argon2Time = 2
+	passwords := newTestPasswords(t, cfg)
+
+	hash, err := passwords.Hash("Abcdefg1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cheapest of a few runs, so a busy machine doesn't make it flaky
+	fastest := func(run func()) time.Duration {
+		best := time.Duration(-1)
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			run()
+			if elapsed := time.Since(start); best < 0 || elapsed < best {
+				best = elapsed
+			}
+		}
+		return best
+	}
+
+	known := fastest(func() { passwords.Verify("Abcdefg2", hash) })
+	unknown := fastest(func() { passwords.VerifyUnknownUser("Abcdefg2") })
+
+	if unknown < known/2 {
+		t.Errorf("unknown users take %v and wrong passwords %v", unknown, known)
+	}
+}
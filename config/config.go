@@ -0,0 +1,758 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	StorePostgres = "postgres"
+	StoreMemory   = "memory"
+)
+
+// Key id given to jwt_secret when no keys are configured
+const LegacySecretKeyId = "default"
+
+const (
+	PasswordArgon2id = "argon2id"
+	PasswordBcrypt   = "bcrypt"
+)
+
+const (
+	BrokerLocal    = "local"
+	BrokerPostgres = "postgres"
+)
+
+const (
+	MailSMTP   = "smtp"
+	MailFile   = "file"
+	MailMemory = "memory"
+)
+
+const (
+	RateLimitMemory   = "memory"
+	RateLimitPostgres = "postgres"
+)
+
+type Config struct {
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	Auth          AuthConfig          `yaml:"auth"`
+	Passwords     PasswordsConfig     `yaml:"passwords"`
+	Limits        LimitsConfig        `yaml:"limits"`
+	Timeline      TimelineConfig      `yaml:"timeline"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	RateLimits    RateLimitsConfig    `yaml:"rate_limits"`
+	Logins        LoginsConfig        `yaml:"logins"`
+	Mail          MailConfig          `yaml:"mail"`
+	Accounts      AccountsConfig      `yaml:"accounts"`
+	Moderation    ModerationConfig    `yaml:"moderation"`
+	Trash         TrashConfig         `yaml:"trash"`
+	Audit         AuditConfig         `yaml:"audit"`
+}
+
+type ServerConfig struct {
+	ListenAddress string `yaml:"listen_address"`
+	// Either "postgres" or "memory", the latter loses everything on restart
+	Store string `yaml:"store"`
+}
+
+type DatabaseConfig struct {
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+type AuthConfig struct {
+	// HS256 secret, only used when Keys is empty
+	JWTSecret Secret `yaml:"jwt_secret"`
+	// Every key accepted when verifying tokens, see JWTKeyConfig
+	Keys []JWTKeyConfig `yaml:"keys"`
+	// Id of the key in Keys that signs new tokens
+	SigningKeyId    string        `yaml:"signing_key_id"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+}
+
+/**
+ * A JWT key identified by the `kid` header. HS256 keys use Secret, RS256 and EdDSA keys
+ * use a PEM private key, or only a public key for keys kept just to verify old tokens.
+ */
+type JWTKeyConfig struct {
+	Id             string `yaml:"id"`
+	Algorithm      string `yaml:"algorithm"`
+	Secret         Secret `yaml:"secret"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+type PasswordsConfig struct {
+	// Algorithm used for new hashes, either "argon2id" or "bcrypt"
+	Algorithm     string `yaml:"algorithm"`
+	Argon2Memory  uint32 `yaml:"argon2_memory"`
+	Argon2Time    uint32 `yaml:"argon2_time"`
+	Argon2Threads uint8  `yaml:"argon2_threads"`
+	BcryptCost    int    `yaml:"bcrypt_cost"`
+	// Accepts passwords still stored in plaintext until `hash-passwords` hashes them, off by default
+	AllowPlaintext bool `yaml:"allow_plaintext"`
+}
+
+type LimitsConfig struct {
+	QuestionMinLength    int `yaml:"question_min_length"`
+	QuestionMaxLength    int `yaml:"question_max_length"`
+	ReplyMinLength       int `yaml:"reply_min_length"`
+	ReplyMaxLength       int `yaml:"reply_max_length"`
+	EmailMaxLength       int `yaml:"email_max_length"`
+	PasswordMinLength    int `yaml:"password_min_length"`
+	PostTitleMaxLength   int `yaml:"post_title_max_length"`
+	PostContentMaxLength int `yaml:"post_content_max_length"`
+}
+
+type TimelineConfig struct {
+	// Authors with more followers than this aren't copied to the timelines of their followers,
+	// their content is read when the timeline is requested
+	FanOutThreshold int `yaml:"fan_out_threshold"`
+	// How many recent items of a user are copied to the timeline of a new follower
+	BackfillSize int `yaml:"backfill_size"`
+}
+
+type NotificationsConfig struct {
+	// "local" only delivers live notifications to clients connected to the same instance,
+	// "postgres" uses LISTEN/NOTIFY so every instance gets them
+	Broker string `yaml:"broker"`
+	// Interval of the keep alive messages of the live streams
+	Heartbeat time.Duration `yaml:"heartbeat"`
+}
+
+type RateLimitsConfig struct {
+	// "memory" counts the requests of each instance on its own, "postgres" shares the count between them
+	Backend string `yaml:"backend"`
+	// Takes the client IP from X-Forwarded-For, only safe behind a proxy that sets it
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"`
+	// Per IP
+	Login    RateLimit `yaml:"login"`
+	Register RateLimit `yaml:"register"`
+	// Password reset emails requested from an IP
+	PasswordForgot RateLimit `yaml:"password_forgot"`
+	// Questions sent from an IP, by a logged asker and to a user
+	AskPerIP     RateLimit `yaml:"ask_per_ip"`
+	AskPerUser   RateLimit `yaml:"ask_per_user"`
+	AskPerTarget RateLimit `yaml:"ask_per_target"`
+}
+
+// Allows bursts of Requests that are recovered evenly over Per, zero requests disables the limit
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+}
+
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%d/%s", r.Requests, r.Per)
+}
+
+/**
+ * Failed logins of an account lock it for a while: after FreeAttempts failures each new
+ * one locks it for BackoffBase, doubling every time, and from LockoutAttempts on for
+ * LockoutDuration. The count restarts with a success or after FailureWindow without failures.
+ */
+type LoginsConfig struct {
+	FreeAttempts    int           `yaml:"free_attempts"`
+	BackoffBase     time.Duration `yaml:"backoff_base"`
+	LockoutAttempts int           `yaml:"lockout_attempts"`
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+	FailureWindow   time.Duration `yaml:"failure_window"`
+	// How long the login attempts are kept for the audit of the users
+	AuditRetention time.Duration `yaml:"audit_retention"`
+}
+
+type MailConfig struct {
+	// "smtp" sends the emails, "file" writes them to OutboxDir and "memory" only keeps them in the process
+	Backend      string `yaml:"backend"`
+	From         string `yaml:"from"`
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username"`
+	SMTPPassword Secret `yaml:"smtp_password"`
+	OutboxDir    string `yaml:"outbox_dir"`
+}
+
+type AccountsConfig struct {
+	VerificationTokenTTL time.Duration `yaml:"verification_token_ttl"`
+	ResetTokenTTL        time.Duration `yaml:"reset_token_ttl"`
+	// Minimum time between two emails of the same kind to a user
+	EmailCooldown time.Duration `yaml:"email_cooldown"`
+	// Pages of the frontend linked from the emails, the token is added as the token query param
+	VerifyURL string `yaml:"verify_url"`
+	ResetURL  string `yaml:"reset_url"`
+}
+
+type ModerationConfig struct {
+	// Words and phrases that send content to the review queue, from the list and from a file with one per line
+	Blocklist     []string `yaml:"blocklist"`
+	BlocklistFile string   `yaml:"blocklist_file"`
+	// Service that flags content for review, see moderation.HTTPClassifier. Empty disables it
+	ClassifierURL     string        `yaml:"classifier_url"`
+	ClassifierTimeout time.Duration `yaml:"classifier_timeout"`
+	// How many words each user can mute
+	MaxMutedWords int `yaml:"max_muted_words"`
+}
+
+type TrashConfig struct {
+	// How long deleted questions and posts can be restored before they are purged for good
+	Retention      time.Duration `yaml:"retention"`
+	PurgeInterval  time.Duration `yaml:"purge_interval"`
+	PurgeBatchSize int           `yaml:"purge_batch_size"`
+}
+
+type AuditConfig struct {
+	// Keys the hashes of the audit log chain, it must be kept out of the database
+	HMACKey Secret `yaml:"hmac_key"`
+}
+
+// Secret is a string that never shows its value when printed or logged
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// Hides the password of the DSN when the config is logged
+func (d DatabaseConfig) LogValue() slog.Value {
+	dsn := "[REDACTED]"
+	if parsed, err := url.Parse(d.DSN); err == nil {
+		dsn = parsed.Redacted()
+	}
+
+	return slog.GroupValue(
+		slog.String("dsn", dsn),
+		slog.Int("max_open_conns", d.MaxOpenConns),
+		slog.Int("max_idle_conns", d.MaxIdleConns),
+		slog.Duration("conn_max_lifetime", d.ConnMaxLifetime),
+	)
+}
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			ListenAddress: ":8080",
+			Store:         StorePostgres,
+		},
+		Database: DatabaseConfig{
+			DSN:             "postgresql://preguntamebackenduser@localhost:5432/preguntame?sslmode=disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Passwords: PasswordsConfig{
+			Algorithm:     PasswordArgon2id,
+			Argon2Memory:  64 * 1024,
+			Argon2Time:    3,
+			Argon2Threads: 2,
+			BcryptCost:    12,
+		},
+		Limits: LimitsConfig{
+			QuestionMinLength:    10,
+			QuestionMaxLength:    1000,
+			ReplyMinLength:       10,
+			ReplyMaxLength:       1000,
+			EmailMaxLength:       256,
+			PasswordMinLength:    8,
+			PostTitleMaxLength:   200,
+			PostContentMaxLength: 10000,
+		},
+		Timeline: TimelineConfig{
+			FanOutThreshold: 1000,
+			BackfillSize:    20,
+		},
+		Notifications: NotificationsConfig{
+			Broker:    BrokerLocal,
+			Heartbeat: 30 * time.Second,
+		},
+		Logins: LoginsConfig{
+			FreeAttempts:    3,
+			BackoffBase:     time.Second,
+			LockoutAttempts: 10,
+			LockoutDuration: 15 * time.Minute,
+			FailureWindow:   24 * time.Hour,
+			AuditRetention:  90 * 24 * time.Hour,
+		},
+		Mail: MailConfig{
+			Backend:   MailMemory,
+			From:      "Preguntame <no-reply@localhost>",
+			SMTPPort:  587,
+			OutboxDir: "outbox",
+		},
+		Accounts: AccountsConfig{
+			VerificationTokenTTL: 48 * time.Hour,
+			ResetTokenTTL:        time.Hour,
+			EmailCooldown:        time.Minute,
+			VerifyURL:            "http://localhost:3000/verify",
+			ResetURL:             "http://localhost:3000/reset-password",
+		},
+		Moderation: ModerationConfig{
+			ClassifierTimeout: 2 * time.Second,
+			MaxMutedWords:     200,
+		},
+		Trash: TrashConfig{
+			Retention:      30 * 24 * time.Hour,
+			PurgeInterval:  time.Hour,
+			PurgeBatchSize: 500,
+		},
+		RateLimits: RateLimitsConfig{
+			Backend:        RateLimitMemory,
+			Login:          RateLimit{Requests: 10, Per: time.Minute},
+			Register:       RateLimit{Requests: 5, Per: time.Hour},
+			PasswordForgot: RateLimit{Requests: 5, Per: time.Hour},
+			AskPerIP:       RateLimit{Requests: 20, Per: 10 * time.Minute},
+			AskPerUser:     RateLimit{Requests: 20, Per: 10 * time.Minute},
+			AskPerTarget:   RateLimit{Requests: 200, Per: time.Hour},
+		},
+	}
+}
+
+/**
+ * Builds the configuration from, in increasing order of priority:
+ * the defaults, the YAML file given by -config or PREGUNTAME_CONFIG, the environment and the flags.
+ * Returns the arguments left after the flags, which are the subcommand if any.
+ */
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+	settings := settingsFor(&cfg)
+
+	fs := flag.NewFlagSet("preguntame", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("PREGUNTAME_CONFIG"), "path to a YAML configuration file")
+
+	// Flags are only recorded here, they are applied once the file and the environment were loaded
+	flagValues := map[string]string{}
+	for _, s := range settings {
+		name := s.flag
+		fs.Func(name, s.usage+" (env "+s.env+")", func(value string) error {
+			flagValues[name] = value
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configPath != "" {
+		if err := loadFile(&cfg, *configPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(value); err != nil {
+				return nil, nil, fmt.Errorf("invalid value for %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := flagValues[s.flag]; ok {
+			if err := s.set(value); err != nil {
+				return nil, nil, fmt.Errorf("invalid value for -%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return &cfg, fs.Args(), nil
+}
+
+func loadFile(cfg *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Server.ListenAddress == "" {
+		errs = append(errs, errors.New("server.listen_address is required"))
+	}
+	if c.Server.Store != StorePostgres && c.Server.Store != StoreMemory {
+		errs = append(errs, fmt.Errorf("server.store must be %q or %q", StorePostgres, StoreMemory))
+	}
+
+	if c.Server.Store == StorePostgres {
+		if _, err := url.Parse(c.Database.DSN); err != nil || c.Database.DSN == "" {
+			errs = append(errs, errors.New("database.dsn must be a valid postgres url"))
+		}
+		if c.Database.MaxOpenConns < 1 {
+			errs = append(errs, errors.New("database.max_open_conns must be at least 1"))
+		}
+		if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+			errs = append(errs, errors.New("database.max_idle_conns must be between 0 and database.max_open_conns"))
+		}
+		if c.Database.ConnMaxLifetime < 0 {
+			errs = append(errs, errors.New("database.conn_max_lifetime can't be negative"))
+		}
+	}
+
+	errs = append(errs, c.Auth.validateKeys()...)
+	if c.Auth.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.access_token_ttl must be positive"))
+	}
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		errs = append(errs, errors.New("auth.refresh_token_ttl must be greater than auth.access_token_ttl"))
+	}
+
+	p := c.Passwords
+	if p.Algorithm != PasswordArgon2id && p.Algorithm != PasswordBcrypt {
+		errs = append(errs, fmt.Errorf("passwords.algorithm must be %q or %q", PasswordArgon2id, PasswordBcrypt))
+	}
+	if p.Argon2Memory < 8*uint32(p.Argon2Threads) || p.Argon2Time < 1 || p.Argon2Threads < 1 {
+		errs = append(errs, errors.New("passwords.argon2_time and passwords.argon2_threads must be at least 1 and passwords.argon2_memory at least 8 KiB per thread"))
+	}
+	if p.BcryptCost < 4 || p.BcryptCost > 31 {
+		errs = append(errs, errors.New("passwords.bcrypt_cost must be between 4 and 31"))
+	}
+
+	l := c.Limits
+	if l.QuestionMinLength < 1 || l.QuestionMaxLength < l.QuestionMinLength {
+		errs = append(errs, errors.New("limits.question_min_length must be at least 1 and not greater than limits.question_max_length"))
+	}
+	if l.ReplyMinLength < 1 || l.ReplyMaxLength < l.ReplyMinLength {
+		errs = append(errs, errors.New("limits.reply_min_length must be at least 1 and not greater than limits.reply_max_length"))
+	}
+	if l.EmailMaxLength < 3 {
+		errs = append(errs, errors.New("limits.email_max_length must be at least 3"))
+	}
+	if l.PasswordMinLength < 1 {
+		errs = append(errs, errors.New("limits.password_min_length must be at least 1"))
+	}
+	if l.PostTitleMaxLength < 1 || l.PostContentMaxLength < 1 {
+		errs = append(errs, errors.New("limits.post_title_max_length and limits.post_content_max_length must be at least 1"))
+	}
+
+	if c.Timeline.FanOutThreshold < 0 || c.Timeline.BackfillSize < 0 {
+		errs = append(errs, errors.New("timeline.fan_out_threshold and timeline.backfill_size can't be negative"))
+	}
+
+	if c.Notifications.Broker != BrokerLocal && c.Notifications.Broker != BrokerPostgres {
+		errs = append(errs, fmt.Errorf("notifications.broker must be %q or %q", BrokerLocal, BrokerPostgres))
+	}
+	if c.Notifications.Broker == BrokerPostgres && c.Server.Store != StorePostgres {
+		errs = append(errs, errors.New("notifications.broker can only be postgres with the postgres store"))
+	}
+	if c.Notifications.Heartbeat <= 0 {
+		errs = append(errs, errors.New("notifications.heartbeat must be positive"))
+	}
+
+	r := c.RateLimits
+	if r.Backend != RateLimitMemory && r.Backend != RateLimitPostgres {
+		errs = append(errs, fmt.Errorf("rate_limits.backend must be %q or %q", RateLimitMemory, RateLimitPostgres))
+	}
+	if r.Backend == RateLimitPostgres && c.Server.Store != StorePostgres {
+		errs = append(errs, errors.New("rate_limits.backend can only be postgres with the postgres store"))
+	}
+	limits := map[string]RateLimit{
+		"login": r.Login, "register": r.Register, "password_forgot": r.PasswordForgot, "ask_per_ip": r.AskPerIP, "ask_per_user": r.AskPerUser, "ask_per_target": r.AskPerTarget,
+	}
+	for name, limit := range limits {
+		if limit.Requests < 0 || (limit.Requests > 0 && limit.Per <= 0) {
+			errs = append(errs, fmt.Errorf("rate_limits.%s needs positive requests and per, or zero requests to disable it", name))
+		}
+	}
+
+	g := c.Logins
+	if g.FreeAttempts < 0 || g.LockoutAttempts <= g.FreeAttempts {
+		errs = append(errs, errors.New("logins.free_attempts can't be negative and must be less than logins.lockout_attempts"))
+	}
+	if g.BackoffBase <= 0 || g.LockoutDuration < g.BackoffBase {
+		errs = append(errs, errors.New("logins.backoff_base must be positive and not greater than logins.lockout_duration"))
+	}
+	if g.FailureWindow <= 0 || g.AuditRetention <= 0 {
+		errs = append(errs, errors.New("logins.failure_window and logins.audit_retention must be positive"))
+	}
+
+	m := c.Mail
+	switch m.Backend {
+	case MailSMTP:
+		if m.SMTPHost == "" || m.SMTPPort < 1 || m.SMTPPort > 65535 {
+			errs = append(errs, errors.New("mail.smtp_host and a valid mail.smtp_port are required with the smtp backend"))
+		}
+	case MailFile:
+		if m.OutboxDir == "" {
+			errs = append(errs, errors.New("mail.outbox_dir is required with the file backend"))
+		}
+	case MailMemory:
+	default:
+		errs = append(errs, fmt.Errorf("mail.backend must be %q, %q or %q", MailSMTP, MailFile, MailMemory))
+	}
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		errs = append(errs, errors.New("mail.from must be a valid address"))
+	}
+
+	a := c.Accounts
+	if a.VerificationTokenTTL <= 0 || a.ResetTokenTTL <= 0 || a.EmailCooldown < 0 {
+		errs = append(errs, errors.New("accounts.verification_token_ttl and accounts.reset_token_ttl must be positive and accounts.email_cooldown can't be negative"))
+	}
+	for name, link := range map[string]string{"verify_url": a.VerifyURL, "reset_url": a.ResetURL} {
+		if parsed, err := url.Parse(link); err != nil || !parsed.IsAbs() {
+			errs = append(errs, fmt.Errorf("accounts.%s must be an absolute url", name))
+		}
+	}
+
+	d := c.Moderation
+	if d.ClassifierURL != "" {
+		if parsed, err := url.Parse(d.ClassifierURL); err != nil || !parsed.IsAbs() {
+			errs = append(errs, errors.New("moderation.classifier_url must be an absolute url"))
+		}
+	}
+	if d.ClassifierTimeout <= 0 || d.MaxMutedWords < 0 {
+		errs = append(errs, errors.New("moderation.classifier_timeout must be positive and moderation.max_muted_words can't be negative"))
+	}
+
+	if c.Trash.Retention <= 0 || c.Trash.PurgeInterval <= 0 || c.Trash.PurgeBatchSize < 1 {
+		errs = append(errs, errors.New("trash.retention and trash.purge_interval must be positive and trash.purge_batch_size at least 1"))
+	}
+
+	if len(c.Audit.HMACKey) < 32 {
+		errs = append(errs, errors.New("audit.hmac_key must be at least 32 characters long"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a AuthConfig) validateKeys() []error {
+	var errs []error
+
+	if len(a.Keys) == 0 {
+		if len(a.JWTSecret) < 32 {
+			errs = append(errs, errors.New("auth.jwt_secret must be at least 32 characters long when auth.keys is empty"))
+		}
+		return errs
+	}
+
+	ids := map[string]bool{}
+	for i, key := range a.Keys {
+		if key.Id == "" || ids[key.Id] {
+			errs = append(errs, fmt.Errorf("auth.keys[%d].id must be unique and not empty", i))
+		}
+		ids[key.Id] = true
+
+		switch key.Algorithm {
+		case "HS256":
+			if len(key.Secret) < 32 {
+				errs = append(errs, fmt.Errorf("auth.keys[%d].secret must be at least 32 characters long", i))
+			}
+		case "RS256", "EdDSA":
+			if key.PrivateKeyFile == "" && key.PublicKeyFile == "" {
+				errs = append(errs, fmt.Errorf("auth.keys[%d] needs private_key_file or public_key_file", i))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("auth.keys[%d].algorithm must be HS256, RS256 or EdDSA", i))
+		}
+	}
+
+	if !ids[a.SigningKeyId] {
+		errs = append(errs, errors.New("auth.signing_key_id must be the id of one of auth.keys"))
+	}
+
+	return errs
+}
+
+// A single configuration value that can be set from the environment or a flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(value string) error
+}
+
+func settingsFor(cfg *Config) []setting {
+	return []setting{
+		{"PREGUNTAME_LISTEN_ADDRESS", "listen", "address the http server listens on", setString(&cfg.Server.ListenAddress)},
+		{"PREGUNTAME_STORE", "store", "storage backend, postgres or memory", setString(&cfg.Server.Store)},
+		{"PREGUNTAME_DATABASE_DSN", "database-dsn", "postgres connection url", setString(&cfg.Database.DSN)},
+		{"PREGUNTAME_DATABASE_MAX_OPEN_CONNS", "database-max-open-conns", "maximum number of open connections", setInt(&cfg.Database.MaxOpenConns)},
+		{"PREGUNTAME_DATABASE_MAX_IDLE_CONNS", "database-max-idle-conns", "maximum number of idle connections", setInt(&cfg.Database.MaxIdleConns)},
+		{"PREGUNTAME_DATABASE_CONN_MAX_LIFETIME", "database-conn-max-lifetime", "maximum lifetime of a connection", setDuration(&cfg.Database.ConnMaxLifetime)},
+		{"PREGUNTAME_JWT_SECRET", "jwt-secret", "secret used to sign the jwt", func(value string) error {
+			cfg.Auth.JWTSecret = Secret(value)
+			return nil
+		}},
+		{"PREGUNTAME_JWT_SIGNING_KEY_ID", "jwt-signing-key-id", "id of the key in auth.keys that signs new jwt", setString(&cfg.Auth.SigningKeyId)},
+		{"PREGUNTAME_ACCESS_TOKEN_TTL", "access-token-ttl", "lifetime of the access jwt", setDuration(&cfg.Auth.AccessTokenTTL)},
+		{"PREGUNTAME_REFRESH_TOKEN_TTL", "refresh-token-ttl", "lifetime of the refresh tokens", setDuration(&cfg.Auth.RefreshTokenTTL)},
+		{"PREGUNTAME_PASSWORD_ALGORITHM", "password-algorithm", "algorithm for new password hashes, argon2id or bcrypt", setString(&cfg.Passwords.Algorithm)},
+		{"PREGUNTAME_PASSWORD_ARGON2_MEMORY", "password-argon2-memory", "argon2id memory in KiB", setUint32(&cfg.Passwords.Argon2Memory)},
+		{"PREGUNTAME_PASSWORD_ARGON2_TIME", "password-argon2-time", "argon2id number of iterations", setUint32(&cfg.Passwords.Argon2Time)},
+		{"PREGUNTAME_PASSWORD_ARGON2_THREADS", "password-argon2-threads", "argon2id parallelism", func(value string) error {
+			parsed, err := strconv.ParseUint(value, 10, 8)
+			if err != nil {
+				return err
+			}
+			cfg.Passwords.Argon2Threads = uint8(parsed)
+			return nil
+		}},
+		{"PREGUNTAME_PASSWORD_BCRYPT_COST", "password-bcrypt-cost", "bcrypt cost", setInt(&cfg.Passwords.BcryptCost)},
+		{"PREGUNTAME_PASSWORD_ALLOW_PLAINTEXT", "password-allow-plaintext", "accept passwords still stored in plaintext", setBool(&cfg.Passwords.AllowPlaintext)},
+		{"PREGUNTAME_QUESTION_MIN_LENGTH", "question-min-length", "minimum length of a question", setInt(&cfg.Limits.QuestionMinLength)},
+		{"PREGUNTAME_QUESTION_MAX_LENGTH", "question-max-length", "maximum length of a question", setInt(&cfg.Limits.QuestionMaxLength)},
+		{"PREGUNTAME_REPLY_MIN_LENGTH", "reply-min-length", "minimum length of a reply", setInt(&cfg.Limits.ReplyMinLength)},
+		{"PREGUNTAME_REPLY_MAX_LENGTH", "reply-max-length", "maximum length of a reply", setInt(&cfg.Limits.ReplyMaxLength)},
+		{"PREGUNTAME_EMAIL_MAX_LENGTH", "email-max-length", "maximum length of an email", setInt(&cfg.Limits.EmailMaxLength)},
+		{"PREGUNTAME_PASSWORD_MIN_LENGTH", "password-min-length", "minimum length of a password", setInt(&cfg.Limits.PasswordMinLength)},
+		{"PREGUNTAME_POST_TITLE_MAX_LENGTH", "post-title-max-length", "maximum length of the title of a post", setInt(&cfg.Limits.PostTitleMaxLength)},
+		{"PREGUNTAME_POST_CONTENT_MAX_LENGTH", "post-content-max-length", "maximum length of the content of a post", setInt(&cfg.Limits.PostContentMaxLength)},
+		{"PREGUNTAME_TIMELINE_FAN_OUT_THRESHOLD", "timeline-fan-out-threshold", "followers above which the content of a user is read on demand instead of copied to the timelines", setInt(&cfg.Timeline.FanOutThreshold)},
+		{"PREGUNTAME_TIMELINE_BACKFILL_SIZE", "timeline-backfill-size", "recent items copied to the timeline of a new follower", setInt(&cfg.Timeline.BackfillSize)},
+		{"PREGUNTAME_NOTIFICATIONS_BROKER", "notifications-broker", "pub/sub of the live notifications, local or postgres", setString(&cfg.Notifications.Broker)},
+		{"PREGUNTAME_NOTIFICATIONS_HEARTBEAT", "notifications-heartbeat", "interval of the keep alive messages of the notification streams", setDuration(&cfg.Notifications.Heartbeat)},
+		{"PREGUNTAME_RATE_LIMIT_BACKEND", "rate-limit-backend", "where the rate limit buckets are kept, memory or postgres", setString(&cfg.RateLimits.Backend)},
+		{"PREGUNTAME_RATE_LIMIT_TRUST_FORWARDED_FOR", "rate-limit-trust-forwarded-for", "take the client ip from X-Forwarded-For", setBool(&cfg.RateLimits.TrustForwardedFor)},
+		{"PREGUNTAME_RATE_LIMIT_LOGIN", "rate-limit-login", "login attempts per ip, as requests/period", setRateLimit(&cfg.RateLimits.Login)},
+		{"PREGUNTAME_RATE_LIMIT_REGISTER", "rate-limit-register", "registrations per ip, as requests/period", setRateLimit(&cfg.RateLimits.Register)},
+		{"PREGUNTAME_RATE_LIMIT_PASSWORD_FORGOT", "rate-limit-password-forgot", "password reset emails requested per ip, as requests/period", setRateLimit(&cfg.RateLimits.PasswordForgot)},
+		{"PREGUNTAME_RATE_LIMIT_ASK_PER_IP", "rate-limit-ask-per-ip", "questions sent per ip, as requests/period", setRateLimit(&cfg.RateLimits.AskPerIP)},
+		{"PREGUNTAME_RATE_LIMIT_ASK_PER_USER", "rate-limit-ask-per-user", "questions sent per logged asker, as requests/period", setRateLimit(&cfg.RateLimits.AskPerUser)},
+		{"PREGUNTAME_RATE_LIMIT_ASK_PER_TARGET", "rate-limit-ask-per-target", "questions received per user, as requests/period", setRateLimit(&cfg.RateLimits.AskPerTarget)},
+		{"PREGUNTAME_LOGIN_FREE_ATTEMPTS", "login-free-attempts", "failed logins before an account starts being locked", setInt(&cfg.Logins.FreeAttempts)},
+		{"PREGUNTAME_LOGIN_BACKOFF_BASE", "login-backoff-base", "first lock after the free attempts, it doubles with every failure", setDuration(&cfg.Logins.BackoffBase)},
+		{"PREGUNTAME_LOGIN_LOCKOUT_ATTEMPTS", "login-lockout-attempts", "failed logins that lock an account for the lockout duration", setInt(&cfg.Logins.LockoutAttempts)},
+		{"PREGUNTAME_LOGIN_LOCKOUT_DURATION", "login-lockout-duration", "lock of the accounts that reached the lockout attempts", setDuration(&cfg.Logins.LockoutDuration)},
+		{"PREGUNTAME_LOGIN_FAILURE_WINDOW", "login-failure-window", "time without failures after which they are forgotten", setDuration(&cfg.Logins.FailureWindow)},
+		{"PREGUNTAME_LOGIN_AUDIT_RETENTION", "login-audit-retention", "how long login attempts are kept", setDuration(&cfg.Logins.AuditRetention)},
+		{"PREGUNTAME_MAIL_BACKEND", "mail-backend", "how emails are sent, smtp, file or memory", setString(&cfg.Mail.Backend)},
+		{"PREGUNTAME_MAIL_FROM", "mail-from", "sender of the emails", setString(&cfg.Mail.From)},
+		{"PREGUNTAME_MAIL_SMTP_HOST", "mail-smtp-host", "smtp server", setString(&cfg.Mail.SMTPHost)},
+		{"PREGUNTAME_MAIL_SMTP_PORT", "mail-smtp-port", "smtp port", setInt(&cfg.Mail.SMTPPort)},
+		{"PREGUNTAME_MAIL_SMTP_USERNAME", "mail-smtp-username", "smtp user", setString(&cfg.Mail.SMTPUsername)},
+		{"PREGUNTAME_MAIL_SMTP_PASSWORD", "mail-smtp-password", "smtp password", func(value string) error {
+			cfg.Mail.SMTPPassword = Secret(value)
+			return nil
+		}},
+		{"PREGUNTAME_MAIL_OUTBOX_DIR", "mail-outbox-dir", "directory the file backend writes the emails to", setString(&cfg.Mail.OutboxDir)},
+		{"PREGUNTAME_VERIFICATION_TOKEN_TTL", "verification-token-ttl", "lifetime of the email verification links", setDuration(&cfg.Accounts.VerificationTokenTTL)},
+		{"PREGUNTAME_RESET_TOKEN_TTL", "reset-token-ttl", "lifetime of the password reset links", setDuration(&cfg.Accounts.ResetTokenTTL)},
+		{"PREGUNTAME_EMAIL_COOLDOWN", "email-cooldown", "minimum time between two emails of the same kind to a user", setDuration(&cfg.Accounts.EmailCooldown)},
+		{"PREGUNTAME_VERIFY_URL", "verify-url", "frontend page linked from the verification emails", setString(&cfg.Accounts.VerifyURL)},
+		{"PREGUNTAME_RESET_URL", "reset-url", "frontend page linked from the password reset emails", setString(&cfg.Accounts.ResetURL)},
+		{"PREGUNTAME_MODERATION_BLOCKLIST_FILE", "moderation-blocklist-file", "file with the words that send content to review, one per line", setString(&cfg.Moderation.BlocklistFile)},
+		{"PREGUNTAME_MODERATION_CLASSIFIER_URL", "moderation-classifier-url", "url of the service that flags content for review", setString(&cfg.Moderation.ClassifierURL)},
+		{"PREGUNTAME_MODERATION_CLASSIFIER_TIMEOUT", "moderation-classifier-timeout", "timeout of the requests to the classifier", setDuration(&cfg.Moderation.ClassifierTimeout)},
+		{"PREGUNTAME_MAX_MUTED_WORDS", "max-muted-words", "how many words each user can mute", setInt(&cfg.Moderation.MaxMutedWords)},
+		{"PREGUNTAME_TRASH_RETENTION", "trash-retention", "how long deleted questions and posts can be restored", setDuration(&cfg.Trash.Retention)},
+		{"PREGUNTAME_TRASH_PURGE_INTERVAL", "trash-purge-interval", "how often the expired trash is purged", setDuration(&cfg.Trash.PurgeInterval)},
+		{"PREGUNTAME_TRASH_PURGE_BATCH_SIZE", "trash-purge-batch-size", "rows removed by each statement of the purger", setInt(&cfg.Trash.PurgeBatchSize)},
+		{"PREGUNTAME_AUDIT_HMAC_KEY", "audit-hmac-key", "secret that keys the hashes of the audit log", func(value string) error {
+			cfg.Audit.HMACKey = Secret(value)
+			return nil
+		}},
+	}
+}
+
+func setString(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func setInt(target *int) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setUint32(target *uint32) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		*target = uint32(parsed)
+		return nil
+	}
+}
+
+func setDuration(target *time.Duration) func(string) error {
+	return func(value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setBool(target *bool) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+// Parses limits written as requests/period, like 10/1m
+func setRateLimit(target *RateLimit) func(string) error {
+	return func(value string) error {
+		requests, per, ok := strings.Cut(value, "/")
+		if !ok {
+			return fmt.Errorf("%q must be requests/period, like 10/1m", value)
+		}
+
+		parsedRequests, err := strconv.Atoi(requests)
+		if err != nil {
+			return err
+		}
+		parsedPer, err := time.ParseDuration(per)
+		if err != nil {
+			return err
+		}
+
+		*target = RateLimit{Requests: parsedRequests, Per: parsedPer}
+		return nil
+	}
+}
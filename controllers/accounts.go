@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+)
+
+// How long an email sent after the response can take
+const emailTimeout = 30 * time.Second
+
+type verifyEmailDTO struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type forgotPasswordDTO struct {
+	Email string `json:"email" validate:"required,length=email"`
+}
+
+type resetPasswordDTO struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,length=password,password"`
+}
+
+/**
+ * Endpoint for the link of the verification email
+ */
+func (c *Controller) VerifyEmail(e echo.Context) error {
+	params := verifyEmailDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	err := c.Accounts.VerifyEmail(e.Request().Context(), params.Token)
+	if errors.Is(err, auth.ErrInvalidAccountToken) {
+		return apperrors.BadRequest("Invalid or expired token")
+	}
+	if err != nil {
+		slog.Error("Error verifying email", "error", err)
+		return err
+	}
+
+	return e.String(http.StatusOK, "Email verified successfuly")
+}
+
+/**
+ * Endpoint for sending the verification email again to the logged user
+ */
+func (c *Controller) ResendVerification(e echo.Context) error {
+	ctx := e.Request().Context()
+
+	user, err := c.Users.FindUserById(ctx, auth.CurrentPrincipal(e).UserId)
+	if err != nil {
+		slog.Error("Error searching user in database", "error", err)
+		return err
+	}
+	if user == nil {
+		return apperrors.NotFound("User doesn't exist")
+	}
+
+	err = c.Accounts.SendVerification(ctx, *user)
+	if errors.Is(err, auth.ErrEmailAlreadyVerified) {
+		return apperrors.Conflict("Email already verified")
+	}
+	if errors.Is(err, auth.ErrEmailCooldown) {
+		return apperrors.TooManyRequests("A verification email was sent recently, try again later")
+	}
+	if err != nil {
+		slog.Error("Error sending verification email", "user_id", user.Id, "error", err)
+		return err
+	}
+
+	return e.String(http.StatusOK, "Verification email sent")
+}
+
+/**
+ * Endpoint for asking for a password reset link. It answers the same whether the
+ * email is registered or not, and the email is sent after the response.
+ */
+func (c *Controller) ForgotPassword(e echo.Context) error {
+	params := forgotPasswordDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	c.sendInBackground(e, "password reset", func(ctx context.Context) error {
+		return c.Accounts.ForgotPassword(ctx, params.Email)
+	})
+
+	return e.String(http.StatusAccepted, "If the email is registered a link to reset the password was sent to it")
+}
+
+/**
+ * Endpoint for the link of the password reset email, it logs the user out of every session
+ */
+func (c *Controller) ResetPassword(e echo.Context) error {
+	params := resetPasswordDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	err := c.Accounts.ResetPassword(e.Request().Context(), params.Token, params.Password)
+	if errors.Is(err, auth.ErrInvalidAccountToken) {
+		return apperrors.BadRequest("Invalid or expired token")
+	}
+	if err != nil {
+		slog.Error("Error resetting password", "error", err)
+		return err
+	}
+
+	return e.String(http.StatusOK, "Password changed successfuly")
+}
+
+// Sends an email after the response, so a slow mail server doesn't delay it. Failures are only logged
+func (c *Controller) sendInBackground(e echo.Context, kind string, send func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(e.Request().Context()), emailTimeout)
+
+	go func() {
+		defer cancel()
+		if err := send(ctx); err != nil {
+			slog.Error("Error sending email", "kind", kind, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,475 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+	"github.com/preguntame/preguntame-backend/policy"
+)
+
+// Body shared by the admin actions, the report is optional and links the action to it
+type moderatorNoteDTO struct {
+	ReportId string `json:"report_id" validate:"uuid"`
+	Note     string `json:"note" validate:"max=1000"`
+}
+
+type hideQuestionDTO struct {
+	QuestionId string `param:"question_id" validate:"uuid"`
+	moderatorNoteDTO
+}
+
+type hidePostDTO struct {
+	PostId string `param:"post_id" validate:"uuid"`
+	moderatorNoteDTO
+}
+
+type adminUserDTO struct {
+	UserId string `param:"user_id" validate:"uuid"`
+}
+
+type suspendUserDTO struct {
+	UserId string `param:"user_id" validate:"uuid"`
+	// Null suspends the user until the suspension is lifted
+	Until  *time.Time `json:"until"`
+	Reason string     `json:"reason" validate:"required,max=1000"`
+	moderatorNoteDTO
+}
+
+type unsuspendUserDTO struct {
+	UserId string `param:"user_id" validate:"uuid"`
+	moderatorNoteDTO
+}
+
+type changeRoleDTO struct {
+	UserId string `param:"user_id" validate:"uuid"`
+	Role   string `json:"role" validate:"required,oneof=user moderator admin"`
+	moderatorNoteDTO
+}
+
+type findModeratorActionsDTO struct {
+	ModeratorId string `query:"moderator_id" validate:"uuid"`
+	TargetId    string `query:"target_id" validate:"uuid"`
+	Pagination  pageParams
+}
+
+type userAccountDTO struct {
+	Id            string      `json:"id"`
+	Name          string      `json:"name"`
+	Email         string      `json:"email"`
+	EmailVerified bool        `json:"email_verified"`
+	Role          models.Role `json:"role"`
+	// Null while the user isn't suspended
+	SuspendedAt      *time.Time `json:"suspended_at"`
+	SuspendedUntil   *time.Time `json:"suspended_until"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+}
+
+type moderatorActionDTO struct {
+	Id          string                     `json:"id"`
+	ModeratorId string                     `json:"moderator_id"`
+	Action      models.ModeratorActionKind `json:"action"`
+	TargetKind  models.TargetKind          `json:"target_kind"`
+	TargetId    string                     `json:"target_id"`
+	ReportId    *string                    `json:"report_id"`
+	Note        string                     `json:"note"`
+	CreatedAt   time.Time                  `json:"created_at"`
+}
+
+// Hides the question and its reply from every listing, the search and the timelines
+func (c *Controller) HideQuestion(e echo.Context) error {
+	return c.hideQuestion(e, true)
+}
+
+func (c *Controller) UnhideQuestion(e echo.Context) error {
+	return c.hideQuestion(e, false)
+}
+
+func (c *Controller) hideQuestion(e echo.Context, hide bool) error {
+	params := hideQuestionDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	if err := c.requireReport(e, params.ReportId); err != nil {
+		return err
+	}
+
+	updated, err := c.Questions.UpdateQuestionHidden(e.Request().Context(), params.QuestionId, sql.NullTime{Time: time.Now(), Valid: hide})
+	if err != nil {
+		slog.Error("Error hiding question in db", "error", err)
+		return err
+	}
+
+	if !updated {
+		return apperrors.NotFound("Question doesn't exist")
+	}
+
+	if err := c.recordAction(e, hideAction(hide), models.TargetQuestion, params.QuestionId, params.ReportId, params.Note); err != nil {
+		return err
+	}
+
+	if !hide {
+		return e.String(http.StatusOK, "Question shown successfuly")
+	}
+	return e.String(http.StatusOK, "Question hidden successfuly")
+}
+
+// Hides the post from everyone but its owner
+func (c *Controller) HidePost(e echo.Context) error {
+	return c.hidePost(e, true)
+}
+
+func (c *Controller) UnhidePost(e echo.Context) error {
+	return c.hidePost(e, false)
+}
+
+func (c *Controller) hidePost(e echo.Context, hide bool) error {
+	params := hidePostDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	if err := c.requireReport(e, params.ReportId); err != nil {
+		return err
+	}
+
+	updated, err := c.Posts.UpdatePostHidden(e.Request().Context(), params.PostId, sql.NullTime{Time: time.Now(), Valid: hide})
+	if err != nil {
+		slog.Error("Error hiding post in db", "error", err)
+		return err
+	}
+
+	if !updated {
+		return apperrors.NotFound("Post doesn't exist")
+	}
+
+	if err := c.recordAction(e, hideAction(hide), models.TargetPost, params.PostId, params.ReportId, params.Note); err != nil {
+		return err
+	}
+
+	if !hide {
+		return e.String(http.StatusOK, "Post shown successfuly")
+	}
+	return e.String(http.StatusOK, "Post hidden successfuly")
+}
+
+// Shows the role and the suspension of an account, to triage the reports about it
+func (c *Controller) FindUserAccount(e echo.Context) error {
+	params := adminUserDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	user, err := c.findTargetUser(e, params.UserId)
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(http.StatusOK, userAccountToDto(*user))
+}
+
+/**
+ * Suspends the account until the given date or until the suspension is lifted. The user is
+ * logged out of every session and can't log in meanwhile. Moderators can only suspend users
+ * and admins can also suspend moderators.
+ */
+func (c *Controller) SuspendUser(e echo.Context) error {
+	params := suspendUserDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	end := sql.NullTime{}
+	if params.Until != nil {
+		if !params.Until.After(now) {
+			return apperrors.Validation("The request has invalid fields", apperrors.FieldError{
+				Field:   "until",
+				Code:    "in_the_past",
+				Message: "until must be a future date",
+			})
+		}
+		end = sql.NullTime{Time: *params.Until, Valid: true}
+	}
+
+	if err := c.requireReport(e, params.ReportId); err != nil {
+		return err
+	}
+
+	user, err := c.findTargetUser(e, params.UserId)
+	if err != nil {
+		return err
+	}
+	if !policy.CanSuspend(auth.CurrentPrincipal(e), *user) {
+		return apperrors.Forbidden("Can't act on users with your role or a higher one")
+	}
+
+	ctx := e.Request().Context()
+
+	if _, err := c.Users.SuspendUser(ctx, user.Id, now, end, params.Reason); err != nil {
+		slog.Error("Error suspending user in db", "error", err)
+		return err
+	}
+
+	if err := c.Auth.LogoutAll(ctx, user.Id); err != nil {
+		slog.Error("Error revoking tokens of suspended user", "user_id", user.Id, "error", err)
+		return err
+	}
+
+	note := params.Reason
+	if params.Note != "" {
+		note += "\n" + params.Note
+	}
+	if err := c.recordAction(e, models.ActionSuspend, models.TargetUser, user.Id, params.ReportId, note); err != nil {
+		return err
+	}
+
+	return e.String(http.StatusOK, "User suspended successfuly")
+}
+
+func (c *Controller) UnsuspendUser(e echo.Context) error {
+	params := unsuspendUserDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	if err := c.requireReport(e, params.ReportId); err != nil {
+		return err
+	}
+
+	user, err := c.findTargetUser(e, params.UserId)
+	if err != nil {
+		return err
+	}
+	if !policy.CanSuspend(auth.CurrentPrincipal(e), *user) {
+		return apperrors.Forbidden("Can't act on users with your role or a higher one")
+	}
+
+	unsuspended, err := c.Users.UnsuspendUser(e.Request().Context(), user.Id)
+	if err != nil {
+		slog.Error("Error lifting suspension in db", "error", err)
+		return err
+	}
+
+	if !unsuspended {
+		return apperrors.Conflict("The user isn't suspended")
+	}
+
+	if err := c.recordAction(e, models.ActionUnsuspend, models.TargetUser, user.Id, params.ReportId, params.Note); err != nil {
+		return err
+	}
+
+	return e.String(http.StatusOK, "Suspension lifted successfuly")
+}
+
+/**
+ * Only admins can change roles, and not their own so there is always one left. The sessions
+ * of the user are closed, so their tokens don't keep the old role.
+ */
+func (c *Controller) ChangeRole(e echo.Context) error {
+	params := changeRoleDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	if params.UserId == auth.CurrentPrincipal(e).UserId {
+		return apperrors.BadRequest("Can't change your own role")
+	}
+
+	if err := c.requireReport(e, params.ReportId); err != nil {
+		return err
+	}
+
+	user, err := c.findTargetUser(e, params.UserId)
+	if err != nil {
+		return err
+	}
+	if !policy.CanChangeRole(auth.CurrentPrincipal(e), *user) {
+		return apperrors.Forbidden("You don't have permission to do this")
+	}
+
+	ctx := e.Request().Context()
+	role := models.Role(params.Role)
+
+	if _, err := c.Users.UpdateUserRole(ctx, user.Id, role); err != nil {
+		slog.Error("Error updating role in db", "error", err)
+		return err
+	}
+
+	if err := c.Auth.LogoutAll(ctx, user.Id); err != nil {
+		slog.Error("Error revoking tokens after role change", "user_id", user.Id, "error", err)
+		return err
+	}
+
+	note := fmt.Sprintf("%s -> %s", user.Role, role)
+	if params.Note != "" {
+		note += "\n" + params.Note
+	}
+	if err := c.recordAction(e, models.ActionChangeRole, models.TargetUser, user.Id, params.ReportId, note); err != nil {
+		return err
+	}
+
+	return e.String(http.StatusOK, "Role changed successfuly")
+}
+
+// Lists what the moderators did, the most recent first
+func (c *Controller) FindModeratorActions(e echo.Context) error {
+	params := findModeratorActionsDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	filter := models.ModeratorActionFilter{ModeratorId: params.ModeratorId, TargetId: params.TargetId}
+	actions, err := c.ModeratorActions.FindModeratorActions(e.Request().Context(), filter, page)
+	if err != nil {
+		slog.Error("Error getting moderator actions from db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, actions, models.ModeratorAction.Cursor, moderatorActionToDto))
+}
+
+/**
+ * Records what the logged moderator did and audits it. The action already happened when
+ * this runs, but an action that can't be recorded fails the request. reportId can be empty.
+ */
+func (c *Controller) recordAction(e echo.Context, action models.ModeratorActionKind, kind models.TargetKind, targetId string, reportId string, note string) error {
+	moderatorId := auth.CurrentPrincipal(e).UserId
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		slog.Error("Error generating uuid", "error", err)
+		return err
+	}
+
+	err = c.ModeratorActions.InsertModeratorAction(e.Request().Context(), models.ModeratorAction{
+		Id:           id.String(),
+		ModeratorId:  moderatorId,
+		Action:       action,
+		TargetKind:   kind,
+		TargetId:     targetId,
+		ReportId:     sql.NullString{String: reportId, Valid: reportId != ""},
+		Note:         note,
+		CreationDate: time.Now(),
+	})
+	if err != nil {
+		slog.Error("Error recording moderator action", "action", action, "target_id", targetId, "error", err)
+		return err
+	}
+
+	if err := c.audit(e, moderatorId, models.ModerationAuditAction(action), kind, targetId, nil, map[string]string{"report_id": reportId, "note": note}); err != nil {
+		return err
+	}
+
+	slog.Info("Moderator action", "moderator_id", moderatorId, "action", action, "target_kind", kind, "target_id", targetId)
+	return nil
+}
+
+// Records the action when the logged user acted on content of someone else, as moderators can
+func (c *Controller) recordModeration(e echo.Context, ownerId models.UserID, action models.ModeratorActionKind, kind models.TargetKind, targetId string) error {
+	if ownerId == auth.CurrentPrincipal(e).UserId {
+		return nil
+	}
+
+	return c.recordAction(e, action, kind, targetId, "", "")
+}
+
+// Checks the report linked to an action exists, an empty id is fine
+func (c *Controller) requireReport(e echo.Context, reportId string) error {
+	if reportId == "" {
+		return nil
+	}
+
+	report, err := c.Reports.FindReport(e.Request().Context(), reportId)
+	if err != nil {
+		slog.Error("Error getting report from db", "error", err)
+		return err
+	}
+
+	if report == nil {
+		return apperrors.NotFound("Report doesn't exist")
+	}
+
+	return nil
+}
+
+func (c *Controller) findTargetUser(e echo.Context, userId models.UserID) (*models.User, error) {
+	user, err := c.Users.FindUserById(e.Request().Context(), userId)
+	if err != nil {
+		slog.Error("Error getting user from db", "error", err)
+		return nil, err
+	}
+
+	if user == nil {
+		return nil, apperrors.NotFound("User doesn't exist")
+	}
+
+	return user, nil
+}
+
+func hideAction(hide bool) models.ModeratorActionKind {
+	if hide {
+		return models.ActionHide
+	}
+	return models.ActionUnhide
+}
+
+func userAccountToDto(user models.User) userAccountDTO {
+	response := userAccountDTO{
+		Id:               user.Id,
+		Name:             user.Name,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerificationDate.Valid,
+		Role:             user.Role,
+		SuspensionReason: user.SuspensionReason,
+	}
+
+	if user.IsSuspended(time.Now()) {
+		response.SuspendedAt = &user.SuspensionDate.Time
+		if user.SuspensionEnd.Valid {
+			response.SuspendedUntil = &user.SuspensionEnd.Time
+		}
+	} else {
+		response.SuspensionReason = ""
+	}
+
+	return response
+}
+
+func moderatorActionToDto(action models.ModeratorAction) moderatorActionDTO {
+	response := moderatorActionDTO{
+		Id:          action.Id,
+		ModeratorId: action.ModeratorId,
+		Action:      action.Action,
+		TargetKind:  action.TargetKind,
+		TargetId:    action.TargetId,
+		Note:        action.Note,
+		CreatedAt:   action.CreationDate,
+	}
+
+	if action.ReportId.Valid {
+		response.ReportId = &action.ReportId.String
+	}
+
+	return response
+}
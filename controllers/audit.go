@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+type findAuditEntriesDTO struct {
+	ActorId    string `query:"actor_id" validate:"uuid"`
+	Action     string `query:"action" validate:"max=100"`
+	TargetId   string `query:"target_id" validate:"max=100"`
+	Pagination pageParams
+}
+
+type auditEntryDTO struct {
+	Id         string             `json:"id"`
+	Sequence   int64              `json:"sequence"`
+	ActorId    *string            `json:"actor_id"`
+	Action     models.AuditAction `json:"action"`
+	TargetKind models.TargetKind  `json:"target_kind"`
+	TargetId   string             `json:"target_id"`
+	Before     json.RawMessage    `json:"before"`
+	After      json.RawMessage    `json:"after"`
+	CreatedAt  time.Time          `json:"created_at"`
+	PrevHash   string             `json:"prev_hash"`
+	Hash       string             `json:"hash"`
+}
+
+// Lists the audit log, the most recent first
+func (c *Controller) FindAuditEntries(e echo.Context) error {
+	params := findAuditEntriesDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	filter := models.AuditFilter{
+		ActorId:  params.ActorId,
+		Action:   models.AuditAction(params.Action),
+		TargetId: params.TargetId,
+	}
+	entries, err := c.AuditLog.FindAuditEntries(e.Request().Context(), filter, page)
+	if err != nil {
+		slog.Error("Error getting audit log from db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, entries, models.AuditEntry.Cursor, auditEntryToDto))
+}
+
+/**
+ * Appends an entry to the audit log. actorId is empty for anonymous requests, and before
+ * and after are encoded as JSON, nil meaning there is no snapshot. An action that can't be
+ * audited fails the request, even if it already happened.
+ */
+func (c *Controller) audit(e echo.Context, actorId models.UserID, action models.AuditAction, kind models.TargetKind, targetId string, before any, after any) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		slog.Error("Error generating uuid", "error", err)
+		return err
+	}
+
+	entry := models.AuditEntry{
+		Id:           id.String(),
+		ActorId:      sql.NullString{String: actorId, Valid: actorId != ""},
+		Action:       action,
+		TargetKind:   kind,
+		TargetId:     targetId,
+		CreationDate: time.Now(),
+	}
+	if entry.Before, err = snapshot(before); err != nil {
+		slog.Error("Error encoding audit snapshot", "action", action, "error", err)
+		return err
+	}
+	if entry.After, err = snapshot(after); err != nil {
+		slog.Error("Error encoding audit snapshot", "action", action, "error", err)
+		return err
+	}
+
+	if _, err := c.AuditLog.AppendAuditEntry(e.Request().Context(), entry, c.AuditKey); err != nil {
+		slog.Error("Error appending to the audit log", "action", action, "target_id", targetId, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func snapshot(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(value)
+}
+
+func auditEntryToDto(entry models.AuditEntry) auditEntryDTO {
+	response := auditEntryDTO{
+		Id:         entry.Id,
+		Sequence:   entry.Sequence,
+		Action:     entry.Action,
+		TargetKind: entry.TargetKind,
+		TargetId:   entry.TargetId,
+		Before:     entry.Before,
+		After:      entry.After,
+		CreatedAt:  entry.CreationDate,
+		PrevHash:   entry.PrevHash,
+		Hash:       entry.Hash,
+	}
+
+	if entry.ActorId.Valid {
+		response.ActorId = &entry.ActorId.String
+	}
+
+	return response
+}
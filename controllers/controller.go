@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+	"github.com/preguntame/preguntame-backend/moderation"
+	"github.com/preguntame/preguntame-backend/notifications"
+	"github.com/preguntame/preguntame-backend/timeline"
+	"github.com/preguntame/preguntame-backend/trash"
+)
+
+// Controller holds the dependencies shared by every endpoint.
+// The stores can be backed by Postgres or kept in memory for tests.
+type Controller struct {
+	Users     models.UserStore
+	Questions models.QuestionStore
+	Posts     models.PostStore
+	Follows   models.FollowStore
+	Settings  models.SettingsStore
+	Relations models.RelationStore
+
+	Notifications models.NotificationStore
+	Searcher      models.SearchStore
+	LoginAttempts models.LoginStore
+	Moderation    models.ModerationStore
+	Reports       models.ReportStore
+
+	PostRevisions    models.PostRevisionStore
+	ModeratorActions models.ModeratorActionStore
+	AuditLog         models.AuditStore
+	Trash            models.TrashStore
+	// Keys the hashes of the audit log, see models.AuditEntry
+	AuditKey []byte
+
+	Auth      *auth.Authenticator
+	Passwords *auth.Passwords
+	Logins    *auth.LoginGuard
+	Accounts  *auth.Accounts
+	Timeline  *timeline.Timeline
+	Notifier  *notifications.Notifier
+	Moderator *moderation.Moderator
+	Bin       *trash.Trash
+}
+
+func NewController(
+	store models.Store,
+	authenticator *auth.Authenticator,
+	passwords *auth.Passwords,
+	logins *auth.LoginGuard,
+	accounts *auth.Accounts,
+	timeline *timeline.Timeline,
+	notifier *notifications.Notifier,
+	moderator *moderation.Moderator,
+	bin *trash.Trash,
+	auditKey []byte,
+) *Controller {
+	return &Controller{
+		Users:     store,
+		Questions: store,
+		Posts:     store,
+		Follows:   store,
+		Settings:  store,
+		Relations: store,
+
+		Notifications: store,
+		Searcher:      store,
+		LoginAttempts: store,
+		Moderation:    store,
+		Reports:       store,
+
+		PostRevisions:    store,
+		ModeratorActions: store,
+		AuditLog:         store,
+		Trash:            store,
+		AuditKey:         auditKey,
+
+		Auth:      authenticator,
+		Passwords: passwords,
+		Logins:    logins,
+		Accounts:  accounts,
+		Timeline:  timeline,
+		Notifier:  notifier,
+		Moderator: moderator,
+		Bin:       bin,
+	}
+}
+
+// Binds the request into params and checks its `validate` tags, see validation.Validator
+func bind(e echo.Context, params any) error {
+	if err := e.Bind(params); err != nil {
+		slog.WarnContext(e.Request().Context(), "Error binding to request", "error", err)
+		return err
+	}
+
+	return e.Validate(params)
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type errorResponseDTO struct {
+	Error errorDTO `json:"error"`
+}
+
+type errorDTO struct {
+	Code      apperrors.Code         `json:"code"`
+	Message   string                 `json:"message"`
+	Details   []apperrors.FieldError `json:"details"`
+	RequestId string                 `json:"request_id"`
+}
+
+/**
+ * Echo HTTPErrorHandler that renders every error returned by the endpoints and middlewares
+ * with the same JSON envelope. Unknown errors are logged and hidden behind a generic 500.
+ */
+func ErrorHandler(err error, e echo.Context) {
+	if e.Response().Committed {
+		return
+	}
+
+	appErr := toAppError(err)
+	requestId := e.Response().Header().Get(echo.HeaderXRequestID)
+
+	if appErr.Status() >= http.StatusInternalServerError {
+		slog.ErrorContext(e.Request().Context(), "Unhandled error",
+			"error", err,
+			"request_id", requestId,
+			"method", e.Request().Method,
+			"path", e.Request().URL.Path,
+		)
+	}
+
+	details := appErr.Details
+	if details == nil {
+		details = []apperrors.FieldError{}
+	}
+
+	response := errorResponseDTO{
+		Error: errorDTO{
+			Code:      appErr.Code,
+			Message:   appErr.Message,
+			Details:   details,
+			RequestId: requestId,
+		},
+	}
+
+	if e.Request().Method == http.MethodHead {
+		err = e.NoContent(appErr.Status())
+	} else {
+		err = e.JSON(appErr.Status(), response)
+	}
+	if err != nil {
+		slog.Error("Error writing error response", "error", err)
+	}
+}
+
+// Echo's own errors (binding, unknown routes, ...) are converted by their status code
+func toAppError(err error) *apperrors.Error {
+	var httpErr *echo.HTTPError
+	if !errors.As(err, &httpErr) {
+		return apperrors.From(err)
+	}
+
+	message := http.StatusText(httpErr.Code)
+	if text, ok := httpErr.Message.(string); ok {
+		message = text
+	}
+
+	switch httpErr.Code {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusRequestEntityTooLarge:
+		return &apperrors.Error{Code: apperrors.CodeBadRequest, Message: message, Err: err}
+	case http.StatusUnauthorized:
+		return &apperrors.Error{Code: apperrors.CodeUnauthorized, Message: message, Err: err}
+	case http.StatusForbidden:
+		return &apperrors.Error{Code: apperrors.CodeForbidden, Message: message, Err: err}
+	case http.StatusNotFound:
+		return &apperrors.Error{Code: apperrors.CodeNotFound, Message: message, Err: err}
+	case http.StatusMethodNotAllowed:
+		return &apperrors.Error{Code: apperrors.CodeMethodNotAllowed, Message: message, Err: err}
+	case http.StatusTooManyRequests:
+		return &apperrors.Error{Code: apperrors.CodeTooManyRequests, Message: message, Err: err}
+	}
+
+	return apperrors.Internal(err)
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+type followDTO struct {
+	UserId string `param:"user_id" validate:"uuid"`
+}
+
+type findFollowsDTO struct {
+	UserId     string `param:"user_id" validate:"uuid"`
+	Pagination pageParams
+}
+
+type followEntryDTO struct {
+	Id         string    `json:"id"`
+	Name       string    `json:"name"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type followListDTO struct {
+	pageDTO[followEntryDTO]
+	Count int `json:"count"`
+}
+
+// The logged user follows the user of the path
+func (c *Controller) Follow(e echo.Context) error {
+	params := followDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	if err := c.requireUser(e, params.UserId); err != nil {
+		return err
+	}
+
+	if err := c.checkNotBlocked(e, params.UserId); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	followed, err := c.Timeline.Follow(e.Request().Context(), principal.UserId, params.UserId)
+	if err != nil {
+		slog.Error("Error following user", "error", err)
+		return err
+	}
+
+	if followed {
+		c.notify(e, params.UserId, models.NotificationFollower, principal.UserId, "")
+	}
+
+	return e.String(http.StatusOK, "User followed successfuly")
+}
+
+func (c *Controller) Unfollow(e echo.Context) error {
+	params := followDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	unfollowed, err := c.Timeline.Unfollow(e.Request().Context(), principal.UserId, params.UserId)
+	if err != nil {
+		slog.Error("Error unfollowing user", "error", err)
+		return err
+	}
+
+	if !unfollowed {
+		return apperrors.NotFound("Not following the user")
+	}
+
+	return e.String(http.StatusOK, "User unfollowed successfuly")
+}
+
+func (c *Controller) FindFollowers(e echo.Context) error {
+	return c.findFollows(e, c.Follows.FindFollowers, func(counts models.FollowCounts) int {
+		return counts.Followers
+	})
+}
+
+func (c *Controller) FindFollowing(e echo.Context) error {
+	return c.findFollows(e, c.Follows.FindFollowing, func(counts models.FollowCounts) int {
+		return counts.Following
+	})
+}
+
+type findFollowsFunc func(ctx context.Context, userId models.UserID, page models.Page) ([]models.FollowEntry, error)
+
+func (c *Controller) findFollows(e echo.Context, find findFollowsFunc, count func(models.FollowCounts) int) error {
+	params := findFollowsDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	if err := c.requireUser(e, params.UserId); err != nil {
+		return err
+	}
+
+	ctx := e.Request().Context()
+
+	follows, err := find(ctx, params.UserId, page)
+	if err != nil {
+		slog.Error("Error getting follows from db", "error", err)
+		return err
+	}
+
+	counts, err := c.Follows.CountFollows(ctx, params.UserId)
+	if err != nil {
+		slog.Error("Error counting follows in db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, followListDTO{
+		pageDTO: newPage(e, page, follows, followCursor, followEntryToDto),
+		Count:   count(counts),
+	})
+}
+
+// Returns a not found error when the user doesn't exist
+func (c *Controller) requireUser(e echo.Context, userId models.UserID) error {
+	user, err := c.Users.FindUserById(e.Request().Context(), userId)
+	if err != nil {
+		slog.Error("Error getting user from db", "error", err)
+		return err
+	}
+
+	if user == nil {
+		return apperrors.NotFound("User doesn't exist")
+	}
+
+	return nil
+}
+
+func followEntryToDto(follow models.FollowEntry) followEntryDTO {
+	return followEntryDTO{
+		Id:         follow.UserId,
+		Name:       follow.Name,
+		FollowedAt: follow.CreationDate,
+	}
+}
+
+func followCursor(follow models.FollowEntry) models.Cursor {
+	return models.Cursor{Date: follow.CreationDate, Id: follow.UserId}
+}
@@ -0,0 +1,15 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+/**
+ * Endpoint publishing the public keys that verify our JWT, so other services don't need a shared secret
+ */
+func (c *Controller) JWKS(e echo.Context) error {
+	e.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return e.JSON(http.StatusOK, c.Auth.JWKS())
+}
@@ -0,0 +1,291 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+	"github.com/preguntame/preguntame-backend/moderation"
+)
+
+type findModerationItemsDTO struct {
+	Status     string `query:"status" validate:"oneof=pending approved rejected muted failed"`
+	Pagination pageParams
+}
+
+type reviewModerationItemDTO struct {
+	ItemId string `param:"item_id" validate:"uuid"`
+}
+
+type moderationItemDTO struct {
+	Id        string                  `json:"id"`
+	Kind      models.ModerationKind   `json:"kind"`
+	Status    models.ModerationStatus `json:"status"`
+	UserId    string                  `json:"user_id"`
+	AuthorId  *string                 `json:"author_id"`
+	SubjectId string                  `json:"subject_id"`
+	Title     string                  `json:"title,omitempty"`
+	Content   string                  `json:"content"`
+	Anonymous bool                    `json:"anonymous"`
+	Reasons   []string                `json:"reasons"`
+	CreatedAt time.Time               `json:"created_at"`
+	// Null while pending
+	ReviewedAt *time.Time `json:"reviewed_at"`
+	ReviewerId *string    `json:"reviewer_id"`
+}
+
+// Lists the review queue, or the items already reviewed with another status
+func (c *Controller) FindModerationItems(e echo.Context) error {
+	params := findModerationItemsDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	status := models.ModerationPending
+	if params.Status != "" {
+		status = models.ModerationStatus(params.Status)
+	}
+
+	items, err := c.Moderation.FindModerationItems(e.Request().Context(), status, page)
+	if err != nil {
+		slog.Error("Error getting moderation items from db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, items, models.ModerationItem.Cursor, moderationItemToDto))
+}
+
+/**
+ * Delivers the held content as if it had just been sent. The item is approved first so two
+ * moderators can't deliver it twice, and the approval is taken back when the delivery fails:
+ * the item is marked failed when what it replied to or updated is gone, and goes back to
+ * pending on any other error so it can be approved again.
+ */
+func (c *Controller) ApproveModerationItem(e echo.Context) error {
+	item, err := c.review(e, models.ModerationApproved)
+	if err != nil {
+		return err
+	}
+
+	if err := c.deliver(e, *item); err != nil {
+		status := models.ModerationPending
+		if errors.Is(err, apperrors.ErrConflict) {
+			status = models.ModerationFailed
+		}
+		// Undone even when the client is gone, or the item would stay approved without being delivered
+		ctx := context.WithoutCancel(e.Request().Context())
+		if undoErr := c.Moderation.UndoModerationApproval(ctx, item.Id, status); undoErr != nil {
+			slog.Error("Error undoing moderation approval in db", "item_id", item.Id, "error", undoErr)
+		}
+		slog.Info("Approved moderation item couldn't be delivered", "item_id", item.Id, "status", status)
+		return err
+	}
+	if err := c.recordAction(e, models.ActionApproveContent, models.TargetModerationItem, item.Id, "", ""); err != nil {
+		return err
+	}
+
+	return e.String(http.StatusOK, "Content approved successfuly")
+}
+
+// The held content is never delivered, its author isn't told
+func (c *Controller) RejectModerationItem(e echo.Context) error {
+	item, err := c.review(e, models.ModerationRejected)
+	if err != nil {
+		return err
+	}
+	if err := c.recordAction(e, models.ActionRejectContent, models.TargetModerationItem, item.Id, "", ""); err != nil {
+		return err
+	}
+
+	return e.String(http.StatusOK, "Content rejected successfuly")
+}
+
+// Marks the pending item of the path with the status and returns it
+func (c *Controller) review(e echo.Context, status models.ModerationStatus) (*models.ModerationItem, error) {
+	params := reviewModerationItemDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return nil, err
+	}
+
+	ctx := e.Request().Context()
+	reviewerId := auth.CurrentPrincipal(e).UserId
+
+	reviewed, err := c.Moderation.ReviewModerationItem(ctx, params.ItemId, status, reviewerId, time.Now())
+	if err != nil {
+		slog.Error("Error reviewing moderation item in db", "error", err)
+		return nil, err
+	}
+
+	item, err := c.Moderation.FindModerationItem(ctx, params.ItemId)
+	if err != nil {
+		slog.Error("Error getting moderation item from db", "error", err)
+		return nil, err
+	}
+
+	if item == nil {
+		return nil, apperrors.NotFound("Moderation item doesn't exist")
+	}
+	if !reviewed {
+		return nil, apperrors.Conflict("The item isn't pending review")
+	}
+
+	slog.Info("Moderation item reviewed", "item_id", item.Id, "kind", item.Kind, "status", status, "reviewer_id", reviewerId)
+	return item, nil
+}
+
+/**
+ * Runs the content through the moderator before it's delivered. Held and muted content is
+ * stored with the item filled by the caller and must not be delivered. recipientId is whose
+ * muted words apply, empty when nobody's do.
+ */
+func (c *Controller) screen(e echo.Context, item models.ModerationItem, recipientId models.UserID) (moderation.Action, error) {
+	ctx := e.Request().Context()
+
+	text := item.Content
+	if item.Title != "" {
+		text = item.Title + "\n" + item.Content
+	}
+
+	decision, err := c.Moderator.Screen(ctx, moderation.Content{Kind: string(item.Kind), Text: text, AuthorId: item.AuthorId.String}, recipientId)
+	if err != nil {
+		slog.Error("Error moderating content", "kind", item.Kind, "error", err)
+		return moderation.Allow, err
+	}
+	if decision.Action == moderation.Allow {
+		return moderation.Allow, nil
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		slog.Error("Error generating uuid", "error", err)
+		return moderation.Allow, err
+	}
+
+	item.Id = id.String()
+	item.Status = models.ModerationPending
+	if decision.Action == moderation.Mute {
+		item.Status = models.ModerationMuted
+	}
+	item.Reasons = decision.Reasons
+	item.CreationDate = time.Now()
+
+	if err := c.Moderation.InsertModerationItem(ctx, item); err != nil {
+		slog.Error("Error inserting moderation item into db", "error", err)
+		return moderation.Allow, err
+	}
+
+	slog.Info("Content held by moderation", "item_id", item.Id, "kind", item.Kind, "status", item.Status)
+	return decision.Action, nil
+}
+
+// Delivers approved content the same way as content that was allowed right away
+func (c *Controller) deliver(e echo.Context, item models.ModerationItem) error {
+	ctx := e.Request().Context()
+	now := time.Now()
+
+	switch item.Kind {
+	case models.ModerationQuestion:
+		question := models.Question{
+			Id:           item.SubjectId,
+			UserId:       item.UserId,
+			Message:      item.Content,
+			AskerId:      item.AuthorId,
+			Anonymous:    item.Anonymous,
+			Signature:    item.Signature,
+			CreationDate: now,
+		}
+		if err := c.Questions.InsertQuestion(ctx, question); err != nil {
+			slog.Error("Error inserting approved question into the database", "error", err)
+			return err
+		}
+		c.notifyQuestion(e, question)
+
+	case models.ModerationReply:
+		question, err := c.Questions.FindQuestionById(ctx, item.SubjectId)
+		if err != nil {
+			slog.Error("Error getting question from db", "error", err)
+			return err
+		}
+		replied := false
+		if question != nil {
+			if replied, err = c.reply(e, *question, item.Content); err != nil {
+				return err
+			}
+		}
+		if !replied {
+			return apperrors.Conflict("The question was deleted or answered while the reply was held")
+		}
+
+	case models.ModerationPost:
+		post := models.Post{
+			Id:           item.SubjectId,
+			OwnerId:      item.UserId,
+			Title:        item.Title,
+			Content:      item.Content,
+			CreationDate: now,
+		}
+		if err := c.insertPost(e, post); err != nil {
+			return err
+		}
+
+	case models.ModerationPostUpdate:
+		post, err := c.Posts.FindPostById(ctx, item.UserId, item.SubjectId)
+		if err != nil {
+			slog.Error("Error getting post from db", "error", err)
+			return err
+		}
+		updated := false
+		if post != nil && !post.DeletionDate.Valid {
+			if updated, err = c.updatePost(e, item.AuthorId.String, *post, item.Title, item.Content, models.AuditEditPost); err != nil {
+				return err
+			}
+		}
+		if !updated {
+			return apperrors.Conflict("The post was deleted while the update was held")
+		}
+	}
+
+	return nil
+}
+
+func moderationItemToDto(item models.ModerationItem) moderationItemDTO {
+	response := moderationItemDTO{
+		Id:        item.Id,
+		Kind:      item.Kind,
+		Status:    item.Status,
+		UserId:    item.UserId,
+		SubjectId: item.SubjectId,
+		Title:     item.Title,
+		Content:   item.Content,
+		Anonymous: item.Anonymous,
+		Reasons:   item.Reasons,
+		CreatedAt: item.CreationDate,
+	}
+
+	// Moderators see who asked anonymous questions, that's why the asker is kept
+	if item.AuthorId.Valid {
+		response.AuthorId = &item.AuthorId.String
+	}
+	if item.ReviewDate.Valid {
+		response.ReviewedAt = &item.ReviewDate.Time
+	}
+	if item.ReviewerId.Valid {
+		response.ReviewerId = &item.ReviewerId.String
+	}
+
+	return response
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+	"golang.org/x/net/websocket"
+)
+
+type findNotificationsDTO struct {
+	UnreadOnly bool `query:"unread"`
+	Pagination pageParams
+}
+
+type markNotificationsReadDTO struct {
+	// Empty marks every notification
+	Ids []string `json:"ids"`
+}
+
+type notificationDTO struct {
+	Id        string                  `json:"id"`
+	Kind      models.NotificationKind `json:"kind"`
+	ActorId   *string                 `json:"actor_id"`
+	SubjectId *string                 `json:"subject_id"`
+	CreatedAt time.Time               `json:"created_at"`
+	ReadAt    *time.Time              `json:"read_at"`
+}
+
+type notificationListDTO struct {
+	pageDTO[notificationDTO]
+	UnreadCount int `json:"unread_count"`
+}
+
+// Message of the websocket stream, heartbeats don't carry a notification
+type notificationMessageDTO struct {
+	Event        string           `json:"event"`
+	Notification *notificationDTO `json:"notification,omitempty"`
+}
+
+func (c *Controller) FindNotifications(e echo.Context) error {
+	params := findNotificationsDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	ctx := e.Request().Context()
+	principal := auth.CurrentPrincipal(e)
+
+	notifications, err := c.Notifications.FindNotifications(ctx, principal.UserId, params.UnreadOnly, page)
+	if err != nil {
+		slog.Error("Error getting notifications from db", "error", err)
+		return err
+	}
+
+	unread, err := c.Notifications.CountUnreadNotifications(ctx, principal.UserId)
+	if err != nil {
+		slog.Error("Error counting notifications in db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, notificationListDTO{
+		pageDTO:     newPage(e, page, notifications, notificationCursor, notificationToDto),
+		UnreadCount: unread,
+	})
+}
+
+func (c *Controller) MarkNotificationsRead(e echo.Context) error {
+	params := markNotificationsReadDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	marked, err := c.Notifications.MarkNotificationsRead(e.Request().Context(), principal.UserId, params.Ids, time.Now())
+	if err != nil {
+		slog.Error("Error marking notifications as read in db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, map[string]int{"marked": marked})
+}
+
+// Live notifications of the logged user as Server-Sent Events
+func (c *Controller) StreamNotifications(e echo.Context) error {
+	principal := auth.CurrentPrincipal(e)
+	notifications, unsubscribe := c.Notifier.Subscribe(principal.UserId)
+	defer unsubscribe()
+
+	response := e.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	return c.streamNotifications(e.Request().Context(), principal, notifications, func(notification *models.Notification) error {
+		if notification == nil {
+			_, err := fmt.Fprint(response, ": heartbeat\n\n")
+			response.Flush()
+			return err
+		}
+
+		data, err := json.Marshal(notificationToDto(*notification))
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(response, "id: %s\nevent: notification\ndata: %s\n\n", notification.Id, data)
+		response.Flush()
+		return err
+	})
+}
+
+// Live notifications of the logged user over a WebSocket
+func (c *Controller) NotificationsWebSocket(e echo.Context) error {
+	principal := auth.CurrentPrincipal(e)
+
+	// The origin isn't checked, the connection is authenticated with a token and not with cookies
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		notifications, unsubscribe := c.Notifier.Subscribe(principal.UserId)
+		defer unsubscribe()
+
+		ctx, cancel := context.WithCancel(e.Request().Context())
+		defer cancel()
+
+		// Clients don't send anything, reading only detects when they go away
+		go func() {
+			defer cancel()
+			for {
+				var ignored string
+				if err := websocket.Message.Receive(ws, &ignored); err != nil {
+					return
+				}
+			}
+		}()
+
+		err := c.streamNotifications(ctx, principal, notifications, func(notification *models.Notification) error {
+			if notification == nil {
+				return websocket.JSON.Send(ws, notificationMessageDTO{Event: "heartbeat"})
+			}
+
+			dto := notificationToDto(*notification)
+			return websocket.JSON.Send(ws, notificationMessageDTO{Event: "notification", Notification: &dto})
+		})
+		if err != nil {
+			slog.Debug("Notifications websocket closed", "error", err)
+		}
+	}}
+
+	server.ServeHTTP(e.Response(), e.Request())
+	return nil
+}
+
+/**
+ * Calls send for every notification, and with nil on every heartbeat, until the client leaves.
+ * The stream ends when the access token it was opened with expires, and every heartbeat checks
+ * again that the session wasn't logged out and the user wasn't suspended nor changed role, so
+ * the client has to reconnect with a valid token.
+ */
+func (c *Controller) streamNotifications(ctx context.Context, principal auth.Principal, notifications <-chan models.Notification, send func(*models.Notification) error) error {
+	heartbeat := time.NewTicker(c.Notifier.Heartbeat())
+	defer heartbeat.Stop()
+
+	expiration := time.NewTimer(time.Until(principal.ExpiresAt))
+	defer expiration.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case <-expiration.C:
+			slog.Debug("Notifications stream closed, the token expired", "user_id", principal.UserId)
+			return nil
+
+		case notification, ok := <-notifications:
+			if !ok {
+				return nil
+			}
+			if err := send(&notification); err != nil {
+				return err
+			}
+
+		case <-heartbeat.C:
+			if err := c.Auth.Revalidate(ctx, principal, time.Now()); err != nil {
+				slog.Debug("Notifications stream closed, the principal isn't valid anymore", "user_id", principal.UserId, "error", err)
+				return nil
+			}
+			if err := send(nil); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Stores the notification and publishes it, the action that caused it already happened so a failure is only logged
+func (c *Controller) notify(e echo.Context, userId models.UserID, kind models.NotificationKind, actorId models.UserID, subjectId string) {
+	if err := c.Notifier.Notify(e.Request().Context(), userId, kind, actorId, subjectId); err != nil {
+		slog.Error("Error sending notification", "error", err, "user_id", userId, "kind", kind)
+	}
+}
+
+func notificationToDto(notification models.Notification) notificationDTO {
+	response := notificationDTO{
+		Id:        notification.Id,
+		Kind:      notification.Kind,
+		CreatedAt: notification.CreationDate,
+	}
+
+	if notification.ActorId.Valid {
+		response.ActorId = &notification.ActorId.String
+	}
+	if notification.SubjectId.Valid {
+		response.SubjectId = &notification.SubjectId.String
+	}
+	if notification.ReadDate.Valid {
+		response.ReadAt = &notification.ReadDate.Time
+	}
+
+	return response
+}
+
+func notificationCursor(notification models.Notification) models.Cursor {
+	return models.Cursor{Date: notification.CreationDate, Id: notification.Id}
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// Query params shared by every paginated listing, add it as an untagged field of the DTO of the endpoint
+type pageParams struct {
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit"`
+}
+
+type pageDTO[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+/**
+ * Turns the query params into a page of the store. One more item than the limit is
+ * asked to the store, so newPage knows if there is a next page without counting.
+ */
+func (p pageParams) page() (models.Page, error) {
+	limit := p.Limit
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit < 1 || limit > maxPageLimit {
+		return models.Page{}, apperrors.Validation("The request has invalid fields", apperrors.FieldError{
+			Field:   "limit",
+			Code:    "out_of_range",
+			Message: fmt.Sprintf("limit must be between 1 and %d", maxPageLimit),
+		})
+	}
+
+	page := models.Page{Limit: limit + 1}
+	if p.Cursor == "" {
+		return page, nil
+	}
+
+	cursor, err := decodeCursor(p.Cursor)
+	if err != nil {
+		return models.Page{}, apperrors.Validation("The request has invalid fields", apperrors.FieldError{
+			Field:   "cursor",
+			Code:    "invalid_cursor",
+			Message: "cursor must be a value returned as next_cursor",
+		})
+	}
+	page.After = &cursor
+
+	return page, nil
+}
+
+/**
+ * Builds the response from the items the store returned for page, dropping the extra one.
+ * When there is a next page its cursor is also sent in a Link header.
+ */
+func newPage[I any, T any](e echo.Context, page models.Page, items []I, cursorOf func(I) models.Cursor, toDto func(I) T) pageDTO[T] {
+	response := pageDTO[T]{Items: make([]T, 0, len(items))}
+
+	hasNext := len(items) >= page.Limit
+	if hasNext {
+		items = items[:page.Limit-1]
+	}
+
+	for _, item := range items {
+		response.Items = append(response.Items, toDto(item))
+	}
+
+	if hasNext && len(items) > 0 {
+		next := encodeCursor(cursorOf(items[len(items)-1]))
+		response.NextCursor = &next
+
+		url := *e.Request().URL
+		query := url.Query()
+		query.Set("cursor", next)
+		url.RawQuery = query.Encode()
+		e.Response().Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, url.RequestURI()))
+	}
+
+	return response
+}
+
+// Cursors are opaque to the clients, they shouldn't build or change them
+func encodeCursor(cursor models.Cursor) string {
+	raw := cursor.Date.UTC().Format(time.RFC3339Nano) + "|" + cursor.Id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (models.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return models.Cursor{}, err
+	}
+
+	date, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return models.Cursor{}, fmt.Errorf("malformed cursor")
+	}
+
+	parsed, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return models.Cursor{}, err
+	}
+
+	return models.Cursor{Date: parsed, Id: id}, nil
+}
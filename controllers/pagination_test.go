@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+// Field of the single detail of a validation error, empty when err isn't one
+func invalidField(err error) string {
+	var appErr *apperrors.Error
+	if !errors.As(err, &appErr) || appErr.Code != apperrors.CodeValidation || len(appErr.Details) != 1 {
+		return ""
+	}
+	return appErr.Details[0].Field
+}
+
+func TestCursorsRoundTrip(t *testing.T) {
+	madrid := time.FixedZone("CEST", 2*60*60)
+
+	tests := []struct {
+		name   string
+		cursor models.Cursor
+	}{
+		{"uuid", models.Cursor{Date: time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC), Id: "0d8a3c3e-4b7f-4a57-9f1e-3a8f6f0e5b21"}},
+		{"nanoseconds", models.Cursor{Date: time.Date(2026, 10, 18, 9, 30, 0, 123456789, time.UTC), Id: "a"}},
+		{"other time zone", models.Cursor{Date: time.Date(2026, 10, 18, 11, 30, 0, 0, madrid), Id: "a"}},
+		{"separator in the id", models.Cursor{Date: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Id: "a|b"}},
+		{"zero date", models.Cursor{Id: "a"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := encodeCursor(test.cursor)
+			if strings.ContainsAny(encoded, "+/=") {
+				t.Errorf("cursor %q isn't safe in a url", encoded)
+			}
+
+			decoded, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !decoded.Date.Equal(test.cursor.Date) || decoded.Id != test.cursor.Id {
+				t.Errorf("decoded = %+v, want %+v", decoded, test.cursor)
+			}
+		})
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	valid := encodeCursor(models.Cursor{Date: time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC), Id: "a"})
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name      string
+		params    pageParams
+		wantLimit int
+		wantAfter bool
+		// Field of the validation error, empty when the params are valid
+		wantField string
+	}{
+		{"defaults", pageParams{}, defaultPageLimit + 1, false, ""},
+		{"smallest limit", pageParams{Limit: 1}, 2, false, ""},
+		{"largest limit", pageParams{Limit: maxPageLimit}, maxPageLimit + 1, false, ""},
+		{"limit too big", pageParams{Limit: maxPageLimit + 1}, 0, false, "limit"},
+		{"negative limit", pageParams{Limit: -1}, 0, false, "limit"},
+		{"cursor", pageParams{Cursor: valid, Limit: 5}, 6, true, ""},
+		{"limit checked before the cursor", pageParams{Cursor: "garbage!", Limit: -1}, 0, false, "limit"},
+		{"not base64", pageParams{Cursor: "garbage!"}, 0, false, "cursor"},
+		{"padded base64", pageParams{Cursor: valid + "="}, 0, false, "cursor"},
+		{"standard base64", pageParams{Cursor: base64.StdEncoding.EncodeToString([]byte("2026-10-18T09:30:00Z|a?>"))}, 0, false, "cursor"},
+		{"truncated", pageParams{Cursor: valid[:len(valid)-3]}, 0, false, "cursor"},
+		{"without separator", pageParams{Cursor: encode("2026-10-18T09:30:00Z")}, 0, false, "cursor"},
+		{"without id", pageParams{Cursor: encode("2026-10-18T09:30:00Z|")}, 0, false, "cursor"},
+		{"without date", pageParams{Cursor: encode("|a")}, 0, false, "cursor"},
+		{"date not in RFC 3339", pageParams{Cursor: encode("18/10/2026|a")}, 0, false, "cursor"},
+		{"unix timestamp", pageParams{Cursor: encode("1792315800|a")}, 0, false, "cursor"},
+		{"binary", pageParams{Cursor: encode("\x00\xff\xfe|\x00")}, 0, false, "cursor"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := test.params.page()
+
+			if test.wantField != "" {
+				if field := invalidField(err); field != test.wantField {
+					t.Fatalf("err = %v, want a validation error of %s", err, test.wantField)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Limit != test.wantLimit || (page.After != nil) != test.wantAfter {
+				t.Errorf("page = %+v, want limit %d and after %v", page, test.wantLimit, test.wantAfter)
+			}
+		})
+	}
+}
+
+func TestNewPageDropsTheExtraItem(t *testing.T) {
+	date := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	cursorOf := func(id string) models.Cursor { return models.Cursor{Date: date, Id: id} }
+	toDto := func(id string) string { return id }
+
+	tests := []struct {
+		name       string
+		items      []string
+		wantItems  int
+		wantCursor string
+	}{
+		{"empty", []string{}, 0, ""},
+		{"last page", []string{"a", "b"}, 2, ""},
+		{"one more than the limit", []string{"a", "b", "c", "d"}, 3, "c"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/1/questions?limit=3", nil)
+			rec := httptest.NewRecorder()
+			e := echo.New().NewContext(req, rec)
+
+			response := newPage(e, models.Page{Limit: 4}, test.items, cursorOf, toDto)
+			if len(response.Items) != test.wantItems {
+				t.Errorf("items = %v, want %d", response.Items, test.wantItems)
+			}
+
+			if test.wantCursor == "" {
+				if response.NextCursor != nil || rec.Header().Get("Link") != "" {
+					t.Errorf("next cursor = %v, link = %q, want none", response.NextCursor, rec.Header().Get("Link"))
+				}
+				return
+			}
+
+			if response.NextCursor == nil {
+				t.Fatal("no next cursor")
+			}
+			next, err := decodeCursor(*response.NextCursor)
+			if err != nil || next.Id != test.wantCursor {
+				t.Errorf("next cursor = %+v, err = %v, want the one of %s", next, err, test.wantCursor)
+			}
+
+			link := rec.Header().Get("Link")
+			if !strings.Contains(link, "cursor="+*response.NextCursor) || !strings.Contains(link, "limit=3") || !strings.HasSuffix(link, `rel="next"`) {
+				t.Errorf("link = %q", link)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+	"github.com/preguntame/preguntame-backend/moderation"
+	"github.com/preguntame/preguntame-backend/policy"
+)
+
+type findPostRevisionsDTO struct {
+	UserId     string `param:"user_id" validate:"uuid"`
+	PostId     string `param:"post_id" validate:"uuid"`
+	Pagination pageParams
+}
+
+type restorePostRevisionDTO struct {
+	UserId string `param:"user_id" validate:"uuid"`
+	PostId string `param:"post_id" validate:"uuid"`
+	Number int    `param:"number"`
+}
+
+type postRevisionDTO struct {
+	Number     int       `json:"number"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+	Redacted   bool      `json:"redacted"`
+}
+
+/**
+ * Lists the previous versions of a post to everyone who can see it, the most recent first.
+ * Versions a moderator edited out are listed without their title and content, only
+ * moderators can still read them.
+ */
+func (c *Controller) FindPostRevisions(e echo.Context) error {
+	params := findPostRevisionsDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	if err := c.checkNotBlocked(e, params.UserId); err != nil {
+		return err
+	}
+
+	ctx := e.Request().Context()
+
+	post, err := c.Posts.FindPostById(ctx, params.UserId, params.PostId)
+	if err != nil {
+		slog.Error("Error getting post from db", "error", err)
+		return err
+	}
+
+	viewer, _ := auth.PrincipalFrom(e)
+	if post == nil || !policy.CanViewPost(viewer, *post) {
+		return apperrors.NotFound("Post doesn't exist")
+	}
+
+	revisions, err := c.PostRevisions.FindPostRevisions(ctx, post.Id, page)
+	if err != nil {
+		slog.Error("Error getting post revisions from db", "error", err)
+		return err
+	}
+
+	showRedacted := policy.Allowed(viewer, policy.ViewHiddenContent, "")
+	toDto := func(revision models.PostRevision) postRevisionDTO {
+		response := postRevisionToDto(revision)
+		if revision.Redacted && !showRedacted {
+			response.Title = ""
+			response.Content = ""
+		}
+		return response
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, revisions, models.PostRevision.Cursor, toDto))
+}
+
+/**
+ * Brings back the title and content of a previous version. It counts as an edit, so the
+ * version being replaced is kept as a new revision and nothing is lost, and it's screened
+ * like one. Versions a moderator edited out can't be brought back.
+ */
+func (c *Controller) RestorePostRevision(e echo.Context) error {
+	params := restorePostRevisionDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	post, err := c.findPost(e, params.UserId, params.PostId)
+	if err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+
+	revision, err := c.PostRevisions.FindPostRevision(e.Request().Context(), post.Id, params.Number)
+	if err != nil {
+		slog.Error("Error getting post revision from db", "error", err)
+		return err
+	}
+	if revision == nil {
+		return apperrors.NotFound("Revision doesn't exist")
+	}
+	if revision.Redacted {
+		return apperrors.Forbidden("The revision was removed by a moderator")
+	}
+
+	action, err := c.screen(e, models.ModerationItem{
+		Kind:      models.ModerationPostUpdate,
+		UserId:    post.OwnerId,
+		AuthorId:  sql.NullString{String: principal.UserId, Valid: true},
+		SubjectId: post.Id,
+		Title:     revision.Title,
+		Content:   revision.Content,
+	}, "")
+	if err != nil {
+		return err
+	}
+	if action != moderation.Allow {
+		return e.String(http.StatusAccepted, "Post restore held for review, it will be applied once approved")
+	}
+
+	updated, err := c.updatePost(e, principal.UserId, *post, revision.Title, revision.Content, models.AuditRestorePost)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return apperrors.NotFound("Post doesn't exist")
+	}
+
+	return e.String(http.StatusOK, "Post restored successfuly")
+}
+
+func postRevisionToDto(revision models.PostRevision) postRevisionDTO {
+	return postRevisionDTO{
+		Number:     revision.Number,
+		Title:      revision.Title,
+		Content:    revision.Content,
+		CreatedAt:  revision.CreationDate,
+		ReplacedAt: revision.ReplacementDate,
+		Redacted:   revision.Redacted,
+	}
+}
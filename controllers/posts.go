@@ -8,55 +8,120 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
 	"github.com/preguntame/preguntame-backend/auth"
 	"github.com/preguntame/preguntame-backend/models"
+	"github.com/preguntame/preguntame-backend/moderation"
+	"github.com/preguntame/preguntame-backend/policy"
 )
 
+type findPostsDTO struct {
+	UserId     string `param:"user_id" validate:"uuid"`
+	Pagination pageParams
+}
+
+type findPostDTO struct {
+	UserId string `param:"user_id" validate:"uuid"`
+	PostId string `param:"post_id" validate:"uuid"`
+}
+
+type postDTO struct {
+	Id        string     `json:"id"`
+	OwnerId   string     `json:"owner_id"`
+	Title     string     `json:"title"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Only the owner sees hidden posts
+	HiddenAt *time.Time `json:"hidden_at,omitempty"`
+	// Null until the post is edited for the first time
+	EditedAt  *time.Time `json:"edited_at"`
+	EditCount int        `json:"edit_count"`
+}
+
 type createPostDTO struct {
-	OwnerId string `param:"user_id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
+	OwnerId string `param:"user_id" validate:"uuid"`
+	Title   string `json:"title" validate:"required,length=post_title"`
+	Content string `json:"content" validate:"required,length=post_content"`
 }
 
 type modifyPostDTO struct {
-	OwnerId string `param:"user_id"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	PostId  string `param:"post_id"`
+	OwnerId string `param:"user_id" validate:"uuid"`
+	Title   string `json:"title" validate:"required,length=post_title"`
+	Content string `json:"content" validate:"required,length=post_content"`
+	PostId  string `param:"post_id" validate:"uuid"`
 }
 
 type deletePostDTO struct {
-	PostId string `param:"post_id"`
-	UserId string `param:"user_id"`
+	PostId string `param:"post_id" validate:"uuid"`
+	UserId string `param:"user_id" validate:"uuid"`
 }
 
-func CreatePost(e echo.Context) error {
-	params := createPostDTO{}
+// Soft deleted and hidden posts are only listed to their owner and the moderators
+func (c *Controller) FindPostsForUser(e echo.Context) error {
+	params := findPostsDTO{}
 
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding to request", "error", err)
+	if err := bind(e, &params); err != nil {
 		return err
 	}
 
-	uuid, err := uuid.NewUUID()
+	page, err := params.Pagination.page()
 	if err != nil {
-		slog.Error("Error generating uuid", "error", err)
 		return err
 	}
 
-	loggedUser, err := auth.DecodeUserToken(e)
+	if err := c.checkNotBlocked(e, params.UserId); err != nil {
+		return err
+	}
+
+	viewer, _ := auth.PrincipalFrom(e)
+	includeHidden := policy.Allowed(viewer, policy.ViewHiddenContent, params.UserId)
+
+	posts, err := c.Posts.FindPostsByOwnerId(e.Request().Context(), params.UserId, includeHidden, page)
 	if err != nil {
-		slog.Warn("Invalid/Missing jwt", "error", err)
-		return e.String(http.StatusUnauthorized, "Invalid/Missing jwt")
+		slog.Error("Error getting posts from db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, posts, postCursor, postToDto))
+}
+
+func (c *Controller) FindPost(e echo.Context) error {
+	params := findPostDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	if err := c.checkNotBlocked(e, params.UserId); err != nil {
+		return err
 	}
 
-	if loggedUser.Id != params.OwnerId {
-		slog.Warn(
-			"Can't post in another's feed",
-			"logged_user", loggedUser,
-			"user_id", params.OwnerId,
-		)
-		return e.String(http.StatusForbidden, "Can't post in another's feed")
+	post, err := c.Posts.FindPostById(e.Request().Context(), params.UserId, params.PostId)
+	if err != nil {
+		slog.Error("Error getting post from db", "error", err)
+		return err
+	}
+
+	viewer, _ := auth.PrincipalFrom(e)
+	if post == nil || !policy.CanViewPost(viewer, *post) {
+		return apperrors.NotFound("Post doesn't exist")
+	}
+
+	return e.JSON(http.StatusOK, postToDto(*post))
+}
+
+func (c *Controller) CreatePost(e echo.Context) error {
+	params := createPostDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	uuid, err := uuid.NewUUID()
+	if err != nil {
+		slog.Error("Error generating uuid", "error", err)
+		return err
 	}
 
 	post := models.Post{
@@ -68,86 +133,199 @@ func CreatePost(e echo.Context) error {
 		DeletionDate: sql.NullTime{Valid: false},
 	}
 
-	err = models.InsertPost(post)
+	action, err := c.screen(e, models.ModerationItem{
+		Kind:      models.ModerationPost,
+		UserId:    post.OwnerId,
+		AuthorId:  sql.NullString{String: post.OwnerId, Valid: true},
+		SubjectId: post.Id,
+		Title:     post.Title,
+		Content:   post.Content,
+	}, "")
 	if err != nil {
-		slog.Error("Error inserting post into the database", "error", err)
+		return err
+	}
+	if action != moderation.Allow {
+		return e.String(http.StatusAccepted, "Post held for review, it will be published once approved")
+	}
+
+	if err := c.insertPost(e, post); err != nil {
 		return err
 	}
 
 	return e.String(http.StatusOK, "Post added successfuly")
 }
 
-func ModifyPosts(e echo.Context) error {
+// Stores the post and publishes it to the timelines
+func (c *Controller) insertPost(e echo.Context, post models.Post) error {
+	err := c.Posts.InsertPost(e.Request().Context(), post)
+	if err != nil {
+		slog.Error("Error inserting post into the database", "error", err)
+		return err
+	}
+
+	c.publish(e, models.TimelineEntry{
+		ItemId:   post.Id,
+		Kind:     models.TimelinePost,
+		AuthorId: post.OwnerId,
+		Date:     post.CreationDate,
+	})
+
+	return nil
+}
+
+func (c *Controller) ModifyPosts(e echo.Context) error {
 	params := modifyPostDTO{}
 
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding to request", "error", err)
+	if err := bind(e, &params); err != nil {
 		return err
 	}
-	loggedUser, err := auth.DecodeUserToken(e)
+
+	// The post keeps its current content while the update is held
+	post, err := c.findPost(e, params.OwnerId, params.PostId)
 	if err != nil {
-		slog.Warn("Invalid/Missing jwt", "error", err)
-		return e.String(http.StatusUnauthorized, "Invalid/Missing jwt")
+		return err
 	}
 
-	if loggedUser.Id != params.OwnerId {
-		slog.Warn(
-			"Can't modify another's post",
-			"logged_user", loggedUser,
-			"user_id", params.OwnerId,
-		)
-		return e.String(http.StatusForbidden, "Can't modify another's post")
+	principal := auth.CurrentPrincipal(e)
+
+	action, err := c.screen(e, models.ModerationItem{
+		Kind:      models.ModerationPostUpdate,
+		UserId:    params.OwnerId,
+		AuthorId:  sql.NullString{String: principal.UserId, Valid: true},
+		SubjectId: params.PostId,
+		Title:     params.Title,
+		Content:   params.Content,
+	}, "")
+	if err != nil {
+		return err
+	}
+	if action != moderation.Allow {
+		return e.String(http.StatusAccepted, "Post update held for review, it will be applied once approved")
 	}
 
-	updated, err := models.UpdatePost(params.OwnerId, params.PostId, params.Content, params.Title)
+	updated, err := c.updatePost(e, principal.UserId, *post, params.Title, params.Content, models.AuditEditPost)
 	if err != nil {
-		slog.Error("Error updating post in database", "error", err)
 		return err
 	}
 
 	if !updated {
 		slog.Warn("Tried to modify non existing post", "user_id", params.OwnerId, "post_id", params.PostId)
-		return e.String(http.StatusBadRequest, "Post doesn't exists")
+		return apperrors.NotFound("Post doesn't exist")
+	}
+
+	if err := c.recordModeration(e, post.OwnerId, models.ActionEdit, models.TargetPost, post.Id); err != nil {
+		return err
 	}
 
 	return e.String(http.StatusOK, "Post updated successfuly")
 
 }
 
-func DeletePosts(e echo.Context) error {
+func (c *Controller) DeletePosts(e echo.Context) error {
 	params := deletePostDTO{}
 
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding to request", "error", err)
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	post, err := c.findPost(e, params.UserId, params.PostId)
+	if err != nil {
 		return err
 	}
+	principal := auth.CurrentPrincipal(e)
 
-	loggedUser, err := auth.DecodeUserToken(e)
+	deletionDate := time.Now()
+	updated, err := c.Posts.SoftDeletePost(e.Request().Context(), post.OwnerId, post.Id, principal.UserId, deletionDate)
 	if err != nil {
-		slog.Warn("Invalid/Missing jwt", "error", err)
-		return e.String(http.StatusUnauthorized, "Invalid/Missing jwt")
+		slog.Error("Error deleting post in database", "error", err)
+		return err
 	}
 
-	if loggedUser.Id != params.UserId {
-		slog.Warn(
-			"Can't delete another's post",
-			"logged_user", loggedUser,
-			"user_id", params.UserId,
-			"post_id", params.PostId,
-		)
+	if !updated {
+		return apperrors.NotFound("Post doesn't exist")
+	}
 
-		return e.String(http.StatusForbidden, "Can't delete another's post")
+	deleted := *post
+	deleted.DeletionDate = sql.NullTime{Time: deletionDate, Valid: true}
+	deleted.DeleterId = sql.NullString{String: principal.UserId, Valid: true}
+	if err := c.audit(e, principal.UserId, models.AuditDeletePost, models.TargetPost, post.Id, postToDto(*post), postToDto(deleted)); err != nil {
+		return err
+	}
+	if err := c.recordModeration(e, post.OwnerId, models.ActionDelete, models.TargetPost, post.Id); err != nil {
+		return err
 	}
 
-	updated, err := models.SoftDeletePost(params.UserId, params.PostId, time.Now())
+	return e.String(http.StatusOK, "Post deleted successfuly")
+}
+
+// Changes the title and content of the post on behalf of actorId, false when it was deleted
+func (c *Controller) updatePost(e echo.Context, actorId models.UserID, post models.Post, title string, content string, action models.AuditAction) (bool, error) {
+	editDate := time.Now()
+	updated, err := c.Posts.UpdatePost(e.Request().Context(), post.OwnerId, post.Id, content, title, actorId, editDate)
 	if err != nil {
-		slog.Error("Error deleting post in database", "error", err)
-		return e.String(http.StatusInternalServerError, "Error deleting post in database")
+		slog.Error("Error updating post in database", "error", err)
+		return false, err
 	}
 
 	if !updated {
-		return e.String(http.StatusBadRequest, "Invalid post or user")
+		return false, nil
 	}
 
-	return e.String(http.StatusOK, "Post deleted successfuly")
+	edited := post
+	edited.Title = title
+	edited.Content = content
+	edited.EditDate = sql.NullTime{Time: editDate, Valid: true}
+	edited.EditCount++
+	if err := c.audit(e, actorId, action, models.TargetPost, post.Id, postToDto(post), postToDto(edited)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Returns the post of the path, 404 when it doesn't exist or was deleted
+func (c *Controller) findPost(e echo.Context, ownerId models.UserID, postId models.PostID) (*models.Post, error) {
+	post, err := c.Posts.FindPostById(e.Request().Context(), ownerId, postId)
+	if err != nil {
+		slog.Error("Error getting post from db", "error", err)
+		return nil, err
+	}
+
+	if post == nil || post.DeletionDate.Valid {
+		slog.Warn("Tried to modify non existing post", "user_id", ownerId, "post_id", postId)
+		return nil, apperrors.NotFound("Post doesn't exist")
+	}
+
+	return post, nil
+}
+
+func postToDto(post models.Post) postDTO {
+	var deletedAt *time.Time = nil
+	if post.DeletionDate.Valid {
+		deletedAt = &post.DeletionDate.Time
+	}
+	var hiddenAt *time.Time = nil
+	if post.HiddenDate.Valid {
+		hiddenAt = &post.HiddenDate.Time
+	}
+	var editedAt *time.Time = nil
+	if post.EditDate.Valid {
+		editedAt = &post.EditDate.Time
+	}
+
+	return postDTO{
+		Id:        post.Id,
+		OwnerId:   post.OwnerId,
+		Title:     post.Title,
+		Content:   post.Content,
+		CreatedAt: post.CreationDate,
+		DeletedAt: deletedAt,
+		HiddenAt:  hiddenAt,
+		EditedAt:  editedAt,
+		EditCount: post.EditCount,
+	}
+}
+
+func postCursor(post models.Post) models.Cursor {
+	return models.Cursor{Date: post.CreationDate, Id: post.Id}
 }
@@ -4,73 +4,105 @@ import (
 	"database/sql"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
 	"github.com/preguntame/preguntame-backend/auth"
 	"github.com/preguntame/preguntame-backend/models"
+	"github.com/preguntame/preguntame-backend/moderation"
 )
 
 type findQuestionsDTO struct {
-	UserId string `param:"user_id"`
+	UserId     string `param:"user_id" validate:"uuid"`
+	Filter     string `query:"filter" validate:"oneof=all answered unanswered favourite"`
+	Pagination pageParams
 }
 
 type askQuestionDTO struct {
-	UserId    string `param:"user_id"`
-	Message   string `json:"message"`
-	Signature string `json:"signature"`
+	UserId  string `param:"user_id" validate:"uuid"`
+	Message string `json:"message" validate:"required,length=question"`
+	// Questions are anonymous unless the logged asker sets it to false
+	Anonymous *bool `json:"anonymous"`
 }
 
 type replyQuestionDTO struct {
-	UserId     string `param:"user_id"`
-	QuestionId string `param:"question_id"`
-	Message    string `json:"message"`
+	UserId     string `param:"user_id" validate:"uuid"`
+	QuestionId string `param:"question_id" validate:"uuid"`
+	Message    string `json:"message" validate:"required,length=reply"`
 }
 
 type questionDTO struct {
-	Id      string  `json:"id"`
-	Message string  `json:"message"`
-	Reply   *string `json:"reply"`
+	Id         string     `json:"id"`
+	Message    string     `json:"message"`
+	Reply      *string    `json:"reply"`
+	CreatedAt  time.Time  `json:"created_at"`
+	AnsweredAt *time.Time `json:"answered_at"`
+	// Null for anonymous questions
+	Asker *askerDTO `json:"asker"`
+}
+
+type askerDTO struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
 }
 
 type favouriteDTO struct {
-	UserId     string `param:"user_id"`
-	QuestionId string `param:"question_id"`
+	UserId     string `param:"user_id" validate:"uuid"`
+	QuestionId string `param:"question_id" validate:"uuid"`
 }
 
 type deleteDTO struct {
-	QuestionId string `param:"question_id"`
-	UserId     string `param:"user_id"`
+	QuestionId string `param:"question_id" validate:"uuid"`
+	UserId     string `param:"user_id" validate:"uuid"`
 }
 
-func FindQuestionsForUser(e echo.Context) error {
+func (c *Controller) FindQuestionsForUser(e echo.Context) error {
 	params := findQuestionsDTO{}
 
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding to request", "error", err)
+	if err := bind(e, &params); err != nil {
 		return err
 	}
 
-	questions, err := models.FindQuestionsByUserId(params.UserId)
+	page, err := params.Pagination.page()
 	if err != nil {
-		slog.Error("Error getting questions from db", "error", err)
 		return err
 	}
 
-	response := make([]questionDTO, len(questions))
+	if err := c.checkNotBlocked(e, params.UserId); err != nil {
+		return err
+	}
 
-	for i, question := range questions {
-		response[i] = questionToDto(question)
+	filter := models.QuestionsAll
+	if params.Filter != "" {
+		filter = models.QuestionFilter(params.Filter)
 	}
 
-	return e.JSON(http.StatusOK, response)
+	questions, err := c.Questions.FindQuestionsByUserId(e.Request().Context(), params.UserId, filter, page)
+	if err != nil {
+		slog.Error("Error getting questions from db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, questions, questionCursor, questionToDto))
 }
 
-func AskQuestionToUser(e echo.Context) error {
+func (c *Controller) AskQuestionToUser(e echo.Context) error {
 	params := askQuestionDTO{}
 
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding to request", "error", err)
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal, loggedIn := auth.PrincipalFrom(e)
+	anonymous := params.Anonymous == nil || *params.Anonymous
+
+	if !loggedIn && !anonymous {
+		return apperrors.Unauthorized("Log in to sign a question")
+	}
+
+	if err := c.checkQuestionSettings(e, params.UserId, principal, loggedIn, anonymous); err != nil {
 		return err
 	}
 
@@ -80,171 +112,305 @@ func AskQuestionToUser(e echo.Context) error {
 		return err
 	}
 
-	if len(params.Message) < 10 {
-		slog.Info("Length of questions must be greater or equals than 10", "question", params.Message)
-		return e.String(http.StatusBadRequest, "Length of questions must be greater or equals than 10")
+	question := models.Question{
+		Id:           uuid.String(),
+		UserId:       params.UserId,
+		Message:      params.Message,
+		Reply:        sql.NullString{Valid: false},
+		Favourite:    false,
+		Anonymous:    anonymous,
+		CreationDate: time.Now(),
 	}
 
-	if len(params.Message) > 1000 {
-		slog.Info("The length of questions must be less or equal than 1000", "question", params.Message)
-		return e.String(http.StatusBadRequest, "The length of questions must be less or equal than 1000")
+	if loggedIn {
+		question.AskerId = sql.NullString{String: principal.UserId, Valid: true}
 	}
-
-	signature := sql.NullString{Valid: false}
-
-	if params.Signature != "" {
-		signature.Valid = true
-		signature.String = params.Signature
+	if !anonymous {
+		question.Signature = sql.NullString{String: principal.Name, Valid: true}
 	}
 
-	question := models.Question{
-		Id:        uuid.String(),
-		UserId:    params.UserId,
-		Message:   params.Message,
-		Reply:     sql.NullString{Valid: false},
-		Favourite: false,
-		Signature: signature,
+	action, err := c.screen(e, models.ModerationItem{
+		Kind:      models.ModerationQuestion,
+		UserId:    question.UserId,
+		AuthorId:  question.AskerId,
+		SubjectId: question.Id,
+		Content:   question.Message,
+		Anonymous: question.Anonymous,
+		Signature: question.Signature,
+	}, question.UserId)
+	if err != nil {
+		return err
+	}
+	if action == moderation.Hold {
+		return e.String(http.StatusAccepted, "Question held for review, it will be delivered once approved")
+	}
+	// The asker isn't told the recipient muted the words of the question
+	if action == moderation.Mute {
+		return e.String(http.StatusOK, "Question asked successfuly")
 	}
 
-	err = models.InsertQuestion(question)
+	err = c.Questions.InsertQuestion(e.Request().Context(), question)
 	if err != nil {
 		slog.Error("Error inserting question into the database", "error", err)
 		return err
 	}
 
+	c.notifyQuestion(e, question)
+
 	return e.String(http.StatusOK, "Question asked successfuly")
 }
 
-func ReplyQuestionToUser(e echo.Context) error {
-	params := replyQuestionDTO{}
+// Tells the recipient about a new question
+func (c *Controller) notifyQuestion(e echo.Context, question models.Question) {
+	actorId := ""
+	if !question.Anonymous {
+		actorId = question.AskerId.String
+	}
 
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding to request", "error", err)
-		return err
+	// The notifier can't see who asked anonymously, so muted askers are checked here
+	if question.Anonymous && question.AskerId.Valid && c.isMuted(e, question.UserId, question.AskerId.String) {
+		return
 	}
 
-	loggedUser, err := auth.DecodeUserToken(e)
+	c.notify(e, question.UserId, models.NotificationQuestion, actorId, question.Id)
+}
+
+// Rejects the question when the recipient doesn't accept it
+func (c *Controller) checkQuestionSettings(e echo.Context, recipientId models.UserID, asker auth.Principal, loggedIn bool, anonymous bool) error {
+	ctx := e.Request().Context()
+
+	settings, err := c.Settings.FindQuestionSettings(ctx, recipientId)
 	if err != nil {
-		slog.Warn("Invalid/Missing jwt", "error", err)
-		return e.String(http.StatusUnauthorized, "Invalid/Missing jwt")
+		slog.Error("Error getting question settings from db", "error", err)
+		return err
+	}
+	if settings == nil {
+		return apperrors.NotFound("User doesn't exist")
 	}
 
-	if len(params.Message) < 10 {
-		slog.Info("Length of reply must be greater or equals than 10", "question", params.Message)
-		return e.String(http.StatusBadRequest, "Length of reply must be greater or equals than 10")
+	if loggedIn {
+		if err := c.checkNotBlocked(e, recipientId); err != nil {
+			return err
+		}
 	}
 
-	if len(params.Message) > 1000 {
-		slog.Info("The length of reply must be less or equal than 1000", "question", params.Message)
-		return e.String(http.StatusBadRequest, "The length of reply must be less or equal than 1000")
+	if anonymous && !settings.AllowAnonymous {
+		return apperrors.Forbidden("The user doesn't accept anonymous questions")
 	}
 
-	if loggedUser.Id != params.UserId {
-		slog.Warn(
-			"Can't reply another's question",
-			"logged_user", loggedUser,
-			"user_id", params.UserId,
-			"question_id", params.QuestionId,
-		)
-		return e.String(http.StatusForbidden, "Can't reply another's question")
+	if !settings.AllowNonFollowers {
+		following := false
+		if loggedIn {
+			following, err = c.Follows.IsFollowing(ctx, asker.UserId, recipientId)
+			if err != nil {
+				slog.Error("Error checking follow in db", "error", err)
+				return err
+			}
+		}
+
+		if !following {
+			return apperrors.Forbidden("The user only accepts questions from followers")
+		}
 	}
 
-	updated, err := models.UpdateQuestionReply(params.UserId, params.QuestionId, params.Message)
+	return nil
+}
+
+func (c *Controller) ReplyQuestionToUser(e echo.Context) error {
+	params := replyQuestionDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	// Only replies that could be delivered are screened, so the queue doesn't fill with replies to nothing
+	question, err := c.findQuestion(e, params.UserId, params.QuestionId)
 	if err != nil {
-		slog.Error("Error updating question in database")
 		return err
 	}
+	if question.Reply.Valid {
+		slog.Warn("Tried to answer non existing question", "user_id", params.UserId, "question_id", params.QuestionId)
+		return apperrors.NotFound("Question doesn't exist or was already replied")
+	}
 
-	if !updated {
+	action, err := c.screen(e, models.ModerationItem{
+		Kind:      models.ModerationReply,
+		UserId:    params.UserId,
+		AuthorId:  sql.NullString{String: params.UserId, Valid: true},
+		SubjectId: params.QuestionId,
+		Content:   params.Message,
+	}, "")
+	if err != nil {
+		return err
+	}
+	if action != moderation.Allow {
+		return e.String(http.StatusAccepted, "Reply held for review, it will be published once approved")
+	}
+
+	replied, err := c.reply(e, *question, params.Message)
+	if err != nil {
+		return err
+	}
+
+	if !replied {
 		slog.Warn("Tried to answer non existing question", "user_id", params.UserId, "question_id", params.QuestionId)
-		return e.String(http.StatusBadRequest, "Question doesn't exists")
+		return apperrors.NotFound("Question doesn't exist or was already replied")
 	}
 
 	return e.String(http.StatusOK, "Question updated successfuly")
 }
 
+// Stores the reply and publishes it, false when the question was deleted or already replied
+func (c *Controller) reply(e echo.Context, question models.Question, message string) (bool, error) {
+	replyDate := time.Now()
+	updated, err := c.Questions.UpdateQuestionReply(e.Request().Context(), question.UserId, question.Id, message, replyDate)
+	if err != nil {
+		slog.Error("Error updating question in database", "error", err)
+		return false, err
+	}
+
+	if !updated {
+		return false, nil
+	}
+
+	replied := question
+	replied.Reply = sql.NullString{String: message, Valid: true}
+	replied.ReplyDate = sql.NullTime{Time: replyDate, Valid: true}
+	if err := c.audit(e, question.UserId, models.AuditReplyQuestion, models.TargetQuestion, question.Id, questionToDto(question), questionToDto(replied)); err != nil {
+		return false, err
+	}
+
+	c.publish(e, models.TimelineEntry{
+		ItemId:   question.Id,
+		Kind:     models.TimelineAnswer,
+		AuthorId: question.UserId,
+		Date:     replyDate,
+	})
+	c.notifyAsker(e, question.Id)
+
+	return true, nil
+}
+
 func questionToDto(question models.Question) questionDTO {
 	var reply *string = nil
 	if question.Reply.Valid {
 		reply = &question.Reply.String
 	}
 
+	var answeredAt *time.Time = nil
+	if question.ReplyDate.Valid {
+		answeredAt = &question.ReplyDate.Time
+	}
+
+	// Anonymous questions never expose the asker, neither do old signatures that weren't tied to a user
+	var asker *askerDTO = nil
+	if !question.Anonymous && question.AskerId.Valid {
+		asker = &askerDTO{Id: question.AskerId.String, Name: question.Signature.String}
+	}
+
 	return questionDTO{
-		Id:      question.Id,
-		Message: question.Message,
-		Reply:   reply,
+		Id:         question.Id,
+		Message:    question.Message,
+		Reply:      reply,
+		CreatedAt:  question.CreationDate,
+		AnsweredAt: answeredAt,
+		Asker:      asker,
 	}
 }
 
-func MakeFavourite(e echo.Context) error {
+func questionCursor(question models.Question) models.Cursor {
+	return models.Cursor{Date: question.CreationDate, Id: question.Id}
+}
+
+func (c *Controller) MakeFavourite(e echo.Context) error {
 	params := favouriteDTO{}
 
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding to request", "error", err)
+	if err := bind(e, &params); err != nil {
 		return err
 	}
 
-	loggedUser, err := auth.DecodeUserToken(e)
+	question, err := c.findQuestion(e, params.UserId, params.QuestionId)
 	if err != nil {
-		slog.Warn("Invalid/Missing jwt", "error", err)
-		return e.String(http.StatusUnauthorized, "Invalid/Missing jwt")
-	}
-
-	if loggedUser.Id != params.UserId {
-		slog.Warn(
-			"Can't set to favourite another's question",
-			"logged_user", loggedUser,
-			"user_id", params.UserId,
-			"question_id", params.QuestionId,
-		)
-
-		return e.String(http.StatusForbidden, "Can't set to favourite another's question")
+		return err
 	}
+	principal := auth.CurrentPrincipal(e)
 
-	updated, err := models.UpdateQuestionFavourite(params.UserId, params.QuestionId, true)
+	updated, err := c.Questions.UpdateQuestionFavourite(e.Request().Context(), question.UserId, question.Id, true)
 	if err != nil {
-		return e.String(http.StatusInternalServerError, "Error updating question favourite in database")
+		slog.Error("Error updating question favourite in database", "error", err)
+		return err
 	}
 	if !updated {
-		return e.String(http.StatusBadRequest, "Invalid question or user")
+		return apperrors.NotFound("Question doesn't exist")
+	}
+
+	favourite := *question
+	favourite.Favourite = true
+	if err := c.audit(e, principal.UserId, models.AuditFavouriteQuestion, models.TargetQuestion, question.Id, questionToDto(*question), questionToDto(favourite)); err != nil {
+		return err
 	}
 
 	return e.String(http.StatusOK, "Question updated successfuly")
 }
 
-func DeleteQuestion(e echo.Context) error {
+// Moderators can delete the questions of anyone, only those deleted by the owner go to their trash
+func (c *Controller) DeleteQuestion(e echo.Context) error {
 	params := deleteDTO{}
 
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding to request", "error", err)
+	if err := bind(e, &params); err != nil {
 		return err
 	}
 
-	loggedUser, err := auth.DecodeUserToken(e)
+	question, err := c.findQuestion(e, params.UserId, params.QuestionId)
 	if err != nil {
-		slog.Warn("Invalid/Missing jwt", "error", err)
-		return e.String(http.StatusUnauthorized, "Invalid/Missing jwt")
+		return err
 	}
+	principal := auth.CurrentPrincipal(e)
 
-	if loggedUser.Id != params.UserId {
-		slog.Warn(
-			"Can't delete another's question",
-			"logged_user", loggedUser,
-			"user_id", params.UserId,
-			"question_id", params.QuestionId,
-		)
+	updated, err := c.Questions.SoftDeleteQuestion(e.Request().Context(), question.UserId, question.Id, principal.UserId, time.Now())
+	if err != nil {
+		slog.Error("Error deleting question in database", "error", err)
+		return err
+	}
 
-		return e.String(http.StatusForbidden, "Can't delete another's question")
+	if !updated {
+		return apperrors.NotFound("Question doesn't exist")
 	}
 
-	updated, err := models.DeleteQuestion(params.UserId, params.QuestionId)
+	if err := c.audit(e, principal.UserId, models.AuditDeleteQuestion, models.TargetQuestion, question.Id, questionToDto(*question), nil); err != nil {
+		return err
+	}
+	if err := c.recordModeration(e, question.UserId, models.ActionDelete, models.TargetQuestion, question.Id); err != nil {
+		return err
+	}
+
+	return e.String(http.StatusOK, "Question deleted successfuly")
+}
+
+// Returns the question of the path, 404 when it doesn't exist or was sent to another user
+func (c *Controller) findQuestion(e echo.Context, userId models.UserID, questionId models.QuestionID) (*models.Question, error) {
+	question, err := c.Questions.FindQuestionById(e.Request().Context(), questionId)
 	if err != nil {
-		return e.String(http.StatusInternalServerError, "Error deleting question in database")
+		slog.Error("Error getting question from db", "error", err)
+		return nil, err
 	}
 
-	if !updated {
-		return e.String(http.StatusBadRequest, "Invalid question or user")
+	if question == nil || question.UserId != userId {
+		return nil, apperrors.NotFound("Question doesn't exist")
 	}
 
-	return e.String(http.StatusOK, "Question deleted successfuly")
+	return question, nil
+}
+
+// Tells the asker their question was answered, askers that weren't logged in can't be notified
+func (c *Controller) notifyAsker(e echo.Context, questionId models.QuestionID) {
+	question, err := c.Questions.FindQuestionById(e.Request().Context(), questionId)
+	if err != nil {
+		slog.Error("Error getting question from db", "error", err)
+		return
+	}
+
+	if question != nil && question.AskerId.Valid && question.AskerId.String != question.UserId {
+		c.notify(e, question.AskerId.String, models.NotificationAnswer, question.UserId, question.Id)
+	}
 }
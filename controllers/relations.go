@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+type relationDTO struct {
+	UserId string `param:"user_id" validate:"uuid"`
+}
+
+type findRelationsDTO struct {
+	Pagination pageParams
+}
+
+type relationEntryDTO struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+/**
+ * The logged user blocks the user of the path. The blocked user stops following them and
+ * can't follow them again, ask them questions nor see their posts and answers.
+ */
+func (c *Controller) Block(e echo.Context) error {
+	params := relationDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	if principal.UserId == params.UserId {
+		return apperrors.BadRequest("Can't block yourself")
+	}
+
+	if err := c.requireUser(e, params.UserId); err != nil {
+		return err
+	}
+
+	ctx := e.Request().Context()
+
+	_, err := c.Relations.AddRelation(ctx, models.RelationBlock, principal.UserId, params.UserId, time.Now())
+	if err != nil {
+		slog.Error("Error blocking user", "error", err)
+		return err
+	}
+
+	// Follows in both directions are removed, whoever blocks usually doesn't want to see the other either
+	if _, err := c.Timeline.Unfollow(ctx, params.UserId, principal.UserId); err != nil {
+		slog.Error("Error removing follow of blocked user", "error", err)
+		return err
+	}
+	if _, err := c.Timeline.Unfollow(ctx, principal.UserId, params.UserId); err != nil {
+		slog.Error("Error removing follow of blocked user", "error", err)
+		return err
+	}
+
+	return e.String(http.StatusOK, "User blocked successfuly")
+}
+
+func (c *Controller) Unblock(e echo.Context) error {
+	params := relationDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	removed, err := c.Relations.RemoveRelation(e.Request().Context(), models.RelationBlock, principal.UserId, params.UserId)
+	if err != nil {
+		slog.Error("Error unblocking user", "error", err)
+		return err
+	}
+
+	if !removed {
+		return apperrors.NotFound("The user isn't blocked")
+	}
+
+	return e.String(http.StatusOK, "User unblocked successfuly")
+}
+
+// The logged user stops seeing the user of the path in their timeline and notifications, the muted user isn't told
+func (c *Controller) Mute(e echo.Context) error {
+	params := relationDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	if principal.UserId == params.UserId {
+		return apperrors.BadRequest("Can't mute yourself")
+	}
+
+	if err := c.requireUser(e, params.UserId); err != nil {
+		return err
+	}
+
+	ctx := e.Request().Context()
+
+	_, err := c.Relations.AddRelation(ctx, models.RelationMute, principal.UserId, params.UserId, time.Now())
+	if err != nil {
+		slog.Error("Error muting user", "error", err)
+		return err
+	}
+
+	if err := c.Timeline.Mute(ctx, principal.UserId, params.UserId); err != nil {
+		slog.Error("Error removing muted user from timeline", "error", err)
+		return err
+	}
+
+	return e.String(http.StatusOK, "User muted successfuly")
+}
+
+func (c *Controller) Unmute(e echo.Context) error {
+	params := relationDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	ctx := e.Request().Context()
+
+	removed, err := c.Relations.RemoveRelation(ctx, models.RelationMute, principal.UserId, params.UserId)
+	if err != nil {
+		slog.Error("Error unmuting user", "error", err)
+		return err
+	}
+
+	if !removed {
+		return apperrors.NotFound("The user isn't muted")
+	}
+
+	// The timeline isn't required to unmute, it only misses the older content when this fails
+	if err := c.Timeline.Unmute(ctx, principal.UserId, params.UserId); err != nil {
+		slog.Error("Error adding unmuted user to timeline", "error", err)
+	}
+
+	return e.String(http.StatusOK, "User unmuted successfuly")
+}
+
+func (c *Controller) FindBlocks(e echo.Context) error {
+	return c.findRelations(e, models.RelationBlock)
+}
+
+func (c *Controller) FindMutes(e echo.Context) error {
+	return c.findRelations(e, models.RelationMute)
+}
+
+func (c *Controller) findRelations(e echo.Context, kind models.RelationKind) error {
+	params := findRelationsDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	relations, err := c.Relations.FindRelations(e.Request().Context(), kind, auth.CurrentPrincipal(e).UserId, page)
+	if err != nil {
+		slog.Error("Error getting relations from db", "kind", kind, "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, relations, relationCursor, relationEntryToDto))
+}
+
+// Rejects the request when the owner of the content blocked the logged user, routes must use auth.OptionalAuth or auth.RequireAuth
+func (c *Controller) checkNotBlocked(e echo.Context, ownerId models.UserID) error {
+	principal, ok := auth.PrincipalFrom(e)
+	if !ok || principal.UserId == ownerId {
+		return nil
+	}
+
+	blocked, err := c.Relations.HasRelation(e.Request().Context(), ownerId, principal.UserId, models.RelationBlock)
+	if err != nil {
+		slog.Error("Error checking block in db", "error", err)
+		return err
+	}
+
+	if blocked {
+		return apperrors.Forbidden("The user blocked you")
+	}
+
+	return nil
+}
+
+// Reports whether the user muted the other, errors are only logged and count as not muted
+func (c *Controller) isMuted(e echo.Context, userId models.UserID, mutedId models.UserID) bool {
+	muted, err := c.Relations.HasRelation(e.Request().Context(), userId, mutedId, models.RelationMute)
+	if err != nil {
+		slog.Error("Error checking mute in db", "error", err)
+	}
+
+	return muted
+}
+
+// Id of the logged user, empty when the request is anonymous
+func viewerId(e echo.Context) models.UserID {
+	principal, _ := auth.PrincipalFrom(e)
+	return principal.UserId
+}
+
+func relationEntryToDto(relation models.RelationEntry) relationEntryDTO {
+	return relationEntryDTO{
+		Id:        relation.UserId,
+		Name:      relation.Name,
+		CreatedAt: relation.CreationDate,
+	}
+}
+
+func relationCursor(relation models.RelationEntry) models.Cursor {
+	return models.Cursor{Date: relation.CreationDate, Id: relation.UserId}
+}
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+type createReportDTO struct {
+	TargetKind string `json:"target_kind" validate:"required,oneof=question reply post user"`
+	TargetId   string `json:"target_id" validate:"required,uuid"`
+	Reason     string `json:"reason" validate:"required,oneof=spam harassment hate sexual violence self_harm impersonation other"`
+	Details    string `json:"details" validate:"max=1000"`
+}
+
+type findReportsDTO struct {
+	Status     string `query:"status" validate:"oneof=open resolved dismissed"`
+	TargetKind string `query:"target_kind" validate:"oneof=question reply post user"`
+	TargetId   string `query:"target_id" validate:"uuid"`
+	Pagination pageParams
+}
+
+type triageReportDTO struct {
+	ReportId string `param:"report_id" validate:"uuid"`
+	Status   string `json:"status" validate:"required,oneof=resolved dismissed"`
+	Note     string `json:"note" validate:"max=1000"`
+}
+
+type reportDTO struct {
+	Id           string              `json:"id"`
+	ReporterId   string              `json:"reporter_id"`
+	TargetKind   models.TargetKind   `json:"target_kind"`
+	TargetId     string              `json:"target_id"`
+	TargetUserId *string             `json:"target_user_id"`
+	Reason       models.ReportReason `json:"reason"`
+	Details      string              `json:"details"`
+	Status       models.ReportStatus `json:"status"`
+	Note         string              `json:"note"`
+	CreatedAt    time.Time           `json:"created_at"`
+	// Null while open
+	ResolvedAt *time.Time `json:"resolved_at"`
+	ResolverId *string    `json:"resolver_id"`
+}
+
+/**
+ * The logged user reports a question, the reply of a question, a post or a user to the moderators.
+ * Only one open report of the same target is kept for each user.
+ */
+func (c *Controller) CreateReport(e echo.Context) error {
+	params := createReportDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	reporterId := auth.CurrentPrincipal(e).UserId
+	kind := models.TargetKind(params.TargetKind)
+
+	targetUserId, err := c.reportedUser(e, kind, params.TargetId)
+	if err != nil {
+		return err
+	}
+	if targetUserId.String == reporterId {
+		return apperrors.BadRequest("Can't report yourself")
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		slog.Error("Error generating uuid", "error", err)
+		return err
+	}
+
+	report := models.Report{
+		Id:           id.String(),
+		ReporterId:   reporterId,
+		TargetKind:   kind,
+		TargetId:     params.TargetId,
+		TargetUserId: targetUserId,
+		Reason:       models.ReportReason(params.Reason),
+		Details:      params.Details,
+		Status:       models.ReportOpen,
+		CreationDate: time.Now(),
+	}
+
+	inserted, err := c.Reports.InsertReport(e.Request().Context(), report)
+	if err != nil {
+		slog.Error("Error inserting report into db", "error", err)
+		return err
+	}
+	if !inserted {
+		return apperrors.Conflict("You already reported this")
+	}
+
+	slog.Info("Content reported", "report_id", report.Id, "target_kind", kind, "target_id", report.TargetId, "reason", report.Reason)
+	return e.String(http.StatusOK, "Report sent successfuly")
+}
+
+// Lists the open reports, or the triaged ones with another status
+func (c *Controller) FindReports(e echo.Context) error {
+	params := findReportsDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	filter := models.ReportFilter{
+		Status:     models.ReportOpen,
+		TargetKind: models.TargetKind(params.TargetKind),
+		TargetId:   params.TargetId,
+	}
+	if params.Status != "" {
+		filter.Status = models.ReportStatus(params.Status)
+	}
+
+	reports, err := c.Reports.FindReports(e.Request().Context(), filter, page)
+	if err != nil {
+		slog.Error("Error getting reports from db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, reports, models.Report.Cursor, reportToDto))
+}
+
+/**
+ * Closes an open report as resolved or dismissed. Acting on the reported content is done
+ * with the other admin endpoints, passing the report so the actions are linked to it.
+ */
+func (c *Controller) TriageReport(e echo.Context) error {
+	params := triageReportDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	ctx := e.Request().Context()
+	status := models.ReportStatus(params.Status)
+	moderatorId := auth.CurrentPrincipal(e).UserId
+
+	triaged, err := c.Reports.TriageReport(ctx, params.ReportId, status, params.Note, moderatorId, time.Now())
+	if err != nil {
+		slog.Error("Error triaging report in db", "error", err)
+		return err
+	}
+
+	if !triaged {
+		report, err := c.Reports.FindReport(ctx, params.ReportId)
+		if err != nil {
+			slog.Error("Error getting report from db", "error", err)
+			return err
+		}
+		if report == nil {
+			return apperrors.NotFound("Report doesn't exist")
+		}
+		return apperrors.Conflict("The report was already triaged")
+	}
+
+	action := models.ActionResolveReport
+	if status == models.ReportDismissed {
+		action = models.ActionDismissReport
+	}
+	if err := c.recordAction(e, action, models.TargetReport, params.ReportId, params.ReportId, params.Note); err != nil {
+		return err
+	}
+
+	return e.String(http.StatusOK, "Report triaged successfuly")
+}
+
+// Checks the reported target exists and returns who it's about
+func (c *Controller) reportedUser(e echo.Context, kind models.TargetKind, targetId string) (sql.NullString, error) {
+	ctx := e.Request().Context()
+
+	switch kind {
+	case models.TargetQuestion, models.TargetReply:
+		question, err := c.Questions.FindQuestionById(ctx, targetId)
+		if err != nil {
+			slog.Error("Error getting question from db", "error", err)
+			return sql.NullString{}, err
+		}
+		if question == nil || question.HiddenDate.Valid {
+			return sql.NullString{}, apperrors.NotFound("Question doesn't exist")
+		}
+
+		// The question is reported to its asker, the reply to who answered it
+		if kind == models.TargetQuestion {
+			return question.AskerId, nil
+		}
+		if !question.Reply.Valid {
+			return sql.NullString{}, apperrors.NotFound("The question wasn't answered")
+		}
+		return sql.NullString{String: question.UserId, Valid: true}, nil
+
+	case models.TargetPost:
+		post, err := c.Posts.LookupPost(ctx, targetId)
+		if err != nil {
+			slog.Error("Error getting post from db", "error", err)
+			return sql.NullString{}, err
+		}
+		if post == nil || post.DeletionDate.Valid || post.HiddenDate.Valid {
+			return sql.NullString{}, apperrors.NotFound("Post doesn't exist")
+		}
+		return sql.NullString{String: post.OwnerId, Valid: true}, nil
+	}
+
+	if err := c.requireUser(e, targetId); err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: targetId, Valid: true}, nil
+}
+
+func reportToDto(report models.Report) reportDTO {
+	response := reportDTO{
+		Id:         report.Id,
+		ReporterId: report.ReporterId,
+		TargetKind: report.TargetKind,
+		TargetId:   report.TargetId,
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     report.Status,
+		Note:       report.Note,
+		CreatedAt:  report.CreationDate,
+	}
+
+	if report.TargetUserId.Valid {
+		response.TargetUserId = &report.TargetUserId.String
+	}
+	if report.ResolutionDate.Valid {
+		response.ResolvedAt = &report.ResolutionDate.Time
+	}
+	if report.ResolverId.Valid {
+		response.ResolverId = &report.ResolverId.String
+	}
+
+	return response
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+const maxSearchOffset = 1000
+
+type searchDTO struct {
+	Query  string `query:"q" validate:"required,max=200"`
+	Type   string `query:"type" validate:"oneof=all questions posts"`
+	Limit  int    `query:"limit"`
+	Offset int    `query:"offset"`
+}
+
+type searchResultDTO struct {
+	Kind   models.SearchResultKind `json:"kind"`
+	Id     string                  `json:"id"`
+	UserId string                  `json:"user_id"`
+	Title  string                  `json:"title,omitempty"`
+	// HTML escaped, the matching words are wrapped in <mark>
+	Snippet string    `json:"snippet"`
+	Date    time.Time `json:"date"`
+}
+
+type searchResponseDTO struct {
+	Items      []searchResultDTO `json:"items"`
+	NextOffset *int              `json:"next_offset"`
+}
+
+var searchKinds = map[string]models.SearchResultKind{
+	"questions": models.SearchQuestion,
+	"posts":     models.SearchPost,
+}
+
+var snippetReplacer = strings.NewReplacer(models.SnippetStart, "<mark>", models.SnippetStop, "</mark>")
+
+// Ranked results are paginated by offset, there is no stable order to build a cursor from
+func (c *Controller) Search(e echo.Context) error {
+	params := searchDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	if params.Limit == 0 {
+		params.Limit = defaultPageLimit
+	}
+	var fieldErrors []apperrors.FieldError
+	if params.Limit < 1 || params.Limit > maxPageLimit {
+		fieldErrors = append(fieldErrors, apperrors.FieldError{
+			Field:   "limit",
+			Code:    "out_of_range",
+			Message: fmt.Sprintf("limit must be between 1 and %d", maxPageLimit),
+		})
+	}
+	if params.Offset < 0 || params.Offset > maxSearchOffset {
+		fieldErrors = append(fieldErrors, apperrors.FieldError{
+			Field:   "offset",
+			Code:    "out_of_range",
+			Message: fmt.Sprintf("offset must be between 0 and %d", maxSearchOffset),
+		})
+	}
+	if len(fieldErrors) > 0 {
+		return apperrors.Validation("The request has invalid fields", fieldErrors...)
+	}
+
+	results, err := c.Searcher.Search(e.Request().Context(), models.SearchQuery{
+		Text:   params.Query,
+		Kind:   searchKinds[params.Type],
+		Limit:  params.Limit + 1,
+		Offset: params.Offset,
+		// The content of the users that blocked the viewer is left out
+		ViewerId: viewerId(e),
+	})
+	if err != nil {
+		slog.Error("Error searching", "error", err)
+		return err
+	}
+
+	response := searchResponseDTO{Items: make([]searchResultDTO, 0, len(results))}
+	if len(results) > params.Limit {
+		results = results[:params.Limit]
+		next := params.Offset + params.Limit
+		response.NextOffset = &next
+	}
+
+	for _, result := range results {
+		response.Items = append(response.Items, searchResultDTO{
+			Kind:    result.Kind,
+			Id:      result.Id,
+			UserId:  result.UserId,
+			Title:   result.Title,
+			Snippet: snippetReplacer.Replace(html.EscapeString(result.Snippet)),
+			Date:    result.Date,
+		})
+	}
+
+	return e.JSON(http.StatusOK, response)
+}
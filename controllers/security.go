@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+// Longer user agents are cut, they are only shown back to the user
+const maxUserAgentLength = 512
+
+type findLoginAttemptsDTO struct {
+	Pagination pageParams
+}
+
+type loginAttemptDTO struct {
+	Id            string                     `json:"id"`
+	Ip            string                     `json:"ip"`
+	UserAgent     string                     `json:"user_agent"`
+	Success       bool                       `json:"success"`
+	FailureReason *models.LoginFailureReason `json:"failure_reason"`
+	CreatedAt     time.Time                  `json:"created_at"`
+}
+
+// Recent logins and failed attempts on the account of the logged user
+func (c *Controller) FindLoginAttempts(e echo.Context) error {
+	params := findLoginAttemptsDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	attempts, err := c.LoginAttempts.FindLoginAttempts(e.Request().Context(), principal.UserId, page)
+	if err != nil {
+		slog.Error("Error getting login attempts from db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, attempts, models.LoginAttempt.Cursor, loginAttemptToDto))
+}
+
+/**
+ * Stores the attempt for the login history of the user, failing to do so is only logged,
+ * and audits it. An attempt that can't be audited fails the request.
+ */
+func (c *Controller) recordLogin(e echo.Context, email string, user *models.User, reason models.LoginFailureReason) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		slog.Error("Error generating uuid", "error", err)
+		return err
+	}
+
+	userAgent := []rune(e.Request().UserAgent())
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	attempt := models.LoginAttempt{
+		Id:           id.String(),
+		Email:        email,
+		Ip:           e.RealIP(),
+		UserAgent:    string(userAgent),
+		Success:      reason == "",
+		CreationDate: time.Now(),
+	}
+	if user != nil {
+		attempt.UserId = sql.NullString{String: user.Id, Valid: true}
+	}
+	if reason != "" {
+		attempt.FailureReason = sql.NullString{String: string(reason), Valid: true}
+	}
+
+	if err := c.LoginAttempts.InsertLoginAttempt(e.Request().Context(), attempt); err != nil {
+		slog.Error("Error recording login attempt", "error", err, "success", attempt.Success)
+	}
+
+	// A failed login doesn't prove who made it, so it has no actor
+	actorId, action := attempt.UserId.String, models.AuditLogin
+	if !attempt.Success {
+		actorId, action = "", models.AuditLoginFailed
+	}
+	return c.audit(e, actorId, action, models.TargetUser, attempt.UserId.String, nil, map[string]string{
+		"email":          attempt.Email,
+		"ip":             attempt.Ip,
+		"failure_reason": attempt.FailureReason.String,
+	})
+}
+
+func loginAttemptToDto(attempt models.LoginAttempt) loginAttemptDTO {
+	response := loginAttemptDTO{
+		Id:        attempt.Id,
+		Ip:        attempt.Ip,
+		UserAgent: attempt.UserAgent,
+		Success:   attempt.Success,
+		CreatedAt: attempt.CreationDate,
+	}
+
+	if attempt.FailureReason.Valid {
+		reason := models.LoginFailureReason(attempt.FailureReason.String)
+		response.FailureReason = &reason
+	}
+
+	return response
+}
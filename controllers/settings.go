@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+type questionSettingsDTO struct {
+	AllowAnonymous    *bool `json:"allow_anonymous" validate:"required"`
+	AllowNonFollowers *bool `json:"allow_non_followers" validate:"required"`
+}
+
+type mutedWordsDTO struct {
+	Words []string `json:"words" validate:"required"`
+}
+
+func (c *Controller) FindQuestionSettings(e echo.Context) error {
+	principal := auth.CurrentPrincipal(e)
+
+	settings, err := c.Settings.FindQuestionSettings(e.Request().Context(), principal.UserId)
+	if err != nil {
+		slog.Error("Error getting question settings from db", "error", err)
+		return err
+	}
+	if settings == nil {
+		return apperrors.NotFound("User doesn't exist")
+	}
+
+	return e.JSON(http.StatusOK, questionSettingsToDto(*settings))
+}
+
+func (c *Controller) UpdateQuestionSettings(e echo.Context) error {
+	params := questionSettingsDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	settings := models.QuestionSettings{
+		AllowAnonymous:    *params.AllowAnonymous,
+		AllowNonFollowers: *params.AllowNonFollowers,
+	}
+
+	updated, err := c.Settings.UpdateQuestionSettings(e.Request().Context(), principal.UserId, settings)
+	if err != nil {
+		slog.Error("Error updating question settings in db", "error", err)
+		return err
+	}
+	if !updated {
+		return apperrors.NotFound("User doesn't exist")
+	}
+
+	return e.JSON(http.StatusOK, questionSettingsToDto(settings))
+}
+
+// Questions with these words or phrases never reach the logged user, spelling variations included
+func (c *Controller) FindMutedWords(e echo.Context) error {
+	words, err := c.Settings.FindMutedWords(e.Request().Context(), auth.CurrentPrincipal(e).UserId)
+	if err != nil {
+		slog.Error("Error getting muted words from db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, mutedWordsDTO{Words: words})
+}
+
+// Replaces the whole list, an empty list unmutes every word
+func (c *Controller) UpdateMutedWords(e echo.Context) error {
+	params := mutedWordsDTO{}
+
+	// An empty list is present, required only rejects a missing one
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	words, err := c.Moderator.CleanMutedWords(params.Words)
+	if err != nil {
+		return err
+	}
+
+	updated, err := c.Settings.UpdateMutedWords(e.Request().Context(), auth.CurrentPrincipal(e).UserId, words)
+	if err != nil {
+		slog.Error("Error updating muted words in db", "error", err)
+		return err
+	}
+	if !updated {
+		return apperrors.NotFound("User doesn't exist")
+	}
+
+	return e.JSON(http.StatusOK, mutedWordsDTO{Words: words})
+}
+
+func questionSettingsToDto(settings models.QuestionSettings) questionSettingsDTO {
+	return questionSettingsDTO{
+		AllowAnonymous:    &settings.AllowAnonymous,
+		AllowNonFollowers: &settings.AllowNonFollowers,
+	}
+}
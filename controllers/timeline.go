@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+type timelineDTO struct {
+	Pagination pageParams
+}
+
+type timelineItemDTO struct {
+	Kind     models.TimelineItemKind `json:"kind"`
+	Id       string                  `json:"id"`
+	AuthorId string                  `json:"author_id"`
+	Date     time.Time               `json:"date"`
+	Post     *postDTO                `json:"post,omitempty"`
+	Question *questionDTO            `json:"question,omitempty"`
+}
+
+// Posts and answers of the users followed by the logged user, newest first
+func (c *Controller) HomeTimeline(e echo.Context) error {
+	params := timelineDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	items, err := c.Timeline.Home(e.Request().Context(), principal.UserId, page)
+	if err != nil {
+		slog.Error("Error getting timeline", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, items, models.TimelineItem.Cursor, timelineItemToDto))
+}
+
+// Adds new content to the timelines, the content is already saved so a failure is only logged
+func (c *Controller) publish(e echo.Context, entry models.TimelineEntry) {
+	if err := c.Timeline.Publish(e.Request().Context(), entry); err != nil {
+		slog.Error("Error publishing to the timelines", "error", err, "item_id", entry.ItemId)
+	}
+}
+
+func timelineItemToDto(item models.TimelineItem) timelineItemDTO {
+	response := timelineItemDTO{
+		Kind:     item.Kind,
+		Id:       item.ItemId,
+		AuthorId: item.AuthorId,
+		Date:     item.Date,
+	}
+
+	if item.Post != nil {
+		post := postToDto(*item.Post)
+		response.Post = &post
+	}
+	if item.Question != nil {
+		question := questionToDto(*item.Question)
+		response.Question = &question
+	}
+
+	return response
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+type findTrashDTO struct {
+	Pagination pageParams
+}
+
+type restoreQuestionDTO struct {
+	QuestionId string `param:"question_id" validate:"uuid"`
+	UserId     string `param:"user_id" validate:"uuid"`
+}
+
+type restorePostDTO struct {
+	PostId string `param:"post_id" validate:"uuid"`
+	UserId string `param:"user_id" validate:"uuid"`
+}
+
+type trashItemDTO struct {
+	Kind      models.TargetKind `json:"kind"`
+	Id        string            `json:"id"`
+	Title     string            `json:"title,omitempty"`
+	Content   string            `json:"content"`
+	Reply     *string           `json:"reply,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	DeletedAt time.Time         `json:"deleted_at"`
+	// After this date it's purged and can't be restored anymore
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// Lists the questions and posts the logged user deleted that can still be restored, the last deleted first
+func (c *Controller) FindTrash(e echo.Context) error {
+	params := findTrashDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	page, err := params.Pagination.page()
+	if err != nil {
+		return err
+	}
+
+	since := c.Bin.RestorableSince(time.Now())
+	items, err := c.Trash.FindTrash(e.Request().Context(), auth.CurrentPrincipal(e).UserId, since, page)
+	if err != nil {
+		slog.Error("Error getting trash from db", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, newPage(e, page, items, models.TrashItem.Cursor, c.trashItemToDto))
+}
+
+func (c *Controller) RestoreQuestion(e echo.Context) error {
+	params := restoreQuestionDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	ctx := e.Request().Context()
+
+	restored, err := c.Questions.RestoreQuestion(ctx, params.UserId, params.QuestionId, c.Bin.RestorableSince(time.Now()))
+	if err != nil {
+		slog.Error("Error restoring question in database", "error", err)
+		return err
+	}
+
+	if !restored {
+		return apperrors.NotFound("Question isn't in the trash")
+	}
+
+	var after any
+	if question, err := c.Questions.FindQuestionById(ctx, params.QuestionId); err == nil && question != nil {
+		after = questionToDto(*question)
+	}
+	if err := c.audit(e, principal.UserId, models.AuditUndeleteQuestion, models.TargetQuestion, params.QuestionId, nil, after); err != nil {
+		return err
+	}
+
+	return e.String(http.StatusOK, "Question restored successfuly")
+}
+
+func (c *Controller) RestorePost(e echo.Context) error {
+	params := restorePostDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	principal := auth.CurrentPrincipal(e)
+	ctx := e.Request().Context()
+
+	restored, err := c.Posts.RestorePost(ctx, params.UserId, params.PostId, c.Bin.RestorableSince(time.Now()))
+	if err != nil {
+		slog.Error("Error restoring post in database", "error", err)
+		return err
+	}
+
+	if !restored {
+		return apperrors.NotFound("Post isn't in the trash")
+	}
+
+	var after any
+	if post, err := c.Posts.FindPostById(ctx, params.UserId, params.PostId); err == nil && post != nil {
+		after = postToDto(*post)
+	}
+	if err := c.audit(e, principal.UserId, models.AuditUndeletePost, models.TargetPost, params.PostId, nil, after); err != nil {
+		return err
+	}
+
+	return e.String(http.StatusOK, "Post restored successfuly")
+}
+
+func (c *Controller) trashItemToDto(item models.TrashItem) trashItemDTO {
+	response := trashItemDTO{
+		Kind:      item.Kind,
+		Id:        item.Id,
+		Title:     item.Title,
+		Content:   item.Content,
+		CreatedAt: item.CreationDate,
+		DeletedAt: item.DeletionDate,
+		PurgeAt:   item.DeletionDate.Add(c.Bin.Retention()),
+	}
+
+	if item.Reply.Valid {
+		response.Reply = &item.Reply.String
+	}
+
+	return response
+}
@@ -1,73 +1,216 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"math"
 	"net/http"
-	"strings"
-	"unicode"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
 	"github.com/preguntame/preguntame-backend/auth"
 	"github.com/preguntame/preguntame-backend/models"
 )
 
 type loginDTO struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type refreshDTO struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 type registerDTO struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Name     string `json:"name" validate:"max=100"`
+	Email    string `json:"email" validate:"required,length=email,email"`
+	Password string `json:"password" validate:"required,length=password,password"`
 }
 
 /**
  * Endpoint for handling the login
  * It checks that the credentials are valid and then returns a JWT with the user claims
  */
-func Login(e echo.Context) error {
+func (c *Controller) Login(e echo.Context) error {
 	params := loginDTO{}
 
 	// Check if the body contains a loginDTO
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding the request", "error", err)
+	if err := bind(e, &params); err != nil {
 		return err
 	}
 
+	ctx := e.Request().Context()
+	now := time.Now()
+
 	// Search the user by the email in the database
-	user, err := models.FindUserByEmail(params.Email)
+	user, err := c.Users.FindUserByEmail(ctx, params.Email)
 	if err != nil {
 		slog.Error("Error searching user in database", "error", err)
 		return err
 	}
 
-	// Return an error in case that the user doesn't exists or that the password doesn't match
-	if user == nil || params.Password != user.Password {
-		return e.String(http.StatusBadRequest, "User and password not match")
+	// Unknown emails get locked and take as long as registered ones, so the response doesn't tell them apart
+	if user == nil {
+		return c.rejectUnknownEmail(e, params, now)
+	}
+
+	// Locked accounts don't get their password checked, so guessing it is pointless
+	lockedFor, err := c.Logins.LockedFor(ctx, user.Id, now)
+	if err != nil {
+		slog.Error("Error checking login lock", "user_id", user.Id, "error", err)
+		return err
+	}
+	if lockedFor > 0 {
+		if err := c.recordLogin(e, params.Email, user, models.LoginLocked); err != nil {
+			return err
+		}
+		return loginLockedError(e, lockedFor)
 	}
 
-	// Generates the JWT
-	jwt, err := auth.NewTokenForUser(*user)
+	// Return an error in case that the password doesn't match the stored hash
+	ok, needsRehash, err := c.Passwords.Verify(params.Password, user.Password)
+	// A stored value that can't be verified fails like a wrong password, so it doesn't tell the email is registered
+	if errors.Is(err, auth.ErrInvalidHash) {
+		slog.Error("Stored password can't be verified, it's plaintext or a malformed hash", "user_id", user.Id)
+		err = nil
+	}
+	if err != nil {
+		slog.Error("Error verifying password", "user_id", user.Id, "error", err)
+		return err
+	}
+	if !ok {
+		if err := c.Logins.Failed(ctx, user.Id, now); err != nil {
+			slog.Error("Error counting failed login", "user_id", user.Id, "error", err)
+		}
+		if err := c.recordLogin(e, params.Email, user, models.LoginWrongPassword); err != nil {
+			return err
+		}
+		return apperrors.Unauthorized("User and password not match")
+	}
+
+	// Only told once the password is right, so the suspension doesn't leak to whoever tries the email
+	if user.IsSuspended(now) {
+		if err := c.recordLogin(e, params.Email, user, models.LoginSuspended); err != nil {
+			return err
+		}
+		return suspendedError(*user)
+	}
+
+	if err := c.Logins.Succeeded(ctx, user.Id); err != nil {
+		slog.Error("Error resetting failed logins", "user_id", user.Id, "error", err)
+	}
+	if err := c.recordLogin(e, params.Email, user, ""); err != nil {
+		return err
+	}
+
+	// Upgrade plaintext or outdated hashes now that we know the password
+	if needsRehash {
+		c.rehashPassword(e, user.Id, params.Password)
+	}
+
+	// Generates the JWT and its refresh token
+	tokens, err := c.Auth.IssueTokens(ctx, *user)
 	if err != nil {
 		slog.Error("Error generating jwt", "error", err)
 		return err
 	}
 
 	// If we haven't returend yet, it means that the loggin was successful
-	return e.String(http.StatusOK, jwt)
+	return e.JSON(http.StatusOK, tokens)
+}
+
+func (c *Controller) rejectUnknownEmail(e echo.Context, params loginDTO, now time.Time) error {
+	ctx := e.Request().Context()
+
+	lockedFor, err := c.Logins.UnknownLockedFor(ctx, params.Email, now)
+	if err != nil {
+		slog.Error("Error checking login lock", "error", err)
+		return err
+	}
+	if lockedFor > 0 {
+		if err := c.recordLogin(e, params.Email, nil, models.LoginLocked); err != nil {
+			return err
+		}
+		return loginLockedError(e, lockedFor)
+	}
+
+	c.Passwords.VerifyUnknownUser(params.Password)
+	if err := c.Logins.UnknownFailed(ctx, params.Email, now); err != nil {
+		slog.Error("Error counting failed login", "error", err)
+	}
+	if err := c.recordLogin(e, params.Email, nil, models.LoginUnknownEmail); err != nil {
+		return err
+	}
+	return apperrors.Unauthorized("User and password not match")
+}
+
+func loginLockedError(e echo.Context, lockedFor time.Duration) error {
+	e.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+	return apperrors.TooManyRequests("Too many failed logins, try again later")
+}
+
+/**
+ * Endpoint for exchanging a refresh token for a new pair of tokens
+ */
+func (c *Controller) Refresh(e echo.Context) error {
+	params := refreshDTO{}
+
+	if err := bind(e, &params); err != nil {
+		return err
+	}
+
+	tokens, err := c.Auth.Refresh(e.Request().Context(), params.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		slog.Warn("Invalid refresh token", "error", err)
+		return apperrors.Unauthorized("Invalid refresh token")
+	}
+	if errors.Is(err, auth.ErrAccountSuspended) {
+		return apperrors.Forbidden("The account is suspended")
+	}
+	if err != nil {
+		slog.Error("Error refreshing tokens", "error", err)
+		return err
+	}
+
+	return e.JSON(http.StatusOK, tokens)
+}
+
+/**
+ * Endpoint for closing the session of the token used to call it
+ */
+func (c *Controller) Logout(e echo.Context) error {
+	if err := c.Auth.Logout(e.Request().Context(), auth.CurrentPrincipal(e)); err != nil {
+		slog.Error("Error revoking tokens", "error", err)
+		return err
+	}
+
+	return e.String(http.StatusOK, "Logged out successfuly")
+}
+
+/**
+ * Endpoint for closing every session of the logged user
+ */
+func (c *Controller) LogoutAll(e echo.Context) error {
+	if err := c.Auth.LogoutAll(e.Request().Context(), auth.CurrentPrincipal(e).UserId); err != nil {
+		slog.Error("Error revoking tokens", "error", err)
+		return err
+	}
+
+	return e.String(http.StatusOK, "Logged out of every session successfuly")
 }
 
 /**
  * Endpoint for handliong new user registers
  */
-func Register(e echo.Context) error {
+func (c *Controller) Register(e echo.Context) error {
 	params := registerDTO{}
 
 	// Check if the body contains a registerDTO
-	if err := e.Bind(&params); err != nil {
-		slog.WarnContext(e.Request().Context(), "Error binding the request", "error", err)
+	if err := bind(e, &params); err != nil {
 		return err
 	}
 
@@ -78,45 +221,59 @@ func Register(e echo.Context) error {
 		return err
 	}
 
-	if !strings.Contains(params.Email, "@") || len(params.Email) > 256 || !strings.Contains(params.Email, ".") {
-		slog.Info("The email must contains an @, an . and must be less or equal than 256", "email", params.Email)
-		return e.String(http.StatusBadRequest, "The email must contains an @, an . and must be less or equal than 256")
-	}
-
-	mayus := false
-	minus := false
-	num := false
-
-	for _, r := range params.Password {
-		if unicode.IsUpper(r) {
-			mayus = true
-		}
-		if unicode.IsLower(r) {
-			minus = true
-		}
-		if unicode.IsDigit(r) {
-			num = true
-		}
-	}
-
-	if !mayus || !minus || len(params.Password) < 8 || !num {
-		slog.Info("The password must contains at least one uppercase character, one lowcase character, a number and the length must be greather than 8 characters")
-		return e.String(http.StatusBadRequest, "The password must contains at least one uppercase character, one lowcase character a number and the length must be greather than 8 characters")
+	hash, err := c.Passwords.Hash(params.Password)
+	if err != nil {
+		slog.Error("Error hashing password", "error", err)
+		return err
 	}
 
 	user := models.User{
 		Id:       uuid.String(),
 		Name:     params.Name,
-		Password: params.Password,
+		Password: hash,
 		Email:    params.Email,
 	}
 
 	// Saves the user in the database
-	err = models.InsertUser(user)
+	err = c.Users.InsertUser(e.Request().Context(), user)
+	if errors.Is(err, apperrors.ErrConflict) {
+		return apperrors.Conflict("Email already registered")
+	}
 	if err != nil {
 		slog.Error("Error inserting user in database", "error", err)
 		return err
 	}
 
+	if err := c.audit(e, user.Id, models.AuditRegister, models.TargetUser, user.Id, nil, map[string]string{"name": user.Name, "email": user.Email}); err != nil {
+		return err
+	}
+
+	c.sendInBackground(e, "verification", func(ctx context.Context) error {
+		return c.Accounts.SendVerification(ctx, user)
+	})
+
 	return e.String(http.StatusOK, "Successful register")
 }
+
+// A failed upgrade isn't fatal, the old hash keeps working until the next login
+func (c *Controller) rehashPassword(e echo.Context, userId models.UserID, password string) {
+	hash, err := c.Passwords.Hash(password)
+	if err != nil {
+		slog.Error("Error rehashing password", "user_id", userId, "error", err)
+		return
+	}
+
+	if _, err := c.Users.UpdateUserPassword(e.Request().Context(), userId, hash); err != nil {
+		slog.Error("Error saving rehashed password", "user_id", userId, "error", err)
+		return
+	}
+
+	slog.Info("Upgraded password hash", "user_id", userId)
+}
+
+func suspendedError(user models.User) error {
+	if user.SuspensionEnd.Valid {
+		return apperrors.Forbidden("The account is suspended until " + user.SuspensionEnd.Time.UTC().Format(time.RFC3339))
+	}
+	return apperrors.Forbidden("The account is suspended")
+}
@@ -3,30 +3,32 @@ package databases
 import (
 	"database/sql"
 	"log/slog"
+
+	"github.com/preguntame/preguntame-backend/config"
 )
 
 var DbPool *sql.DB
 
-func InitDatabase() error {
-	dbtype := "postgresql"
-	dbuser := "preguntamebackenduser"
-	dbpass := "h4k3rla73n3s4d3n7r0"
-	dbhost := "localhost:5432"
-	dbname := "preguntame"
-	connstr := dbtype + "://" + dbuser + ":" + dbpass + "@" + dbhost + "/" + dbname + "?sslmode=disable";
-	slog.Info("Connection string", "connstr", connstr)
+func InitDatabase(cfg config.DatabaseConfig) error {
+	// The config redacts the password of the DSN when logged
+	slog.Info("Connecting to database", "database", cfg)
 
-	dbPool, err := sql.Open("postgres", connstr)
+	dbPool, err := sql.Open("postgres", cfg.DSN)
 	if err != nil {
 		return err
 	}
 
+	dbPool.SetMaxOpenConns(cfg.MaxOpenConns)
+	dbPool.SetMaxIdleConns(cfg.MaxIdleConns)
+	dbPool.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
 	err = dbPool.Ping()
 	if err != nil {
+		dbPool.Close()
 		return err
 	}
 
 	DbPool = dbPool
 
-	return err
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,256 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Arbitrary key used with pg_advisory_lock so only one instance migrates at a time
+const migrationLockKey = 7265677506
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt sql.NullTime
+}
+
+func (m MigrationStatus) Applied() bool {
+	return m.AppliedAt.Valid
+}
+
+// Reads the embedded sql files and returns them sorted by version
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+
+	for _, entry := range entries {
+		matches := migrationFileName.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Applies every pending migration in order and returns the ones that were applied
+func MigrateUp(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	applied := []Migration{}
+
+	err := withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		statuses, err := migrationStatus(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Applied() {
+				continue
+			}
+
+			slog.Info("Applying migration", "version", status.Version, "name", status.Name)
+			err := runMigration(ctx, conn, status.Up,
+				"INSERT INTO schema_migrations(version, name, applied_at) VALUES ($1, $2, $3)",
+				status.Version, status.Name, time.Now(),
+			)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", status.Version, status.Name, err)
+			}
+
+			applied = append(applied, status.Migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Reverts the last `steps` applied migrations, newest first
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	reverted := []Migration{}
+
+	err := withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		statuses, err := migrationStatus(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+			status := statuses[i]
+			if !status.Applied() {
+				continue
+			}
+
+			slog.Info("Reverting migration", "version", status.Version, "name", status.Name)
+			err := runMigration(ctx, conn, status.Down,
+				"DELETE FROM schema_migrations WHERE version = $1",
+				status.Version,
+			)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", status.Version, status.Name, err)
+			}
+
+			reverted = append(reverted, status.Migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Returns every known migration together with the date it was applied, if any
+func GetMigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		var err error
+		statuses, err = migrationStatus(ctx, conn)
+		return err
+	})
+
+	return statuses, err
+}
+
+func withMigrationLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	// Advisory locks belong to a session, so everything must run on the same connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+			slog.Error("Error releasing migration lock", "error", err)
+		}
+	}()
+
+	stmt := "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL)"
+	if _, err := conn.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func migrationStatus(ctx context.Context, conn *sql.Conn) ([]MigrationStatus, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := map[int64]time.Time{}
+
+	cursor, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		var version int64
+		var date time.Time
+		if err := cursor.Scan(&version, &date); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = date
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		statuses[i] = MigrationStatus{Migration: migration}
+		if date, ok := appliedAt[migration.Version]; ok {
+			statuses[i].AppliedAt = sql.NullTime{Time: date, Valid: true}
+		}
+	}
+
+	return statuses, nil
+}
+
+// Runs the migration script and the bookkeeping statement in a single transaction
+func runMigration(ctx context.Context, conn *sql.Conn, script string, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
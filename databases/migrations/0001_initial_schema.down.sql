@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS Posts;
+DROP TABLE IF EXISTS Questions;
+DROP TABLE IF EXISTS Users;
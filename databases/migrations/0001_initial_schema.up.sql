@@ -0,0 +1,28 @@
+CREATE TABLE Users (
+    id       UUID PRIMARY KEY,
+    name     TEXT NOT NULL,
+    email    TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL
+);
+
+CREATE TABLE Questions (
+    id        UUID PRIMARY KEY,
+    target_id UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    message   TEXT NOT NULL,
+    reply     TEXT,
+    favourite BOOLEAN NOT NULL DEFAULT FALSE,
+    signature TEXT
+);
+
+CREATE INDEX questions_target_id_idx ON Questions(target_id);
+
+CREATE TABLE Posts (
+    id            UUID PRIMARY KEY,
+    owner_id      UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    title         TEXT NOT NULL,
+    content       TEXT NOT NULL,
+    creation_date TIMESTAMPTZ NOT NULL,
+    deletion_date TIMESTAMPTZ
+);
+
+CREATE INDEX posts_owner_id_idx ON Posts(owner_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS RevokedAccessTokens;
+DROP TABLE IF EXISTS RefreshTokens;
@@ -0,0 +1,20 @@
+CREATE TABLE RefreshTokens (
+    id                      UUID PRIMARY KEY,
+    family_id               UUID NOT NULL,
+    user_id                 UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    token_hash              TEXT NOT NULL UNIQUE,
+    access_token_id         UUID NOT NULL,
+    access_token_expires_at TIMESTAMPTZ NOT NULL,
+    creation_date           TIMESTAMPTZ NOT NULL,
+    expiration_date         TIMESTAMPTZ NOT NULL,
+    used_date               TIMESTAMPTZ,
+    revocation_date         TIMESTAMPTZ
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON RefreshTokens(family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON RefreshTokens(user_id);
+
+CREATE TABLE RevokedAccessTokens (
+    id              UUID PRIMARY KEY,
+    expiration_date TIMESTAMPTZ NOT NULL
+);
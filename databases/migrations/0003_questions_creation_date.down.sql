@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS questions_target_id_creation_date_idx;
+ALTER TABLE Questions DROP COLUMN IF EXISTS creation_date;
@@ -0,0 +1,4 @@
+ALTER TABLE Questions ADD COLUMN creation_date TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Keyset pagination walks the questions of a user from the newest one
+CREATE INDEX questions_target_id_creation_date_idx ON Questions(target_id, creation_date DESC, id DESC);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS posts_owner_id_creation_date_idx;
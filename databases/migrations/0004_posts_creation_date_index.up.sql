@@ -0,0 +1,2 @@
+-- Keyset pagination walks the posts of a user from the newest one
+CREATE INDEX posts_owner_id_creation_date_idx ON Posts(owner_id, creation_date DESC, id DESC);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS TimelineEntries;
+
+DROP INDEX IF EXISTS questions_target_id_reply_date_idx;
+ALTER TABLE Questions DROP COLUMN IF EXISTS reply_date;
+
+DROP TABLE IF EXISTS Follows;
+
+ALTER TABLE Users DROP COLUMN IF EXISTS following_count;
+ALTER TABLE Users DROP COLUMN IF EXISTS follower_count;
@@ -0,0 +1,30 @@
+ALTER TABLE Users ADD COLUMN follower_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE Users ADD COLUMN following_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE Follows (
+    follower_id   UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    followee_id   UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    creation_date TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_follower_id_creation_date_idx ON Follows(follower_id, creation_date DESC, followee_id DESC);
+CREATE INDEX follows_followee_id_creation_date_idx ON Follows(followee_id, creation_date DESC, follower_id DESC);
+
+ALTER TABLE Questions ADD COLUMN reply_date TIMESTAMPTZ;
+UPDATE Questions SET reply_date = creation_date WHERE reply IS NOT NULL;
+CREATE INDEX questions_target_id_reply_date_idx ON Questions(target_id, reply_date DESC, id DESC) WHERE reply_date IS NOT NULL;
+
+-- Timelines materialized by fan out on write, one row per item copied to the timeline of a follower
+CREATE TABLE TimelineEntries (
+    user_id   UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    item_id   UUID NOT NULL,
+    kind      TEXT NOT NULL,
+    author_id UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    date      TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, item_id)
+);
+
+CREATE INDEX timeline_entries_user_id_date_idx ON TimelineEntries(user_id, date DESC, item_id DESC);
+CREATE INDEX timeline_entries_author_id_idx ON TimelineEntries(author_id);
@@ -0,0 +1,6 @@
+ALTER TABLE Users DROP COLUMN IF EXISTS allow_non_follower_questions;
+ALTER TABLE Users DROP COLUMN IF EXISTS allow_anonymous_questions;
+
+DROP INDEX IF EXISTS questions_asker_id_idx;
+ALTER TABLE Questions DROP COLUMN IF EXISTS anonymous;
+ALTER TABLE Questions DROP COLUMN IF EXISTS asker_id;
@@ -0,0 +1,7 @@
+-- The asker is kept even for anonymous questions so moderators can act on them
+ALTER TABLE Questions ADD COLUMN asker_id UUID REFERENCES Users(id) ON DELETE SET NULL;
+ALTER TABLE Questions ADD COLUMN anonymous BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE INDEX questions_asker_id_idx ON Questions(asker_id);
+
+ALTER TABLE Users ADD COLUMN allow_anonymous_questions BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE Users ADD COLUMN allow_non_follower_questions BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,14 @@
+CREATE TABLE Notifications (
+    id            UUID PRIMARY KEY,
+    user_id       UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    kind          TEXT NOT NULL,
+    -- Who caused it, null when it must stay anonymous
+    actor_id      UUID REFERENCES Users(id) ON DELETE SET NULL,
+    -- The question, post, etc. it's about
+    subject_id    UUID,
+    creation_date TIMESTAMPTZ NOT NULL,
+    read_date     TIMESTAMPTZ
+);
+
+CREATE INDEX notifications_user_id_creation_date_idx ON Notifications(user_id, creation_date DESC, id DESC);
+CREATE INDEX notifications_unread_idx ON Notifications(user_id) WHERE read_date IS NULL;
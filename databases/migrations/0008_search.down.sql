@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS posts_search_vector_idx;
+DROP INDEX IF EXISTS questions_search_vector_idx;
+
+ALTER TABLE Posts DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE Questions DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,17 @@
+-- Every text is indexed with both the Spanish and the English dictionaries, the reply and the title weigh more
+ALTER TABLE Questions ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('spanish'::regconfig, coalesce(reply, '')), 'A') ||
+    setweight(to_tsvector('english'::regconfig, coalesce(reply, '')), 'A') ||
+    setweight(to_tsvector('spanish'::regconfig, message), 'B') ||
+    setweight(to_tsvector('english'::regconfig, message), 'B')
+) STORED;
+
+ALTER TABLE Posts ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('spanish'::regconfig, title), 'A') ||
+    setweight(to_tsvector('english'::regconfig, title), 'A') ||
+    setweight(to_tsvector('spanish'::regconfig, content), 'B') ||
+    setweight(to_tsvector('english'::regconfig, content), 'B')
+) STORED;
+
+CREATE INDEX questions_search_vector_idx ON Questions USING GIN (search_vector);
+CREATE INDEX posts_search_vector_idx ON Posts USING GIN (search_vector);
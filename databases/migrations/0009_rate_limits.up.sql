@@ -0,0 +1,10 @@
+-- Token buckets of the postgres rate limit backend, keyed by rule and client
+CREATE TABLE RateLimitBuckets (
+    key         TEXT PRIMARY KEY,
+    tokens      DOUBLE PRECISION NOT NULL,
+    update_date TIMESTAMPTZ NOT NULL,
+    -- When the bucket is full again and can be purged
+    full_date   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_full_date_idx ON RateLimitBuckets(full_date);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS UnknownLoginFailures;
+DROP TABLE IF EXISTS LoginAttempts;
+
+ALTER TABLE Users DROP COLUMN IF EXISTS login_locked_until;
+ALTER TABLE Users DROP COLUMN IF EXISTS last_failed_login;
+ALTER TABLE Users DROP COLUMN IF EXISTS failed_logins;
@@ -0,0 +1,29 @@
+-- Failed logins since the last success, they lock the account for a while
+ALTER TABLE Users ADD COLUMN failed_logins INT NOT NULL DEFAULT 0;
+ALTER TABLE Users ADD COLUMN last_failed_login TIMESTAMPTZ;
+ALTER TABLE Users ADD COLUMN login_locked_until TIMESTAMPTZ;
+
+CREATE TABLE LoginAttempts (
+    id             UUID PRIMARY KEY,
+    -- Null when the email isn't registered
+    user_id        UUID REFERENCES Users(id) ON DELETE CASCADE,
+    email          TEXT NOT NULL,
+    ip             TEXT NOT NULL,
+    user_agent     TEXT NOT NULL,
+    success        BOOLEAN NOT NULL,
+    failure_reason TEXT,
+    creation_date  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX login_attempts_user_id_creation_date_idx ON LoginAttempts(user_id, creation_date DESC, id DESC);
+CREATE INDEX login_attempts_creation_date_idx ON LoginAttempts(creation_date);
+
+-- Failed logins on emails that aren't registered lock them like accounts, so a lock doesn't tell an email is registered
+CREATE TABLE UnknownLoginFailures (
+    email              TEXT PRIMARY KEY,
+    failed_logins      INT NOT NULL,
+    last_failed_login  TIMESTAMPTZ NOT NULL,
+    login_locked_until TIMESTAMPTZ
+);
+
+CREATE INDEX unknown_login_failures_last_failed_login_idx ON UnknownLoginFailures(last_failed_login);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS AccountTokens;
+
+ALTER TABLE Users DROP COLUMN IF EXISTS email_verification_date;
@@ -0,0 +1,15 @@
+ALTER TABLE Users ADD COLUMN email_verification_date TIMESTAMPTZ;
+
+-- Single use tokens of the verification and password reset emails
+CREATE TABLE AccountTokens (
+    id              UUID PRIMARY KEY,
+    user_id         UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    purpose         TEXT NOT NULL,
+    token_hash      TEXT NOT NULL UNIQUE,
+    creation_date   TIMESTAMPTZ NOT NULL,
+    expiration_date TIMESTAMPTZ NOT NULL,
+    used_date       TIMESTAMPTZ
+);
+
+CREATE INDEX account_tokens_user_id_purpose_idx ON AccountTokens(user_id, purpose);
+CREATE INDEX account_tokens_expiration_date_idx ON AccountTokens(expiration_date);
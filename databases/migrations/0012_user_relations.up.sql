@@ -0,0 +1,12 @@
+-- Blocks and mutes, user_id is who blocked or muted target_id
+CREATE TABLE UserRelations (
+    user_id       UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    target_id     UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    kind          TEXT NOT NULL,
+    creation_date TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, kind, target_id)
+);
+
+CREATE INDEX user_relations_user_id_creation_date_idx ON UserRelations(user_id, kind, creation_date DESC, target_id DESC);
+-- Finds who blocked a user, to hide their content from them
+CREATE INDEX user_relations_target_id_idx ON UserRelations(target_id, kind);
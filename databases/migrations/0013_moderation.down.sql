@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ModerationItems;
+ALTER TABLE Users DROP COLUMN IF EXISTS muted_words;
@@ -0,0 +1,22 @@
+-- Words and phrases each user doesn't want to receive in questions
+ALTER TABLE Users ADD COLUMN muted_words TEXT[] NOT NULL DEFAULT '{}';
+
+-- Content held for review, or dropped because of the muted words of its recipient
+CREATE TABLE ModerationItems (
+    id            UUID PRIMARY KEY,
+    kind          TEXT NOT NULL,
+    status        TEXT NOT NULL,
+    user_id       UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    author_id     UUID REFERENCES Users(id) ON DELETE SET NULL,
+    subject_id    UUID NOT NULL,
+    title         TEXT NOT NULL DEFAULT '',
+    content       TEXT NOT NULL,
+    anonymous     BOOLEAN NOT NULL DEFAULT false,
+    signature     TEXT,
+    reasons       TEXT[] NOT NULL DEFAULT '{}',
+    creation_date TIMESTAMPTZ NOT NULL,
+    review_date   TIMESTAMPTZ,
+    reviewer_id   UUID REFERENCES Users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX moderation_items_status_creation_date_idx ON ModerationItems(status, creation_date DESC, id DESC);
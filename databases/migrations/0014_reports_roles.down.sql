@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS ModeratorActions;
+DROP TABLE IF EXISTS Reports;
+ALTER TABLE Posts DROP COLUMN IF EXISTS hidden_date;
+ALTER TABLE Questions DROP COLUMN IF EXISTS hidden_date;
+ALTER TABLE Users DROP COLUMN IF EXISTS suspension_reason;
+ALTER TABLE Users DROP COLUMN IF EXISTS suspension_end;
+ALTER TABLE Users DROP COLUMN IF EXISTS suspension_date;
+ALTER TABLE Users DROP COLUMN IF EXISTS role;
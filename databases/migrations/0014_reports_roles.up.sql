@@ -0,0 +1,43 @@
+-- Roles and suspensions of the accounts
+ALTER TABLE Users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE Users ADD COLUMN suspension_date TIMESTAMPTZ;
+ALTER TABLE Users ADD COLUMN suspension_end TIMESTAMPTZ;
+ALTER TABLE Users ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';
+
+-- Content hidden by a moderator, kept for the appeals
+ALTER TABLE Questions ADD COLUMN hidden_date TIMESTAMPTZ;
+ALTER TABLE Posts ADD COLUMN hidden_date TIMESTAMPTZ;
+
+CREATE TABLE Reports (
+    id              UUID PRIMARY KEY,
+    reporter_id     UUID NOT NULL REFERENCES Users(id) ON DELETE CASCADE,
+    target_kind     TEXT NOT NULL,
+    target_id       UUID NOT NULL,
+    -- Author of the reported content, or the reported user
+    target_user_id  UUID REFERENCES Users(id) ON DELETE CASCADE,
+    reason          TEXT NOT NULL,
+    details         TEXT NOT NULL DEFAULT '',
+    status          TEXT NOT NULL,
+    note            TEXT NOT NULL DEFAULT '',
+    creation_date   TIMESTAMPTZ NOT NULL,
+    resolution_date TIMESTAMPTZ,
+    resolver_id     UUID REFERENCES Users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX reports_status_creation_date_idx ON Reports(status, creation_date DESC, id DESC);
+-- A user can only have one open report of the same content
+CREATE UNIQUE INDEX reports_open_reporter_target_idx ON Reports(reporter_id, target_kind, target_id) WHERE status = 'open';
+
+CREATE TABLE ModeratorActions (
+    id            UUID PRIMARY KEY,
+    moderator_id  UUID NOT NULL REFERENCES Users(id),
+    action        TEXT NOT NULL,
+    target_kind   TEXT NOT NULL,
+    target_id     UUID NOT NULL,
+    report_id     UUID REFERENCES Reports(id) ON DELETE SET NULL,
+    note          TEXT NOT NULL DEFAULT '',
+    creation_date TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX moderator_actions_creation_date_idx ON ModeratorActions(creation_date DESC, id DESC);
+CREATE INDEX moderator_actions_target_idx ON ModeratorActions(target_id, creation_date DESC);
@@ -0,0 +1,31 @@
+-- Append-only log of security and content relevant actions, each entry chained to the previous one by its hash
+CREATE TABLE AuditLog (
+    id              UUID PRIMARY KEY,
+    sequence        BIGINT NOT NULL UNIQUE,
+    -- No foreign key, entries must outlive the users they mention
+    actor_id        UUID,
+    action          TEXT NOT NULL,
+    target_kind     TEXT NOT NULL,
+    target_id       TEXT NOT NULL,
+    -- JSON instead of JSONB keeps the exact text, which is what the hashes cover
+    before_snapshot JSON,
+    after_snapshot  JSON,
+    creation_date   TIMESTAMPTZ NOT NULL,
+    prev_hash       TEXT NOT NULL,
+    hash            TEXT NOT NULL
+);
+
+CREATE INDEX audit_log_creation_date_idx ON AuditLog(creation_date DESC, id DESC);
+CREATE INDEX audit_log_actor_idx ON AuditLog(actor_id, creation_date DESC);
+CREATE INDEX audit_log_target_idx ON AuditLog(target_id, creation_date DESC);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'AuditLog is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON AuditLog
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON AuditLog
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
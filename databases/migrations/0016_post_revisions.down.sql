@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS PostRevisions;
+ALTER TABLE Posts DROP COLUMN IF EXISTS edit_count;
+ALTER TABLE Posts DROP COLUMN IF EXISTS edit_date;
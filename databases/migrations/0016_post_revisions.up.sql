@@ -0,0 +1,13 @@
+ALTER TABLE Posts ADD COLUMN edit_date TIMESTAMPTZ;
+ALTER TABLE Posts ADD COLUMN edit_count INTEGER NOT NULL DEFAULT 0;
+
+-- Every version of a post replaced by an edit, numbered from 1 for the one it was created with
+CREATE TABLE PostRevisions (
+    post_id          UUID NOT NULL REFERENCES Posts(id) ON DELETE CASCADE,
+    number           INTEGER NOT NULL,
+    title            TEXT NOT NULL,
+    content          TEXT NOT NULL,
+    creation_date    TIMESTAMPTZ NOT NULL,
+    replacement_date TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (post_id, number)
+);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS posts_deletion_date_idx;
+DROP INDEX IF EXISTS questions_deletion_date_idx;
+-- Deleted questions were removed for good before this migration
+DELETE FROM Questions WHERE deletion_date IS NOT null;
+ALTER TABLE Posts DROP COLUMN IF EXISTS deleter_id;
+ALTER TABLE Questions DROP COLUMN IF EXISTS deleter_id;
+ALTER TABLE Questions DROP COLUMN IF EXISTS deletion_date;
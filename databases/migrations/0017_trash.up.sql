@@ -0,0 +1,16 @@
+-- Questions are soft deleted like posts, both keep who deleted them so only owners can restore what they deleted
+ALTER TABLE Questions ADD COLUMN deletion_date TIMESTAMPTZ;
+ALTER TABLE Questions ADD COLUMN deleter_id UUID REFERENCES Users(id) ON DELETE SET NULL;
+ALTER TABLE Posts ADD COLUMN deleter_id UUID REFERENCES Users(id) ON DELETE SET NULL;
+
+-- Deletions by a moderator were recorded as moderator actions, the rest were done by the owner
+UPDATE Posts SET deleter_id = COALESCE(
+    (SELECT moderator_id FROM ModeratorActions
+     WHERE target_kind = 'post' AND target_id = Posts.id AND action = 'delete'
+     ORDER BY creation_date DESC LIMIT 1),
+    owner_id
+) WHERE deletion_date IS NOT null;
+
+-- Used by the trash and the purger
+CREATE INDEX questions_deletion_date_idx ON Questions(deletion_date) WHERE deletion_date IS NOT null;
+CREATE INDEX posts_deletion_date_idx ON Posts(deletion_date) WHERE deletion_date IS NOT null;
@@ -0,0 +1 @@
+ALTER TABLE PostRevisions DROP COLUMN IF EXISTS redacted;
@@ -0,0 +1,12 @@
+-- Versions replaced by a moderator or admin editing someone else's post, they aren't shown or restored
+ALTER TABLE PostRevisions ADD COLUMN redacted BOOLEAN NOT NULL DEFAULT false;
+
+-- Every edit is audited with the post as it was before, so the version an edit replaced is
+-- the one after the edits the post already had, and it's redacted when the editor wasn't the owner
+UPDATE PostRevisions SET redacted = true
+FROM AuditLog
+WHERE AuditLog.action = 'post.edit'
+AND AuditLog.target_kind = 'post'
+AND AuditLog.target_id = PostRevisions.post_id::text
+AND AuditLog.actor_id IS DISTINCT FROM (AuditLog.before_snapshot->>'owner_id')::uuid
+AND (AuditLog.before_snapshot->>'edit_count')::int + 1 = PostRevisions.number;
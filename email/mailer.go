@@ -0,0 +1,64 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A plain text email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+/**
+ * Encodes the message as RFC 5322 with a UTF-8 quoted-printable body. The recipient
+ * is parsed so addresses with line breaks can't inject headers.
+ */
+func (m Message) encode(from string, date time.Time) ([]byte, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+	recipient, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "From: %s\r\n", sender)
+	fmt.Fprintf(&buffer, "To: %s\r\n", recipient)
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buffer, "Message-ID: <%s@preguntame>\r\n", id)
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buffer.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	body := quotedprintable.NewWriter(&buffer)
+	if _, err := body.Write([]byte(m.Body)); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,74 @@
+package email
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Writes every email as an .eml file to a directory instead of sending it, for local development
+type FileOutbox struct {
+	dir  string
+	from string
+}
+
+func NewFileOutbox(dir string, from string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &FileOutbox{dir: dir, from: from}, nil
+}
+
+func (o *FileOutbox) Send(ctx context.Context, message Message) error {
+	now := time.Now()
+
+	content, err := message.encode(o.from, now)
+	if err != nil {
+		return err
+	}
+
+	// The nanoseconds keep the files in the order they were sent
+	file, err := os.CreateTemp(o.dir, now.Format("20060102-150405.000000000")+"-*.eml")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(content); err != nil {
+		return err
+	}
+
+	slog.Info("Email written to outbox", "to", message.To, "subject", message.Subject, "file", filepath.Base(file.Name()))
+	return file.Close()
+}
+
+// Keeps the emails in memory, for tests and when sending emails isn't configured
+type MemoryOutbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+func (o *MemoryOutbox) Send(ctx context.Context, message Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, message)
+	slog.Debug("Email kept in memory outbox", "to", message.To, "subject", message.Subject, "body", message.Body)
+	return nil
+}
+
+// Every email sent so far, oldest first
+func (o *MemoryOutbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]Message{}, o.messages...)
+}
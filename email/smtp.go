@@ -0,0 +1,57 @@
+package email
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+// Sends the emails through an SMTP server, upgrading the connection with STARTTLS when the server offers it
+type SMTPMailer struct {
+	cfg config.MailConfig
+}
+
+func NewSMTPMailer(cfg config.MailConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	content, err := message.encode(m.cfg.From, time.Now())
+	if err != nil {
+		return err
+	}
+
+	sender, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return err
+	}
+	recipient, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword.Reveal(), m.cfg.SMTPHost)
+	}
+
+	address := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+
+	// net/smtp doesn't take a context, the send is abandoned but not interrupted when it's done
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(address, auth, sender.Address, []string{recipient.Address}, content)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
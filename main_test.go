@@ -0,0 +1,1006 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/config"
+	"github.com/preguntame/preguntame-backend/controllers"
+	"github.com/preguntame/preguntame-backend/email"
+	"github.com/preguntame/preguntame-backend/models"
+	"github.com/preguntame/preguntame-backend/notifications"
+	"github.com/preguntame/preguntame-backend/ratelimit"
+	"github.com/preguntame/preguntame-backend/timeline"
+	"github.com/preguntame/preguntame-backend/trash"
+)
+
+const testPassword = "Abcdefg1"
+
+// The whole server on top of the memory store, built like main does
+type testServer struct {
+	t      *testing.T
+	e      *echo.Echo
+	c      *controllers.Controller
+	store  *models.MemoryStore
+	outbox *email.MemoryOutbox
+	bin    *trash.Trash
+}
+
+const testAuditKey = "fedcba9876543210fedcba9876543210"
+
+func newTestServer(t *testing.T, configure ...func(cfg *config.Config)) *testServer {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Server.Store = config.StoreMemory
+	cfg.Auth.JWTSecret = "0123456789abcdef0123456789abcdef"
+	cfg.Audit.HMACKey = testAuditKey
+	// The cheapest hashes, the tests don't need them to be slow
+	cfg.Passwords.Algorithm = config.PasswordBcrypt
+	cfg.Passwords.BcryptCost = 4
+	cfg.RateLimits.Register.Requests = 0
+	cfg.RateLimits.Login.Requests = 0
+	for _, apply := range configure {
+		apply(&cfg)
+	}
+
+	store := models.NewMemoryStore()
+
+	passwords, err := auth.NewPasswords(cfg.Passwords)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err := auth.NewAuthenticator(cfg.Auth, store, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logins := auth.NewLoginGuard(cfg.Logins, store)
+	moderator, err := newModerator(cfg.Moderation, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := trash.New(cfg.Trash, store)
+	outbox := email.NewMemoryOutbox()
+	accounts := auth.NewAccounts(cfg.Accounts, store, store, passwords, logins, authenticator, outbox)
+
+	c := controllers.NewController(
+		store,
+		authenticator,
+		passwords,
+		logins,
+		accounts,
+		timeline.NewTimeline(cfg.Timeline, store, store, store),
+		notifications.NewNotifier(cfg.Notifications, store, store, notifications.NewLocalBroker()),
+		moderator,
+		bin,
+		[]byte(cfg.Audit.HMACKey.Reveal()),
+	)
+
+	e := newEcho(&cfg)
+	registerRoutes(e, c, authenticator, ratelimit.NewLimiter(cfg.RateLimits, ratelimit.NewMemoryBackend()))
+
+	return &testServer{t: t, e: e, c: c, store: store, outbox: outbox, bin: bin}
+}
+
+// Sends the request with the token as bearer when it isn't empty and body encoded as JSON when it isn't nil
+func (s *testServer) do(method string, path string, token string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	encoded := []byte{}
+	if body != nil {
+		var err error
+		if encoded, err = json.Marshal(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.e.ServeHTTP(rec, req)
+	return rec
+}
+
+// Fails the test unless the response has the status, returns the response for further checks
+func (s *testServer) expect(rec *httptest.ResponseRecorder, status int) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	if rec.Code != status {
+		s.t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body.String())
+	}
+	return rec
+}
+
+func (s *testServer) decode(rec *httptest.ResponseRecorder, into any) {
+	s.t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), into); err != nil {
+		s.t.Fatalf("decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+// Registers a user and returns their id and an access token
+func (s *testServer) register(name string, role models.Role) (models.UserID, string) {
+	s.t.Helper()
+
+	userEmail := name + "@example.com"
+	s.expect(s.do(http.MethodPost, "/users/register", "", map[string]string{
+		"name": name, "email": userEmail, "password": testPassword,
+	}), http.StatusOK)
+
+	user, err := s.store.FindUserByEmail(context.Background(), userEmail)
+	if err != nil || user == nil {
+		s.t.Fatalf("registered user not found: %v", err)
+	}
+	if role != models.RoleUser {
+		if _, err := s.store.UpdateUserRole(context.Background(), user.Id, role); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+
+	return user.Id, s.login(name)
+}
+
+func (s *testServer) login(name string) string {
+	s.t.Helper()
+
+	tokens := auth.TokenPair{}
+	s.decode(s.expect(s.do(http.MethodPost, "/users/login", "", map[string]string{
+		"email": name + "@example.com", "password": testPassword,
+	}), http.StatusOK), &tokens)
+
+	return tokens.AccessToken
+}
+
+// The fields of the questions and posts the tests look at
+type testItem struct {
+	Id        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Message   string     `json:"message"`
+	Reply     *string    `json:"reply"`
+	Title     string     `json:"title"`
+	Content   string     `json:"content"`
+	DeletedAt *time.Time `json:"deleted_at"`
+	Redacted  bool       `json:"redacted"`
+}
+
+func (s *testServer) list(path string, token string) []testItem {
+	s.t.Helper()
+
+	page := struct {
+		Items []testItem `json:"items"`
+	}{}
+	s.decode(s.expect(s.do(http.MethodGet, path, token, nil), http.StatusOK), &page)
+	return page.Items
+}
+
+func (s *testServer) askQuestion(userId models.UserID, message string) models.QuestionID {
+	s.t.Helper()
+
+	s.expect(s.do(http.MethodPost, "/users/"+userId+"/questions", "", map[string]string{"message": message}), http.StatusOK)
+	for _, question := range s.list("/users/"+userId+"/questions", "") {
+		if question.Message == message {
+			return question.Id
+		}
+	}
+
+	s.t.Fatalf("asked question %q not listed", message)
+	return ""
+}
+
+func (s *testServer) createPost(ownerId models.UserID, token string, content string) models.PostID {
+	s.t.Helper()
+
+	s.expect(s.do(http.MethodPost, "/users/"+ownerId+"/posts", token, map[string]string{"title": "Title", "content": content}), http.StatusOK)
+	for _, post := range s.list("/users/"+ownerId+"/posts", token) {
+		if post.Content == content {
+			return post.Id
+		}
+	}
+
+	s.t.Fatalf("created post %q not listed", content)
+	return ""
+}
+
+// Waits for the emails sent after the response and returns the token of the link of the last one with the subject
+func (s *testServer) emailedToken(subject string) string {
+	s.t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		messages := s.outbox.Messages()
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].Subject != subject {
+				continue
+			}
+			for _, field := range strings.Fields(messages[i].Body) {
+				if link, err := url.Parse(field); err == nil && link.Query().Has("token") {
+					return link.Query().Get("token")
+				}
+			}
+		}
+	}
+
+	s.t.Fatalf("no email %q with a token was sent", subject)
+	return ""
+}
+
+// Records a response that streams, flushed is closed on the first flush
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+	flushed chan struct{}
+	once    sync.Once
+}
+
+func (r *streamRecorder) Flush() {
+	r.ResponseRecorder.Flush()
+	r.once.Do(func() { close(r.flushed) })
+}
+
+// Opens the notifications stream, returns once it started and a channel closed when it ends
+func (s *testServer) openStream(token string) (*streamRecorder, <-chan struct{}) {
+	s.t.Helper()
+
+	rec := &streamRecorder{ResponseRecorder: httptest.NewRecorder(), flushed: make(chan struct{})}
+	ended := make(chan struct{})
+	go func() {
+		defer close(ended)
+		s.e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/me/notifications/stream?access_token="+token, nil))
+	}()
+
+	select {
+	case <-rec.flushed:
+	case <-ended:
+		s.t.Fatalf("stream didn't open: %d %s", rec.Code, rec.Body.String())
+	}
+	return rec, ended
+}
+
+func TestAskedQuestionsAreListed(t *testing.T) {
+	s := newTestServer(t)
+	anaId, _ := s.register("ana", models.RoleUser)
+	bobId, _ := s.register("bob", models.RoleUser)
+
+	s.askQuestion(anaId, "What is your favourite book?")
+	s.askQuestion(anaId, "Where did you grow up?")
+	s.askQuestion(bobId, "What do you do for a living?")
+
+	questions := s.list("/users/"+anaId+"/questions", "")
+	if len(questions) != 2 || questions[0].Message != "Where did you grow up?" || questions[1].Message != "What is your favourite book?" {
+		t.Fatalf("questions = %+v, want ana's two, the last asked first", questions)
+	}
+	if questions[0].Reply != nil {
+		t.Errorf("unanswered question has a reply: %q", *questions[0].Reply)
+	}
+
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/questions", "", map[string]string{"message": "Short"}), http.StatusBadRequest)
+	if questions := s.list("/users/"+anaId+"/questions", ""); len(questions) != 2 {
+		t.Fatalf("rejected question was stored: %+v", questions)
+	}
+}
+
+func TestQuestionsAreRepliedOnce(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+
+	questionId := s.askQuestion(anaId, "What is your favourite book?")
+	question := "/users/" + anaId + "/questions/" + questionId
+
+	s.expect(s.do(http.MethodPut, question, ana, map[string]string{"message": "Don Quijote, of course"}), http.StatusOK)
+	s.expect(s.do(http.MethodPut, question, ana, map[string]string{"message": "Rayuela, on second thought"}), http.StatusNotFound)
+
+	questions := s.list("/users/"+anaId+"/questions", "")
+	if questions[0].Reply == nil || *questions[0].Reply != "Don Quijote, of course" {
+		t.Fatalf("reply = %v, want the first one", questions[0].Reply)
+	}
+}
+
+func TestOnlyTheRecipientActsOnQuestions(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	_, bob := s.register("bob", models.RoleUser)
+
+	question := "/users/" + anaId + "/questions/" + s.askQuestion(anaId, "What is your favourite book?")
+	reply := map[string]string{"message": "Don Quijote, of course"}
+
+	s.expect(s.do(http.MethodPut, question, "", reply), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPut, question, bob, reply), http.StatusForbidden)
+	s.expect(s.do(http.MethodPut, question+"/fav", bob, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, question, bob, nil), http.StatusForbidden)
+
+	s.expect(s.do(http.MethodPut, question+"/fav", ana, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPut, "/users/"+anaId+"/questions/44444444-4444-4444-4444-444444444444/fav", ana, nil), http.StatusNotFound)
+}
+
+func TestDeletedQuestionsAreNotListed(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+
+	kept := s.askQuestion(anaId, "What is your favourite book?")
+	question := "/users/" + anaId + "/questions/" + s.askQuestion(anaId, "Where did you grow up?")
+
+	s.expect(s.do(http.MethodDelete, question, ana, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, question, ana, nil), http.StatusNotFound)
+
+	if questions := s.list("/users/"+anaId+"/questions", ""); len(questions) != 1 || questions[0].Id != kept {
+		t.Fatalf("questions = %+v, want only the one kept", questions)
+	}
+}
+
+func TestSoftDeletedPostsCantBeChanged(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	_, bob := s.register("bob", models.RoleUser)
+
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/posts", ana, map[string]string{"title": "Title", "content": "Ana's first post"}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/posts", bob, map[string]string{"title": "Title", "content": "Bob on Ana's feed"}), http.StatusForbidden)
+
+	post := "/users/" + anaId + "/posts/" + s.createPost(anaId, ana, "Ana's second post")
+	edit := map[string]string{"title": "Edited", "content": "Edited content"}
+
+	s.expect(s.do(http.MethodPatch, post, bob, edit), http.StatusForbidden)
+	s.expect(s.do(http.MethodPatch, post, ana, edit), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, post, bob, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, post, ana, nil), http.StatusOK)
+
+	s.expect(s.do(http.MethodPatch, post, ana, edit), http.StatusNotFound)
+	s.expect(s.do(http.MethodDelete, post, ana, nil), http.StatusNotFound)
+}
+
+func TestBcryptPasswordsAreCappedAt72Bytes(t *testing.T) {
+	s := newTestServer(t)
+
+	long := testPassword + strings.Repeat("x", 73-len(testPassword))
+	rec := s.expect(s.do(http.MethodPost, "/users/register", "", map[string]string{
+		"name": "ana", "email": "ana@example.com", "password": long,
+	}), http.StatusBadRequest)
+	if !strings.Contains(rec.Body.String(), "too_long") {
+		t.Errorf("unexpected error: %s", rec.Body.String())
+	}
+
+	s.expect(s.do(http.MethodPost, "/users/register", "", map[string]string{
+		"name": "ana", "email": "ana@example.com", "password": long[:72],
+	}), http.StatusOK)
+}
+
+func TestArgon2idPasswordsAreNotCapped(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Passwords.Algorithm = config.PasswordArgon2id
+		cfg.Passwords.Argon2Memory = 8 * 1024
+	})
+
+	s.expect(s.do(http.MethodPost, "/users/register", "", map[string]string{
+		"name": "ana", "email": "ana@example.com", "password": testPassword + strings.Repeat("x", 100),
+	}), http.StatusOK)
+}
+
+func TestDeletedPostsAreOnlyShownToTheirOwner(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	_, bob := s.register("bob", models.RoleUser)
+
+	kept := s.createPost(anaId, ana, "Ana's first post")
+	deleted := s.createPost(anaId, ana, "Ana's second post")
+	s.expect(s.do(http.MethodDelete, "/users/"+anaId+"/posts/"+deleted, ana, nil), http.StatusOK)
+
+	for _, viewer := range []string{"", bob} {
+		if posts := s.list("/users/"+anaId+"/posts", viewer); len(posts) != 1 || posts[0].Id != kept {
+			t.Fatalf("posts = %+v, want only the one kept", posts)
+		}
+		s.expect(s.do(http.MethodGet, "/users/"+anaId+"/posts/"+kept, viewer, nil), http.StatusOK)
+		s.expect(s.do(http.MethodGet, "/users/"+anaId+"/posts/"+deleted, viewer, nil), http.StatusNotFound)
+	}
+
+	posts := s.list("/users/"+anaId+"/posts", ana)
+	if len(posts) != 2 || posts[0].Id != deleted || posts[0].DeletedAt == nil {
+		t.Fatalf("posts = %+v, want both for the owner, the deleted one marked", posts)
+	}
+	s.expect(s.do(http.MethodGet, "/users/"+anaId+"/posts/"+deleted, ana, nil), http.StatusOK)
+}
+
+func TestTimelineShowsWhatFollowedUsersPublish(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	bobId, bob := s.register("bob", models.RoleUser)
+	_, carla := s.register("carla", models.RoleUser)
+
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/follow", bob, nil), http.StatusOK)
+
+	s.createPost(anaId, ana, "Ana's first post")
+	question := "/users/" + anaId + "/questions/" + s.askQuestion(anaId, "What is your favourite book?")
+	s.askQuestion(anaId, "Where did you grow up?")
+	s.expect(s.do(http.MethodPut, question, ana, map[string]string{"message": "Don Quijote, of course"}), http.StatusOK)
+	s.createPost(bobId, bob, "Bob's own post")
+
+	// Unanswered questions and the user's own posts stay out
+	items := s.list("/me/timeline", bob)
+	if len(items) != 2 || items[0].Kind != "answer" || items[1].Kind != "post" {
+		t.Fatalf("timeline = %+v, want the answer and then the post", items)
+	}
+
+	if items := s.list("/me/timeline", carla); len(items) != 0 {
+		t.Fatalf("timeline of someone following nobody = %+v", items)
+	}
+}
+
+func TestSearchReportsEachFieldOutOfRange(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		fields []string
+	}{
+		{"limit", "&limit=1000", []string{"limit"}},
+		{"negative offset", "&offset=-1", []string{"offset"}},
+		{"offset past the last page", "&offset=100000", []string{"offset"}},
+		{"both", "&limit=-1&offset=100000", []string{"limit", "offset"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := struct {
+				Error struct {
+					Details []struct {
+						Field string `json:"field"`
+					} `json:"details"`
+				} `json:"error"`
+			}{}
+			s.decode(s.expect(s.do(http.MethodGet, "/search?q=hola"+test.query, "", nil), http.StatusBadRequest), &response)
+
+			fields := []string{}
+			for _, detail := range response.Error.Details {
+				fields = append(fields, detail.Field)
+			}
+			if !slices.Equal(fields, test.fields) {
+				t.Errorf("fields = %v, want %v", fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestLoginsPastTheLimitAreRejected(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.RateLimits.Login = config.RateLimit{Requests: 2, Per: time.Hour}
+	})
+	s.register("alice", models.RoleUser)
+
+	// register already spent one of the two logins
+	s.login("alice")
+	rec := s.expect(s.do(http.MethodPost, "/users/login", "", map[string]string{
+		"email": "alice@example.com", "password": testPassword,
+	}), http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("rejected login without Retry-After")
+	}
+}
+
+func TestLockedUnknownEmailsLookLikeLockedAccounts(t *testing.T) {
+	s := newTestServer(t)
+	s.register("ana", models.RoleUser)
+
+	statuses := func(userEmail string) []int {
+		codes := []int{}
+		for i := 0; i < 6; i++ {
+			rec := s.do(http.MethodPost, "/users/login", "", map[string]string{"email": userEmail, "password": "Wrong1234"})
+			codes = append(codes, rec.Code)
+		}
+		return codes
+	}
+
+	registered := statuses("ana@example.com")
+	unknown := statuses("nobody@example.com")
+
+	if registered[len(registered)-1] != http.StatusTooManyRequests {
+		t.Fatalf("the account wasn't locked: %v", registered)
+	}
+	for i := range registered {
+		if registered[i] != unknown[i] {
+			t.Fatalf("registered %v and unknown %v emails answer differently", registered, unknown)
+		}
+	}
+}
+
+func TestPasswordResetLinksWorkOnce(t *testing.T) {
+	s := newTestServer(t)
+	s.register("ana", models.RoleUser)
+
+	s.expect(s.do(http.MethodPost, "/users/password/forgot", "", map[string]string{"email": "ana@example.com"}), http.StatusAccepted)
+	token := s.emailedToken("Cambia tu contraseña de Preguntame")
+
+	reset := map[string]string{"token": token, "password": "Hgfedcb2"}
+	s.expect(s.do(http.MethodPost, "/users/password/reset", "", reset), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/users/password/reset", "", reset), http.StatusBadRequest)
+
+	s.expect(s.do(http.MethodPost, "/users/login", "", map[string]string{
+		"email": "ana@example.com", "password": testPassword,
+	}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/users/login", "", map[string]string{
+		"email": "ana@example.com", "password": "Hgfedcb2",
+	}), http.StatusOK)
+}
+
+func TestBlockedUsersCantAsk(t *testing.T) {
+	s := newTestServer(t)
+	anaId, anaToken := s.register("ana", models.RoleUser)
+	beaId, beaToken := s.register("bea", models.RoleUser)
+
+	s.expect(s.do(http.MethodPost, "/users/"+beaId+"/block", anaToken, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/questions", beaToken, map[string]string{"message": "Still there?"}), http.StatusForbidden)
+
+	s.expect(s.do(http.MethodDelete, "/users/"+beaId+"/block", anaToken, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, "/users/"+beaId+"/block", anaToken, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/questions", beaToken, map[string]string{"message": "Still there?"}), http.StatusOK)
+}
+
+func TestBlocklistedQuestionsAreHeld(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Moderation.Blocklist = []string{"forbidden words"}
+	})
+	anaId, _ := s.register("ana", models.RoleUser)
+
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/questions", "", map[string]string{"message": "Some FORBIDDEN  words here"}), http.StatusAccepted)
+	s.askQuestion(anaId, "Nothing to see here")
+
+	questions := s.list("/users/"+anaId+"/questions", "")
+	if len(questions) != 1 {
+		t.Fatalf("questions = %+v, want only the one that wasn't held", questions)
+	}
+}
+
+func TestModeratorsHideReportedQuestions(t *testing.T) {
+	s := newTestServer(t)
+	anaId, _ := s.register("ana", models.RoleUser)
+	beaId, beaToken := s.register("bea", models.RoleUser)
+	_, modToken := s.register("mod", models.RoleModerator)
+	_, adminToken := s.register("admin", models.RoleAdmin)
+	questionId := s.askQuestion(anaId, "Something rude to report")
+
+	report := map[string]string{"target_kind": "question", "target_id": questionId, "reason": "harassment"}
+	s.expect(s.do(http.MethodPost, "/reports", beaToken, report), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/reports", beaToken, report), http.StatusConflict)
+
+	s.expect(s.do(http.MethodGet, "/admin/reports", beaToken, nil), http.StatusForbidden)
+	if reports := s.list("/admin/reports", modToken); len(reports) != 1 {
+		t.Fatalf("reports = %+v, want the one sent", reports)
+	}
+
+	s.expect(s.do(http.MethodPost, "/admin/questions/"+questionId+"/hide", modToken, map[string]string{}), http.StatusOK)
+	if questions := s.list("/users/"+anaId+"/questions", ""); len(questions) != 0 {
+		t.Fatalf("questions = %+v, want the hidden one left out", questions)
+	}
+
+	role := map[string]string{"role": "moderator"}
+	s.expect(s.do(http.MethodPut, "/admin/users/"+beaId+"/role", modToken, role), http.StatusForbidden)
+	s.expect(s.do(http.MethodPut, "/admin/users/"+beaId+"/role", adminToken, role), http.StatusOK)
+}
+
+func TestOwnerRoutesNeedThePermission(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	_, bob := s.register("bob", models.RoleUser)
+	_, moderator := s.register("mod", models.RoleModerator)
+	_, admin := s.register("admin", models.RoleAdmin)
+
+	postId := s.createPost(anaId, ana, "Ana's first post")
+	post := "/users/" + anaId + "/posts/" + postId
+	edit := map[string]string{"title": "Edited", "content": "Edited content"}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		want   int
+	}{
+		{"anonymous can't post", http.MethodPost, "/users/" + anaId + "/posts", "", edit, http.StatusUnauthorized},
+		{"others can't post on the feed", http.MethodPost, "/users/" + anaId + "/posts", bob, edit, http.StatusForbidden},
+		{"moderators can't post on the feed", http.MethodPost, "/users/" + anaId + "/posts", moderator, edit, http.StatusForbidden},
+		{"others can't edit", http.MethodPatch, post, bob, edit, http.StatusForbidden},
+		{"moderators can't edit", http.MethodPatch, post, moderator, edit, http.StatusForbidden},
+		{"others can't delete", http.MethodDelete, post, bob, nil, http.StatusForbidden},
+		{"others can't restore a revision", http.MethodPost, post + "/revisions/1/restore", bob, nil, http.StatusForbidden},
+		{"admins edit anyone's post", http.MethodPatch, post, admin, edit, http.StatusOK},
+		{"admins can't restore another's revision", http.MethodPost, post + "/revisions/1/restore", admin, nil, http.StatusForbidden},
+		{"moderators delete anyone's post", http.MethodDelete, post, moderator, nil, http.StatusOK},
+		{"others can't restore from the trash", http.MethodPost, post + "/restore", bob, nil, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s.t = t
+			s.expect(s.do(test.method, test.path, test.token, test.body), test.want)
+		})
+	}
+}
+
+func TestQuestionRoutesNeedThePermission(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	_, bob := s.register("bob", models.RoleUser)
+	_, moderator := s.register("mod", models.RoleModerator)
+
+	questionId := s.askQuestion(anaId, "What is your favourite book?")
+	question := "/users/" + anaId + "/questions/" + questionId
+	reply := map[string]string{"message": "Don Quijote, of course"}
+
+	s.expect(s.do(http.MethodPut, question, bob, reply), http.StatusForbidden)
+	s.expect(s.do(http.MethodPut, question, moderator, reply), http.StatusForbidden)
+	s.expect(s.do(http.MethodPut, question+"/fav", bob, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPut, question, ana, reply), http.StatusOK)
+	s.expect(s.do(http.MethodPut, question+"/fav", ana, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, question, bob, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, question, moderator, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, "/users/"+anaId+"/questions/"+s.askQuestion(anaId, "Another question here"), ana, nil), http.StatusOK)
+}
+
+func TestDemotionTakesEffectRightAway(t *testing.T) {
+	s := newTestServer(t)
+	modId, moderator := s.register("mod", models.RoleModerator)
+
+	s.expect(s.do(http.MethodGet, "/admin/reports", moderator, nil), http.StatusOK)
+
+	// Changed in the store, so the sessions stay open and the token keeps the old role
+	if _, err := s.store.UpdateUserRole(context.Background(), modId, models.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expect(s.do(http.MethodGet, "/admin/reports", moderator, nil), http.StatusForbidden)
+}
+
+func TestAuditLogRecordsChangesInAChain(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	_, admin := s.register("admin", models.RoleAdmin)
+
+	postId := s.createPost(anaId, ana, "Ana's first post")
+	s.expect(s.do(http.MethodPatch, "/users/"+anaId+"/posts/"+postId, ana, map[string]string{"title": "Edited", "content": "Edited content"}), http.StatusOK)
+
+	s.expect(s.do(http.MethodGet, "/admin/audit", ana, nil), http.StatusForbidden)
+
+	page := struct {
+		Items []struct {
+			ActorId  *string `json:"actor_id"`
+			TargetId string  `json:"target_id"`
+		} `json:"items"`
+	}{}
+	s.decode(s.expect(s.do(http.MethodGet, "/admin/audit?action=post.edit", admin, nil), http.StatusOK), &page)
+	if len(page.Items) != 1 || page.Items[0].TargetId != postId || page.Items[0].ActorId == nil || *page.Items[0].ActorId != anaId {
+		t.Fatalf("post.edit entries = %+v, want ana's edit", page.Items)
+	}
+
+	if err := runVerifyAudit(s.store, []byte(testAuditKey)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Returns the chain with the entry of a sequence changed by tamper
+type tamperedAuditLog struct {
+	models.AuditStore
+	sequence int64
+	tamper   func(entry *models.AuditEntry)
+}
+
+func (t tamperedAuditLog) FindAuditChain(ctx context.Context, afterSequence int64, limit int) ([]models.AuditEntry, error) {
+	entries, err := t.AuditStore.FindAuditChain(ctx, afterSequence, limit)
+	for i := range entries {
+		if entries[i].Sequence == t.sequence {
+			t.tamper(&entries[i])
+		}
+	}
+	return entries, err
+}
+
+func TestVerifyAuditDetectsTamperingAndTheWrongKey(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	s.createPost(anaId, ana, "Ana's first post")
+
+	entries, err := s.store.FindAuditChain(context.Background(), 0, 100)
+	if err != nil || len(entries) < 2 {
+		t.Fatalf("entries = %+v, err = %v", entries, err)
+	}
+	// Whoever can write to the database can recompute the hash, but not without the key
+	rehashed := func(entry *models.AuditEntry) {
+		entry.TargetId = "someone-else"
+		entry.Hash = entry.ComputeHash([]byte("not-the-key-not-the-key-not-the"))
+	}
+
+	tests := []struct {
+		name  string
+		store models.AuditStore
+		key   string
+	}{
+		{"wrong key", s.store, "another-key-another-key-another-k"},
+		{"changed contents", tamperedAuditLog{s.store, 1, func(entry *models.AuditEntry) { entry.TargetId = "someone-else" }}, testAuditKey},
+		{"rehashed without the key", tamperedAuditLog{s.store, 1, rehashed}, testAuditKey},
+		{"removed entry", tamperedAuditLog{s.store, 2, func(entry *models.AuditEntry) { entry.Sequence = 3 }}, testAuditKey},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := runVerifyAudit(test.store, []byte(test.key)); err == nil {
+				t.Error("the chain was verified")
+			}
+		})
+	}
+}
+
+// Fails every append to the audit log
+type failingAuditLog struct {
+	models.AuditStore
+}
+
+func (failingAuditLog) AppendAuditEntry(ctx context.Context, entry models.AuditEntry, key []byte) (models.AuditEntry, error) {
+	return entry, errors.New("audit log unavailable")
+}
+
+func TestActionsThatCantBeAuditedFail(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	postId := s.createPost(anaId, ana, "Ana's first post")
+
+	s.c.AuditLog = failingAuditLog{s.store}
+
+	s.expect(s.do(http.MethodPatch, "/users/"+anaId+"/posts/"+postId, ana, map[string]string{"title": "Edited", "content": "Edited content"}), http.StatusInternalServerError)
+	s.expect(s.do(http.MethodPost, "/users/login", "", map[string]string{"email": "ana@example.com", "password": "Wrong1234"}), http.StatusInternalServerError)
+}
+
+func TestPostRevisionsCanBeRestored(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+
+	postId := s.createPost(anaId, ana, "First version")
+	post := "/users/" + anaId + "/posts/" + postId
+	s.expect(s.do(http.MethodPatch, post, ana, map[string]string{"title": "Title", "content": "Second version"}), http.StatusOK)
+
+	revisions := s.list(post+"/revisions", "")
+	if len(revisions) != 1 || revisions[0].Content != "First version" {
+		t.Fatalf("revisions = %+v, want the first version", revisions)
+	}
+
+	s.expect(s.do(http.MethodPost, post+"/revisions/9/restore", ana, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodPost, post+"/revisions/1/restore", ana, nil), http.StatusOK)
+
+	restored := testItem{}
+	s.decode(s.expect(s.do(http.MethodGet, post, "", nil), http.StatusOK), &restored)
+	if restored.Content != "First version" {
+		t.Fatalf("content = %q, want the restored version", restored.Content)
+	}
+	// Restoring is an edit too, so the replaced version is kept
+	if revisions := s.list(post+"/revisions", ""); len(revisions) != 2 || revisions[0].Content != "Second version" {
+		t.Fatalf("revisions = %+v, want the second version on top", revisions)
+	}
+}
+
+func TestTrashRestoresWhatTheOwnerDeleted(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+
+	questionId := s.askQuestion(anaId, "Do you like the trash?")
+	postId := s.createPost(anaId, ana, "Soon in the trash")
+
+	s.expect(s.do(http.MethodDelete, "/users/"+anaId+"/questions/"+questionId, ana, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, "/users/"+anaId+"/posts/"+postId, ana, nil), http.StatusOK)
+
+	if questions := s.list("/users/"+anaId+"/questions", ana); len(questions) != 0 {
+		t.Fatalf("deleted question still listed: %v", questions)
+	}
+
+	trashed := s.list("/me/trash", ana)
+	if len(trashed) != 2 || trashed[0].Kind != "post" || trashed[1].Kind != "question" {
+		t.Fatalf("trash = %+v, want the post and then the question", trashed)
+	}
+
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/questions/"+questionId+"/restore", ana, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/questions/"+questionId+"/restore", ana, nil), http.StatusNotFound)
+
+	if questions := s.list("/users/"+anaId+"/questions", ana); len(questions) != 1 {
+		t.Fatalf("restored question not listed: %v", questions)
+	}
+	if trashed := s.list("/me/trash", ana); len(trashed) != 1 {
+		t.Fatalf("trash = %+v, want only the post", trashed)
+	}
+}
+
+func TestTrashLeavesOutModeratorDeletions(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	_, moderator := s.register("mod", models.RoleModerator)
+
+	postId := s.createPost(anaId, ana, "Against the rules")
+	s.expect(s.do(http.MethodDelete, "/users/"+anaId+"/posts/"+postId, moderator, nil), http.StatusOK)
+
+	if trashed := s.list("/me/trash", ana); len(trashed) != 0 {
+		t.Fatalf("trash = %+v, want it empty", trashed)
+	}
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/posts/"+postId+"/restore", ana, nil), http.StatusNotFound)
+}
+
+func TestPurgedContentCantBeRestored(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Trash.Retention = time.Hour
+		cfg.Trash.PurgeBatchSize = 1
+	})
+	anaId, ana := s.register("ana", models.RoleUser)
+
+	postIds := []models.PostID{s.createPost(anaId, ana, "First post"), s.createPost(anaId, ana, "Second post")}
+	for _, postId := range postIds {
+		s.expect(s.do(http.MethodDelete, "/users/"+anaId+"/posts/"+postId, ana, nil), http.StatusOK)
+	}
+
+	purged, err := s.bin.Purge(context.Background(), time.Now())
+	if err != nil || purged != 0 {
+		t.Fatalf("purged %d (%v) within the retention", purged, err)
+	}
+
+	purged, err = s.bin.Purge(context.Background(), time.Now().Add(2*time.Hour))
+	if err != nil || purged != 2 {
+		t.Fatalf("purged %d (%v), want both posts in batches of one", purged, err)
+	}
+
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/posts/"+postIds[0]+"/restore", ana, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodGet, "/users/"+anaId+"/posts/"+postIds[0], ana, nil), http.StatusNotFound)
+}
+
+func TestRedactedRevisionsAreHiddenAndCantBeRestored(t *testing.T) {
+	s := newTestServer(t)
+	anaId, ana := s.register("ana", models.RoleUser)
+	_, moderator := s.register("mod", models.RoleModerator)
+	_, admin := s.register("admin", models.RoleAdmin)
+
+	postId := s.createPost(anaId, ana, "Something that breaks the rules")
+	post := "/users/" + anaId + "/posts/" + postId
+	s.expect(s.do(http.MethodPatch, post, admin, map[string]string{"title": "Title", "content": "Removed by a moderator"}), http.StatusOK)
+	s.expect(s.do(http.MethodPatch, post, ana, map[string]string{"title": "Title", "content": "Something else"}), http.StatusOK)
+
+	public := s.list(post+"/revisions", "")
+	if len(public) != 2 || public[0].Redacted || public[0].Content != "Removed by a moderator" {
+		t.Fatalf("revisions = %+v, want the admin's version first", public)
+	}
+	if !public[1].Redacted || public[1].Content != "" || public[1].Title != "" {
+		t.Fatalf("redacted revision shown: %+v", public[1])
+	}
+
+	if moderated := s.list(post+"/revisions", moderator); moderated[1].Content != "Something that breaks the rules" {
+		t.Fatalf("moderators don't see the redacted revision: %+v", moderated[1])
+	}
+
+	s.expect(s.do(http.MethodPost, post+"/revisions/1/restore", ana, nil), http.StatusForbidden)
+	s.expect(s.do(http.MethodPost, post+"/revisions/2/restore", ana, nil), http.StatusOK)
+}
+
+func TestRestoredRevisionsAreScreened(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Moderation.Blocklist = []string{"palabrota"}
+	})
+	anaId, ana := s.register("ana", models.RoleUser)
+
+	// Stored directly, as if it was written before the word was in the list
+	post := models.Post{Id: "33333333-3333-3333-3333-333333333333", OwnerId: anaId, Title: "Title", Content: "una palabrota", CreationDate: time.Now()}
+	if err := s.store.InsertPost(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/users/" + anaId + "/posts/" + post.Id
+	s.expect(s.do(http.MethodPatch, path, ana, map[string]string{"title": "Title", "content": "una palabra"}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, path+"/revisions/1/restore", ana, nil), http.StatusAccepted)
+
+	current := testItem{}
+	s.decode(s.expect(s.do(http.MethodGet, path, "", nil), http.StatusOK), &current)
+	if current.Content != "una palabra" {
+		t.Fatalf("held restore was applied: %+v", current)
+	}
+}
+
+func TestApprovedContentIsOnlyApprovedOnceDelivered(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Moderation.Blocklist = []string{"palabrota"}
+	})
+	anaId, ana := s.register("ana", models.RoleUser)
+	_, moderator := s.register("mod", models.RoleModerator)
+
+	s.expect(s.do(http.MethodPost, "/users/"+anaId+"/questions", "", map[string]string{"message": "Una palabrota"}), http.StatusAccepted)
+	held := s.list("/admin/moderation", moderator)
+	if len(held) != 1 {
+		t.Fatalf("held = %+v, want the question", held)
+	}
+	s.expect(s.do(http.MethodPost, "/admin/moderation/"+held[0].Id+"/approve", moderator, nil), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/admin/moderation/"+held[0].Id+"/approve", moderator, nil), http.StatusConflict)
+
+	questions := s.list("/users/"+anaId+"/questions", "")
+	if len(questions) != 1 {
+		t.Fatalf("questions = %+v, want the approved one", questions)
+	}
+
+	// The reply is held and the question deleted before it's reviewed
+	question := "/users/" + anaId + "/questions/" + questions[0].Id
+	s.expect(s.do(http.MethodPut, question, ana, map[string]string{"message": "Otra palabrota"}), http.StatusAccepted)
+	s.expect(s.do(http.MethodDelete, question, ana, nil), http.StatusOK)
+
+	held = s.list("/admin/moderation", moderator)
+	if len(held) != 1 {
+		t.Fatalf("held = %+v, want the reply", held)
+	}
+	s.expect(s.do(http.MethodPost, "/admin/moderation/"+held[0].Id+"/approve", moderator, nil), http.StatusConflict)
+
+	if failed := s.list("/admin/moderation?status=failed", moderator); len(failed) != 1 || failed[0].Id != held[0].Id {
+		t.Fatalf("failed = %+v, want the reply", failed)
+	}
+	if approved := s.list("/admin/moderation?status=approved", moderator); len(approved) != 1 {
+		t.Fatalf("approved = %+v, want only the question", approved)
+	}
+}
+
+func TestNotificationStreamsEndWithTheSession(t *testing.T) {
+	tests := []struct {
+		name string
+		end  func(s *testServer, token string, userId models.UserID)
+	}{
+		{"logout", func(s *testServer, token string, userId models.UserID) {
+			s.expect(s.do(http.MethodPost, "/users/logout", token, nil), http.StatusOK)
+		}},
+		{"logout of every session", func(s *testServer, token string, userId models.UserID) {
+			s.expect(s.do(http.MethodPost, "/users/logout-all", s.login("ana"), nil), http.StatusOK)
+		}},
+		{"suspension", func(s *testServer, token string, userId models.UserID) {
+			_, admin := s.register("admin", models.RoleAdmin)
+			s.expect(s.do(http.MethodPost, "/admin/users/"+userId+"/suspension", admin, map[string]string{"reason": "Spam"}), http.StatusOK)
+		}},
+		{"role change", func(s *testServer, token string, userId models.UserID) {
+			if _, err := s.store.UpdateUserRole(context.Background(), userId, models.RoleModerator); err != nil {
+				s.t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) {
+				cfg.Notifications.Heartbeat = 10 * time.Millisecond
+			})
+			anaId, ana := s.register("ana", models.RoleUser)
+
+			_, ended := s.openStream(ana)
+			test.end(s, ana, anaId)
+
+			select {
+			case <-ended:
+			case <-time.After(2 * time.Second):
+				t.Fatal("the stream is still open")
+			}
+		})
+	}
+}
+
+func TestNotificationStreamsEndWhenTheTokenExpires(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.AccessTokenTTL = time.Second
+		cfg.Notifications.Heartbeat = time.Hour
+	})
+	_, ana := s.register("ana", models.RoleUser)
+
+	_, ended := s.openStream(ana)
+	select {
+	case <-ended:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the stream outlived its token")
+	}
+}
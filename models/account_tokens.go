@@ -0,0 +1,165 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type AccountTokenID = string
+
+type AccountTokenPurpose string
+
+const (
+	TokenVerifyEmail   AccountTokenPurpose = "verify_email"
+	TokenResetPassword AccountTokenPurpose = "reset_password"
+)
+
+// Single use token sent by email, only stored as a hash like the refresh tokens
+type AccountToken struct {
+	Id             AccountTokenID
+	UserId         UserID
+	Purpose        AccountTokenPurpose
+	TokenHash      string
+	CreationDate   time.Time
+	ExpirationDate time.Time
+	UsedDate       sql.NullTime
+}
+
+type AccountTokenStore interface {
+	InsertAccountToken(ctx context.Context, token AccountToken) error
+	// Marks the token as used and returns it, nil when it doesn't exist, expired or was already used
+	ConsumeAccountToken(ctx context.Context, purpose AccountTokenPurpose, tokenHash string, now time.Time) (*AccountToken, error)
+	// When the newest token for the purpose was created for the user, to not flood their inbox
+	FindLatestAccountTokenDate(ctx context.Context, userId UserID, purpose AccountTokenPurpose) (sql.NullTime, error)
+	// Marks every unused token of the user for the purpose as used, so older links stop working
+	InvalidateAccountTokens(ctx context.Context, userId UserID, purpose AccountTokenPurpose, date time.Time) error
+	PurgeExpiredAccountTokens(ctx context.Context, now time.Time) error
+}
+
+func (s *PostgresStore) InsertAccountToken(ctx context.Context, token AccountToken) error {
+	stmt := `INSERT INTO AccountTokens(id, user_id, purpose, token_hash, creation_date, expiration_date, used_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := s.exec(
+		ctx, stmt,
+		token.Id, token.UserId, token.Purpose, token.TokenHash,
+		token.CreationDate, token.ExpirationDate, token.UsedDate,
+	)
+	return err
+}
+
+func (s *PostgresStore) ConsumeAccountToken(ctx context.Context, purpose AccountTokenPurpose, tokenHash string, now time.Time) (*AccountToken, error) {
+	token := AccountToken{}
+
+	stmt := `
+		UPDATE AccountTokens SET used_date = $3
+		WHERE token_hash = $1 AND purpose = $2 AND used_date IS null AND expiration_date > $3
+		RETURNING id, user_id, purpose, token_hash, creation_date, expiration_date, used_date`
+	row := s.db.QueryRowContext(ctx, stmt, tokenHash, purpose, now)
+	err := row.Scan(
+		&token.Id, &token.UserId, &token.Purpose, &token.TokenHash,
+		&token.CreationDate, &token.ExpirationDate, &token.UsedDate,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &token, nil
+}
+
+func (s *PostgresStore) FindLatestAccountTokenDate(ctx context.Context, userId UserID, purpose AccountTokenPurpose) (sql.NullTime, error) {
+	var date sql.NullTime
+
+	row := s.db.QueryRowContext(ctx, "SELECT max(creation_date) FROM AccountTokens WHERE user_id = $1 AND purpose = $2", userId, purpose)
+	err := row.Scan(&date)
+	return date, translateError(err)
+}
+
+func (s *PostgresStore) InvalidateAccountTokens(ctx context.Context, userId UserID, purpose AccountTokenPurpose, date time.Time) error {
+	stmt := "UPDATE AccountTokens SET used_date = $3 WHERE user_id = $1 AND purpose = $2 AND used_date IS null"
+	_, err := s.exec(ctx, stmt, userId, purpose, date)
+	return err
+}
+
+func (s *PostgresStore) PurgeExpiredAccountTokens(ctx context.Context, now time.Time) error {
+	_, err := s.exec(ctx, "DELETE FROM AccountTokens WHERE expiration_date < $1", now)
+	return err
+}
+
+func (s *MemoryStore) InsertAccountToken(ctx context.Context, token AccountToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.accountTokens[token.Id]; ok {
+		return apperrors.Conflict("Token already exists")
+	}
+	if _, ok := s.users[token.UserId]; !ok {
+		return apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	s.accountTokens[token.Id] = token
+	return nil
+}
+
+func (s *MemoryStore) ConsumeAccountToken(ctx context.Context, purpose AccountTokenPurpose, tokenHash string, now time.Time) (*AccountToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.accountTokens {
+		if token.TokenHash != tokenHash || token.Purpose != purpose || token.UsedDate.Valid || !token.ExpirationDate.After(now) {
+			continue
+		}
+
+		token.UsedDate = sql.NullTime{Time: now, Valid: true}
+		s.accountTokens[id] = token
+		return &token, nil
+	}
+
+	return nil, nil
+}
+
+func (s *MemoryStore) FindLatestAccountTokenDate(ctx context.Context, userId UserID, purpose AccountTokenPurpose) (sql.NullTime, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest := sql.NullTime{}
+	for _, token := range s.accountTokens {
+		if token.UserId == userId && token.Purpose == purpose && (!latest.Valid || token.CreationDate.After(latest.Time)) {
+			latest = sql.NullTime{Time: token.CreationDate, Valid: true}
+		}
+	}
+
+	return latest, nil
+}
+
+func (s *MemoryStore) InvalidateAccountTokens(ctx context.Context, userId UserID, purpose AccountTokenPurpose, date time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.accountTokens {
+		if token.UserId == userId && token.Purpose == purpose && !token.UsedDate.Valid {
+			token.UsedDate = sql.NullTime{Time: date, Valid: true}
+			s.accountTokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) PurgeExpiredAccountTokens(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.accountTokens {
+		if token.ExpirationDate.Before(now) {
+			delete(s.accountTokens, id)
+		}
+	}
+
+	return nil
+}
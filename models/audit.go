@@ -0,0 +1,295 @@
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type AuditEntryID = string
+
+type AuditAction string
+
+const (
+	AuditRegister    AuditAction = "user.register"
+	AuditLogin       AuditAction = "user.login"
+	AuditLoginFailed AuditAction = "user.login_failed"
+
+	AuditReplyQuestion     AuditAction = "question.reply"
+	AuditFavouriteQuestion AuditAction = "question.favourite"
+	AuditDeleteQuestion    AuditAction = "question.delete"
+	// Taken back out of the trash
+	AuditUndeleteQuestion AuditAction = "question.undelete"
+
+	AuditEditPost   AuditAction = "post.edit"
+	AuditDeletePost AuditAction = "post.delete"
+	// Edits that bring back a previous revision
+	AuditRestorePost  AuditAction = "post.restore"
+	AuditUndeletePost AuditAction = "post.undelete"
+)
+
+// Every moderator action is audited as moderation.<kind>
+func ModerationAuditAction(kind ModeratorActionKind) AuditAction {
+	return AuditAction("moderation." + string(kind))
+}
+
+/**
+ * An entry of the append-only audit log. Each entry carries the hash of the previous one,
+ * so changing or removing an entry breaks the chain from that point on. The hashes are keyed
+ * with a secret kept out of the database, so whoever can write to it can't rebuild the chain.
+ */
+type AuditEntry struct {
+	Id AuditEntryID
+	// Position in the chain, starting at 1 and without gaps
+	Sequence int64
+	// Null for anonymous requests
+	ActorId    sql.NullString
+	Action     AuditAction
+	TargetKind TargetKind
+	TargetId   string
+	// JSON snapshots of the target before and after the action, nil when there is none
+	Before       json.RawMessage
+	After        json.RawMessage
+	CreationDate time.Time
+	// Empty for the first entry
+	PrevHash string
+	Hash     string
+}
+
+func (a AuditEntry) Cursor() Cursor {
+	return Cursor{Date: a.CreationDate, Id: a.Id}
+}
+
+// HMAC-SHA256 with the key of the entry contents and the previous hash, hex encoded
+func (a AuditEntry) ComputeHash(key []byte) string {
+	// Struct fields are always encoded in the same order
+	contents, _ := json.Marshal(struct {
+		Sequence     int64  `json:"sequence"`
+		ActorId      string `json:"actor_id"`
+		Action       string `json:"action"`
+		TargetKind   string `json:"target_kind"`
+		TargetId     string `json:"target_id"`
+		Before       string `json:"before"`
+		After        string `json:"after"`
+		CreationDate string `json:"creation_date"`
+		PrevHash     string `json:"prev_hash"`
+	}{
+		Sequence:     a.Sequence,
+		ActorId:      a.ActorId.String,
+		Action:       string(a.Action),
+		TargetKind:   string(a.TargetKind),
+		TargetId:     a.TargetId,
+		Before:       string(a.Before),
+		After:        string(a.After),
+		CreationDate: a.CreationDate.UTC().Format(time.RFC3339Nano),
+		PrevHash:     a.PrevHash,
+	})
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(contents)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type AuditFilter struct {
+	// Empty for every actor
+	ActorId UserID
+	// Empty for every action
+	Action AuditAction
+	// Empty for every target
+	TargetId string
+}
+
+func (f AuditFilter) matches(entry AuditEntry) bool {
+	return (f.ActorId == "" || entry.ActorId.String == f.ActorId) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.TargetId == "" || entry.TargetId == f.TargetId)
+}
+
+type AuditStore interface {
+	// Sets the sequence and the hashes, keyed with key, that chain the entry to the last one and stores it
+	AppendAuditEntry(ctx context.Context, entry AuditEntry, key []byte) (AuditEntry, error)
+	// Returns a page of the entries that match the filter, the most recent first
+	FindAuditEntries(ctx context.Context, filter AuditFilter, page Page) ([]AuditEntry, error)
+	// Returns up to limit entries after the sequence, in the order of the chain
+	FindAuditChain(ctx context.Context, afterSequence int64, limit int) ([]AuditEntry, error)
+}
+
+// Held while appending, so entries from every instance form a single chain
+const auditLockKey = 7_402_318
+
+const auditColumns = "id, sequence, actor_id, action, target_kind, target_id, before_snapshot, after_snapshot, creation_date, prev_hash, hash"
+
+// Postgres keeps microseconds, the hash must be computed with the date it will read back
+func truncateAuditDate(date time.Time) time.Time {
+	return date.UTC().Truncate(time.Microsecond)
+}
+
+func (s *PostgresStore) AppendAuditEntry(ctx context.Context, entry AuditEntry, key []byte) (AuditEntry, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return entry, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditLockKey); err != nil {
+		return entry, err
+	}
+
+	var last int64
+	var lastHash string
+	row := tx.QueryRowContext(ctx, "SELECT sequence, hash FROM AuditLog ORDER BY sequence DESC LIMIT 1")
+	if err := row.Scan(&last, &lastHash); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return entry, err
+	}
+
+	entry.Sequence = last + 1
+	entry.PrevHash = lastHash
+	entry.CreationDate = truncateAuditDate(entry.CreationDate)
+	entry.Hash = entry.ComputeHash(key)
+
+	stmt := fmt.Sprintf("INSERT INTO AuditLog(%s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)", auditColumns)
+	_, err = tx.ExecContext(
+		ctx, stmt,
+		entry.Id, entry.Sequence, entry.ActorId, entry.Action, entry.TargetKind, entry.TargetId,
+		nullSnapshot(entry.Before), nullSnapshot(entry.After), entry.CreationDate, entry.PrevHash, entry.Hash,
+	)
+	if err != nil {
+		return entry, translateError(err)
+	}
+
+	return entry, tx.Commit()
+}
+
+func (s *PostgresStore) FindAuditEntries(ctx context.Context, filter AuditFilter, page Page) ([]AuditEntry, error) {
+	query := fmt.Sprintf("SELECT %s FROM AuditLog WHERE true", auditColumns)
+	args := []any{}
+
+	if filter.ActorId != "" {
+		args = append(args, filter.ActorId)
+		query += fmt.Sprintf(" AND actor_id = $%d", len(args))
+	}
+	if filter.Action != "" {
+		args = append(args, filter.Action)
+		query += fmt.Sprintf(" AND action = $%d", len(args))
+	}
+	if filter.TargetId != "" {
+		args = append(args, filter.TargetId)
+		query += fmt.Sprintf(" AND target_id = $%d", len(args))
+	}
+	if page.After != nil {
+		args = append(args, page.After.Date, page.After.Id)
+		query += fmt.Sprintf(" AND (creation_date, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	query += fmt.Sprintf(" ORDER BY creation_date DESC, id DESC LIMIT %d", page.Limit)
+
+	entries, err := s.queryAuditEntries(ctx, query, args...)
+	if isInvalidId(err) {
+		return []AuditEntry{}, nil
+	}
+
+	return entries, err
+}
+
+func (s *PostgresStore) FindAuditChain(ctx context.Context, afterSequence int64, limit int) ([]AuditEntry, error) {
+	query := fmt.Sprintf("SELECT %s FROM AuditLog WHERE sequence > $1 ORDER BY sequence LIMIT $2", auditColumns)
+	return s.queryAuditEntries(ctx, query, afterSequence, limit)
+}
+
+func (s *PostgresStore) queryAuditEntries(ctx context.Context, query string, args ...any) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+
+	cursor, err := s.query(ctx, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		entry := AuditEntry{}
+		var before, after sql.NullString
+		err := cursor.Scan(
+			&entry.Id, &entry.Sequence, &entry.ActorId, &entry.Action, &entry.TargetKind, &entry.TargetId,
+			&before, &after, &entry.CreationDate, &entry.PrevHash, &entry.Hash,
+		)
+		if err != nil {
+			return entries, err
+		}
+		if before.Valid {
+			entry.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			entry.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, cursor.Err()
+}
+
+func nullSnapshot(snapshot json.RawMessage) sql.NullString {
+	return sql.NullString{String: string(snapshot), Valid: snapshot != nil}
+}
+
+func (s *MemoryStore) AppendAuditEntry(ctx context.Context, entry AuditEntry, key []byte) (AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.auditLog {
+		if existing.Id == entry.Id {
+			return entry, apperrors.Conflict("Audit entry already exists")
+		}
+	}
+
+	entry.Sequence = int64(len(s.auditLog)) + 1
+	if len(s.auditLog) > 0 {
+		entry.PrevHash = s.auditLog[len(s.auditLog)-1].Hash
+	}
+	entry.CreationDate = truncateAuditDate(entry.CreationDate)
+	entry.Hash = entry.ComputeHash(key)
+
+	s.auditLog = append(s.auditLog, entry)
+	return entry, nil
+}
+
+func (s *MemoryStore) FindAuditEntries(ctx context.Context, filter AuditFilter, page Page) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []AuditEntry{}
+	for _, entry := range s.auditLog {
+		if filter.matches(entry) && page.Includes(entry.CreationDate, entry.Id) {
+			entries = append(entries, entry)
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b AuditEntry) int {
+		return a.Cursor().Compare(b.Cursor())
+	})
+
+	if len(entries) > page.Limit {
+		entries = entries[:page.Limit]
+	}
+
+	return entries, nil
+}
+
+func (s *MemoryStore) FindAuditChain(ctx context.Context, afterSequence int64, limit int) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Sequences start at 1, so the entry with a sequence is at that index minus one
+	start := min(max(afterSequence, 0), int64(len(s.auditLog)))
+	end := min(start+int64(limit), int64(len(s.auditLog)))
+
+	return slices.Clone(s.auditLog[start:end]), nil
+}
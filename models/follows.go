@@ -0,0 +1,293 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+// The other user of a follow, a follower or a followed user depending on the list
+type FollowEntry struct {
+	UserId       UserID
+	Name         string
+	CreationDate time.Time
+}
+
+type FollowCounts struct {
+	Followers int
+	Following int
+}
+
+type FollowStore interface {
+	// Returns false when the follow already existed
+	Follow(ctx context.Context, followerId UserID, followeeId UserID, date time.Time) (bool, error)
+	// Returns false when the user wasn't following
+	Unfollow(ctx context.Context, followerId UserID, followeeId UserID) (bool, error)
+	IsFollowing(ctx context.Context, followerId UserID, followeeId UserID) (bool, error)
+	// Pages of the followers and the followed users, the most recent follow first
+	FindFollowers(ctx context.Context, userId UserID, page Page) ([]FollowEntry, error)
+	FindFollowing(ctx context.Context, userId UserID, page Page) ([]FollowEntry, error)
+	CountFollows(ctx context.Context, userId UserID) (FollowCounts, error)
+	// Users followed by the user that have more than minFollowers followers
+	FindPopularFollowees(ctx context.Context, userId UserID, minFollowers int) ([]UserID, error)
+}
+
+// The counters of Users are kept in the same statement so they can't drift from Follows
+func (s *PostgresStore) Follow(ctx context.Context, followerId UserID, followeeId UserID, date time.Time) (bool, error) {
+	stmt := `
+		WITH inserted AS (
+			INSERT INTO Follows(follower_id, followee_id, creation_date) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+			RETURNING follower_id, followee_id
+		), following AS (
+			UPDATE Users SET following_count = following_count + 1 WHERE id IN (SELECT follower_id FROM inserted)
+		), followers AS (
+			UPDATE Users SET follower_count = follower_count + 1 WHERE id IN (SELECT followee_id FROM inserted)
+		)
+		SELECT count(*) FROM inserted`
+
+	return s.countOne(ctx, stmt, followerId, followeeId, date)
+}
+
+func (s *PostgresStore) Unfollow(ctx context.Context, followerId UserID, followeeId UserID) (bool, error) {
+	stmt := `
+		WITH deleted AS (
+			DELETE FROM Follows WHERE follower_id = $1 AND followee_id = $2
+			RETURNING follower_id, followee_id
+		), following AS (
+			UPDATE Users SET following_count = following_count - 1 WHERE id IN (SELECT follower_id FROM deleted)
+		), followers AS (
+			UPDATE Users SET follower_count = follower_count - 1 WHERE id IN (SELECT followee_id FROM deleted)
+		)
+		SELECT count(*) FROM deleted`
+
+	return s.countOne(ctx, stmt, followerId, followeeId)
+}
+
+func (s *PostgresStore) IsFollowing(ctx context.Context, followerId UserID, followeeId UserID) (bool, error) {
+	following := false
+
+	query := "SELECT EXISTS(SELECT 1 FROM Follows WHERE follower_id = $1 AND followee_id = $2)"
+	err := s.db.QueryRowContext(ctx, query, followerId, followeeId).Scan(&following)
+	if isInvalidId(err) {
+		return false, nil
+	}
+
+	return following, translateError(err)
+}
+
+func (s *PostgresStore) FindFollowers(ctx context.Context, userId UserID, page Page) ([]FollowEntry, error) {
+	return s.findFollows(ctx, "follower_id", "followee_id", userId, page)
+}
+
+func (s *PostgresStore) FindFollowing(ctx context.Context, userId UserID, page Page) ([]FollowEntry, error) {
+	return s.findFollows(ctx, "followee_id", "follower_id", userId, page)
+}
+
+func (s *PostgresStore) CountFollows(ctx context.Context, userId UserID) (FollowCounts, error) {
+	counts := FollowCounts{}
+
+	query := "SELECT follower_count, following_count FROM Users WHERE id = $1"
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&counts.Followers, &counts.Following)
+	if err == sql.ErrNoRows || isInvalidId(err) {
+		return counts, nil
+	}
+
+	return counts, translateError(err)
+}
+
+func (s *PostgresStore) FindPopularFollowees(ctx context.Context, userId UserID, minFollowers int) ([]UserID, error) {
+	userIds := []UserID{}
+
+	query := `
+		SELECT f.followee_id FROM Follows f JOIN Users u ON u.id = f.followee_id
+		WHERE f.follower_id = $1 AND u.follower_count > $2`
+	cursor, err := s.query(ctx, query, userId, minFollowers)
+	if isInvalidId(err) {
+		return userIds, nil
+	}
+	if err != nil {
+		return userIds, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		var id UserID
+		if err := cursor.Scan(&id); err != nil {
+			return userIds, err
+		}
+		userIds = append(userIds, id)
+	}
+
+	return userIds, cursor.Err()
+}
+
+// Lists the users in column `other` of the follows where column `self` is the user
+func (s *PostgresStore) findFollows(ctx context.Context, other string, self string, userId UserID, page Page) ([]FollowEntry, error) {
+	follows := make([]FollowEntry, 0, page.Limit)
+
+	query := fmt.Sprintf(
+		"SELECT u.id, u.name, f.creation_date FROM Follows f JOIN Users u ON u.id = f.%s WHERE f.%s = $1",
+		other, self,
+	)
+	args := []any{userId}
+
+	if page.After != nil {
+		query += fmt.Sprintf(" AND (f.creation_date, f.%s) < ($2, $3)", other)
+		args = append(args, page.After.Date, page.After.Id)
+	}
+
+	query += fmt.Sprintf(" ORDER BY f.creation_date DESC, f.%s DESC LIMIT %d", other, page.Limit)
+
+	cursor, err := s.query(ctx, query, args...)
+	if isInvalidId(err) {
+		return follows, nil
+	}
+	if err != nil {
+		return follows, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		follow := FollowEntry{}
+		if err := cursor.Scan(&follow.UserId, &follow.Name, &follow.CreationDate); err != nil {
+			return follows, err
+		}
+		follows = append(follows, follow)
+	}
+
+	return follows, cursor.Err()
+}
+
+// Runs a statement that selects how many rows it changed and reports whether it was one
+func (s *PostgresStore) countOne(ctx context.Context, stmt string, args ...any) (bool, error) {
+	count := 0
+
+	err := s.db.QueryRowContext(ctx, stmt, args...).Scan(&count)
+	if err != nil {
+		return false, translateError(err)
+	}
+
+	return count == 1, nil
+}
+
+func (s *MemoryStore) Follow(ctx context.Context, followerId UserID, followeeId UserID, date time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[followerId]; !ok {
+		return false, apperrors.NotFound("Referenced resource doesn't exist")
+	}
+	if _, ok := s.users[followeeId]; !ok {
+		return false, apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	if _, ok := s.follows[followerId][followeeId]; ok {
+		return false, nil
+	}
+
+	if s.follows[followerId] == nil {
+		s.follows[followerId] = map[UserID]time.Time{}
+	}
+	s.follows[followerId][followeeId] = date
+	return true, nil
+}
+
+func (s *MemoryStore) Unfollow(ctx context.Context, followerId UserID, followeeId UserID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.follows[followerId][followeeId]; !ok {
+		return false, nil
+	}
+
+	delete(s.follows[followerId], followeeId)
+	return true, nil
+}
+
+func (s *MemoryStore) IsFollowing(ctx context.Context, followerId UserID, followeeId UserID) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.follows[followerId][followeeId]
+	return ok, nil
+}
+
+func (s *MemoryStore) FindFollowers(ctx context.Context, userId UserID, page Page) ([]FollowEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	follows := []FollowEntry{}
+	for followerId, followees := range s.follows {
+		if date, ok := followees[userId]; ok {
+			follows = append(follows, FollowEntry{UserId: followerId, Name: s.users[followerId].Name, CreationDate: date})
+		}
+	}
+
+	return pageOfFollows(follows, page), nil
+}
+
+func (s *MemoryStore) FindFollowing(ctx context.Context, userId UserID, page Page) ([]FollowEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	follows := []FollowEntry{}
+	for followeeId, date := range s.follows[userId] {
+		follows = append(follows, FollowEntry{UserId: followeeId, Name: s.users[followeeId].Name, CreationDate: date})
+	}
+
+	return pageOfFollows(follows, page), nil
+}
+
+func (s *MemoryStore) CountFollows(ctx context.Context, userId UserID) (FollowCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.countFollows(userId), nil
+}
+
+func (s *MemoryStore) FindPopularFollowees(ctx context.Context, userId UserID, minFollowers int) ([]UserID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userIds := []UserID{}
+	for followeeId := range s.follows[userId] {
+		if s.countFollows(followeeId).Followers > minFollowers {
+			userIds = append(userIds, followeeId)
+		}
+	}
+
+	return userIds, nil
+}
+
+// Must be called with the lock held
+func (s *MemoryStore) countFollows(userId UserID) FollowCounts {
+	counts := FollowCounts{Following: len(s.follows[userId])}
+	for _, followees := range s.follows {
+		if _, ok := followees[userId]; ok {
+			counts.Followers++
+		}
+	}
+
+	return counts
+}
+
+func pageOfFollows(follows []FollowEntry, page Page) []FollowEntry {
+	follows = slices.DeleteFunc(follows, func(follow FollowEntry) bool {
+		return !page.Includes(follow.CreationDate, follow.UserId)
+	})
+
+	slices.SortFunc(follows, func(a, b FollowEntry) int {
+		return Cursor{Date: a.CreationDate, Id: a.UserId}.Compare(Cursor{Date: b.CreationDate, Id: b.UserId})
+	})
+
+	if len(follows) > page.Limit {
+		follows = follows[:page.Limit]
+	}
+
+	return follows
+}
@@ -0,0 +1,353 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type LoginAttemptID = string
+
+type LoginFailureReason string
+
+const (
+	LoginWrongPassword LoginFailureReason = "wrong_password"
+	// The account was locked by previous failures, the password wasn't checked
+	LoginLocked LoginFailureReason = "locked"
+	// The password was right but a moderator suspended the account
+	LoginSuspended LoginFailureReason = "suspended"
+	// Only recorded without a user
+	LoginUnknownEmail LoginFailureReason = "unknown_email"
+)
+
+type LoginAttempt struct {
+	Id LoginAttemptID
+	// Null when the email isn't registered
+	UserId    sql.NullString
+	Email     string
+	Ip        string
+	UserAgent string
+	Success   bool
+	// Null on success
+	FailureReason sql.NullString
+	CreationDate  time.Time
+}
+
+func (a LoginAttempt) Cursor() Cursor {
+	return Cursor{Date: a.CreationDate, Id: a.Id}
+}
+
+// Failed logins of an account since its last success
+type LoginFailures struct {
+	Count       int
+	LastFailure sql.NullTime
+	LockedUntil sql.NullTime
+}
+
+type LoginStore interface {
+	InsertLoginAttempt(ctx context.Context, attempt LoginAttempt) error
+	// Returns a page of the login attempts of the user, newest first
+	FindLoginAttempts(ctx context.Context, userId UserID, page Page) ([]LoginAttempt, error)
+	DeleteLoginAttemptsBefore(ctx context.Context, date time.Time) error
+
+	FindLoginFailures(ctx context.Context, userId UserID) (LoginFailures, error)
+	// Counts a failure and returns the new count, previous failures older than since are forgotten
+	AddLoginFailure(ctx context.Context, userId UserID, date time.Time, since time.Time) (int, error)
+	LockLogin(ctx context.Context, userId UserID, until time.Time) error
+	// Forgets the failures and the lock, after a successful login
+	ResetLoginFailures(ctx context.Context, userId UserID) error
+
+	// Failures on emails that aren't registered, counted the same way as those of the accounts
+	FindUnknownLoginFailures(ctx context.Context, email string) (LoginFailures, error)
+	AddUnknownLoginFailure(ctx context.Context, email string, date time.Time, since time.Time) (int, error)
+	LockUnknownLogin(ctx context.Context, email string, until time.Time) error
+	// Forgets the emails without failures after since and without a lock after now
+	PurgeUnknownLoginFailures(ctx context.Context, since time.Time, now time.Time) error
+}
+
+func (s *PostgresStore) InsertLoginAttempt(ctx context.Context, attempt LoginAttempt) error {
+	stmt := `
+		INSERT INTO LoginAttempts(id, user_id, email, ip, user_agent, success, failure_reason, creation_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := s.exec(
+		ctx, stmt,
+		attempt.Id, attempt.UserId, attempt.Email, attempt.Ip, attempt.UserAgent,
+		attempt.Success, attempt.FailureReason, attempt.CreationDate,
+	)
+	return err
+}
+
+func (s *PostgresStore) FindLoginAttempts(ctx context.Context, userId UserID, page Page) ([]LoginAttempt, error) {
+	attempts := make([]LoginAttempt, 0, page.Limit)
+
+	args := []any{userId, page.Limit}
+	condition := ""
+	if page.After != nil {
+		condition = "AND (creation_date, id) < ($3, $4)"
+		args = append(args, page.After.Date, page.After.Id)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, user_id, email, ip, user_agent, success, failure_reason, creation_date
+		FROM LoginAttempts WHERE user_id = $1 %s
+		ORDER BY creation_date DESC, id DESC LIMIT $2`, condition)
+
+	cursor, err := s.query(ctx, query, args...)
+	if err != nil {
+		return attempts, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		attempt := LoginAttempt{}
+
+		err = cursor.Scan(
+			&attempt.Id, &attempt.UserId, &attempt.Email, &attempt.Ip, &attempt.UserAgent,
+			&attempt.Success, &attempt.FailureReason, &attempt.CreationDate,
+		)
+		if err != nil {
+			return attempts, err
+		}
+
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, cursor.Err()
+}
+
+func (s *PostgresStore) DeleteLoginAttemptsBefore(ctx context.Context, date time.Time) error {
+	_, err := s.exec(ctx, "DELETE FROM LoginAttempts WHERE creation_date < $1", date)
+	return err
+}
+
+func (s *PostgresStore) FindLoginFailures(ctx context.Context, userId UserID) (LoginFailures, error) {
+	failures := LoginFailures{}
+
+	row := s.db.QueryRowContext(ctx, "SELECT failed_logins, last_failed_login, login_locked_until FROM Users WHERE id = $1", userId)
+	err := row.Scan(&failures.Count, &failures.LastFailure, &failures.LockedUntil)
+	if err == sql.ErrNoRows || isInvalidId(err) {
+		return LoginFailures{}, nil
+	}
+
+	return failures, translateError(err)
+}
+
+func (s *PostgresStore) AddLoginFailure(ctx context.Context, userId UserID, date time.Time, since time.Time) (int, error) {
+	var count int
+
+	stmt := `
+		UPDATE Users SET
+			failed_logins = CASE WHEN last_failed_login < $3 THEN 1 ELSE failed_logins + 1 END,
+			last_failed_login = $2
+		WHERE id = $1
+		RETURNING failed_logins`
+	err := s.db.QueryRowContext(ctx, stmt, userId, date, since).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return count, translateError(err)
+}
+
+func (s *PostgresStore) LockLogin(ctx context.Context, userId UserID, until time.Time) error {
+	_, err := s.exec(ctx, "UPDATE Users SET login_locked_until = $2 WHERE id = $1", userId, until)
+	return err
+}
+
+func (s *PostgresStore) ResetLoginFailures(ctx context.Context, userId UserID) error {
+	stmt := `
+		UPDATE Users SET failed_logins = 0, last_failed_login = null, login_locked_until = null
+		WHERE id = $1 AND (failed_logins > 0 OR login_locked_until IS NOT null)`
+	_, err := s.exec(ctx, stmt, userId)
+	return err
+}
+
+func (s *PostgresStore) FindUnknownLoginFailures(ctx context.Context, email string) (LoginFailures, error) {
+	failures := LoginFailures{}
+
+	row := s.db.QueryRowContext(ctx, "SELECT failed_logins, last_failed_login, login_locked_until FROM UnknownLoginFailures WHERE email = $1", email)
+	err := row.Scan(&failures.Count, &failures.LastFailure, &failures.LockedUntil)
+	if err == sql.ErrNoRows {
+		return LoginFailures{}, nil
+	}
+
+	return failures, translateError(err)
+}
+
+func (s *PostgresStore) AddUnknownLoginFailure(ctx context.Context, email string, date time.Time, since time.Time) (int, error) {
+	var count int
+
+	stmt := `
+		INSERT INTO UnknownLoginFailures(email, failed_logins, last_failed_login) VALUES ($1, 1, $2)
+		ON CONFLICT (email) DO UPDATE SET
+			failed_logins = CASE WHEN UnknownLoginFailures.last_failed_login < $3 THEN 1 ELSE UnknownLoginFailures.failed_logins + 1 END,
+			last_failed_login = $2
+		RETURNING failed_logins`
+	err := s.db.QueryRowContext(ctx, stmt, email, date, since).Scan(&count)
+
+	return count, translateError(err)
+}
+
+func (s *PostgresStore) LockUnknownLogin(ctx context.Context, email string, until time.Time) error {
+	_, err := s.exec(ctx, "UPDATE UnknownLoginFailures SET login_locked_until = $2 WHERE email = $1", email, until)
+	return err
+}
+
+func (s *PostgresStore) PurgeUnknownLoginFailures(ctx context.Context, since time.Time, now time.Time) error {
+	stmt := `
+		DELETE FROM UnknownLoginFailures
+		WHERE last_failed_login < $1 AND (login_locked_until IS null OR login_locked_until < $2)`
+	_, err := s.exec(ctx, stmt, since, now)
+	return err
+}
+
+func (s *MemoryStore) InsertLoginAttempt(ctx context.Context, attempt LoginAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.loginAttempts[attempt.Id]; ok {
+		return apperrors.Conflict("Login attempt already exists")
+	}
+	if _, ok := s.users[attempt.UserId.String]; attempt.UserId.Valid && !ok {
+		return apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	s.loginAttempts[attempt.Id] = attempt
+	return nil
+}
+
+func (s *MemoryStore) FindLoginAttempts(ctx context.Context, userId UserID, page Page) ([]LoginAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	attempts := make([]LoginAttempt, 0, page.Limit)
+	for _, attempt := range s.loginAttempts {
+		if attempt.UserId.Valid && attempt.UserId.String == userId && page.Includes(attempt.CreationDate, attempt.Id) {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	slices.SortFunc(attempts, func(a, b LoginAttempt) int {
+		return a.Cursor().Compare(b.Cursor())
+	})
+
+	if len(attempts) > page.Limit {
+		attempts = attempts[:page.Limit]
+	}
+
+	return attempts, nil
+}
+
+func (s *MemoryStore) DeleteLoginAttemptsBefore(ctx context.Context, date time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, attempt := range s.loginAttempts {
+		if attempt.CreationDate.Before(date) {
+			delete(s.loginAttempts, id)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) FindLoginFailures(ctx context.Context, userId UserID) (LoginFailures, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.loginFailures[userId], nil
+}
+
+func (s *MemoryStore) AddLoginFailure(ctx context.Context, userId UserID, date time.Time, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return 0, nil
+	}
+
+	failures := s.loginFailures[userId]
+	if failures.LastFailure.Valid && failures.LastFailure.Time.Before(since) {
+		failures.Count = 0
+	}
+	failures.Count++
+	failures.LastFailure = sql.NullTime{Time: date, Valid: true}
+	s.loginFailures[userId] = failures
+
+	return failures.Count, nil
+}
+
+func (s *MemoryStore) LockLogin(ctx context.Context, userId UserID, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return nil
+	}
+
+	failures := s.loginFailures[userId]
+	failures.LockedUntil = sql.NullTime{Time: until, Valid: true}
+	s.loginFailures[userId] = failures
+	return nil
+}
+
+func (s *MemoryStore) ResetLoginFailures(ctx context.Context, userId UserID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.loginFailures, userId)
+	return nil
+}
+
+func (s *MemoryStore) FindUnknownLoginFailures(ctx context.Context, email string) (LoginFailures, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.unknownLoginFailures[email], nil
+}
+
+func (s *MemoryStore) AddUnknownLoginFailure(ctx context.Context, email string, date time.Time, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures := s.unknownLoginFailures[email]
+	if failures.LastFailure.Valid && failures.LastFailure.Time.Before(since) {
+		failures.Count = 0
+	}
+	failures.Count++
+	failures.LastFailure = sql.NullTime{Time: date, Valid: true}
+	s.unknownLoginFailures[email] = failures
+
+	return failures.Count, nil
+}
+
+func (s *MemoryStore) LockUnknownLogin(ctx context.Context, email string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, ok := s.unknownLoginFailures[email]
+	if !ok {
+		return nil
+	}
+
+	failures.LockedUntil = sql.NullTime{Time: until, Valid: true}
+	s.unknownLoginFailures[email] = failures
+	return nil
+}
+
+func (s *MemoryStore) PurgeUnknownLoginFailures(ctx context.Context, since time.Time, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for email, failures := range s.unknownLoginFailures {
+		if failures.LastFailure.Time.Before(since) && (!failures.LockedUntil.Valid || failures.LockedUntil.Time.Before(now)) {
+			delete(s.unknownLoginFailures, email)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/search"
+)
+
+// Store implementation that keeps everything in process memory.
+// It mirrors the semantics of PostgresStore and is meant for tests and local development.
+type MemoryStore struct {
+	mu sync.RWMutex
+
+	users     map[UserID]User
+	questions map[QuestionID]Question
+	posts     map[PostID]Post
+	// Previous versions of each post, the oldest first
+	postRevisions map[PostID][]PostRevision
+
+	questionSettings map[UserID]QuestionSettings
+	mutedWords       map[UserID][]string
+	notifications    map[NotificationID]Notification
+	moderationItems  map[ModerationItemID]ModerationItem
+	reports          map[ReportID]Report
+	moderatorActions map[ModeratorActionID]ModeratorAction
+	// In the order of the chain
+	auditLog []AuditEntry
+
+	// Questions and posts, deleted ones are filtered out when searching
+	searchIndex *search.Index
+	// Followed users of each user and when they were followed
+	follows map[UserID]map[UserID]time.Time
+	// Materialized timelines, by user and item id
+	timelines map[UserID]map[string]TimelineEntry
+	// Blocked and muted users of each user and when it happened
+	relations map[relationKey]map[UserID]time.Time
+
+	refreshTokens map[RefreshTokenID]RefreshToken
+	accountTokens map[AccountTokenID]AccountToken
+	loginAttempts map[LoginAttemptID]LoginAttempt
+	loginFailures map[UserID]LoginFailures
+	// Keyed by email
+	unknownLoginFailures map[string]LoginFailures
+	// Denylisted access token ids and when they expire
+	revokedAccessTokens map[string]time.Time
+}
+
+type relationKey struct {
+	kind   RelationKind
+	userId UserID
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:     map[UserID]User{},
+		questions: map[QuestionID]Question{},
+		posts:     map[PostID]Post{},
+
+		postRevisions: map[PostID][]PostRevision{},
+
+		questionSettings: map[UserID]QuestionSettings{},
+		mutedWords:       map[UserID][]string{},
+		notifications:    map[NotificationID]Notification{},
+		moderationItems:  map[ModerationItemID]ModerationItem{},
+		reports:          map[ReportID]Report{},
+		moderatorActions: map[ModeratorActionID]ModeratorAction{},
+		auditLog:         []AuditEntry{},
+
+		searchIndex: search.NewIndex(),
+		follows:     map[UserID]map[UserID]time.Time{},
+		timelines:   map[UserID]map[string]TimelineEntry{},
+		relations:   map[relationKey]map[UserID]time.Time{},
+
+		refreshTokens:        map[RefreshTokenID]RefreshToken{},
+		accountTokens:        map[AccountTokenID]AccountToken{},
+		loginAttempts:        map[LoginAttemptID]LoginAttempt{},
+		loginFailures:        map[UserID]LoginFailures{},
+		unknownLoginFailures: map[string]LoginFailures{},
+		revokedAccessTokens:  map[string]time.Time{},
+	}
+}
@@ -0,0 +1,245 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type ModerationItemID = string
+
+type ModerationKind string
+
+const (
+	ModerationQuestion   ModerationKind = "question"
+	ModerationReply      ModerationKind = "reply"
+	ModerationPost       ModerationKind = "post"
+	ModerationPostUpdate ModerationKind = "post_update"
+)
+
+type ModerationStatus string
+
+const (
+	ModerationPending  ModerationStatus = "pending"
+	ModerationApproved ModerationStatus = "approved"
+	ModerationRejected ModerationStatus = "rejected"
+	// Matched a muted word of the recipient, never reviewed nor delivered
+	ModerationMuted ModerationStatus = "muted"
+	// Approved but it couldn't be delivered, what it replied to or updated was gone
+	ModerationFailed ModerationStatus = "failed"
+)
+
+/**
+ * Content held before being delivered, with everything needed to deliver it once approved.
+ * SubjectId is the id the question or post gets when it's new, or the one being replied or updated.
+ */
+type ModerationItem struct {
+	Id     ModerationItemID
+	Kind   ModerationKind
+	Status ModerationStatus
+	// Recipient of the question or owner of the post
+	UserId UserID
+	// Null for questions asked without logging in
+	AuthorId  sql.NullString
+	SubjectId string
+	// Only for posts
+	Title     string
+	Content   string
+	Anonymous bool
+	Signature sql.NullString
+	Reasons   []string
+
+	CreationDate time.Time
+	ReviewDate   sql.NullTime
+	ReviewerId   sql.NullString
+}
+
+func (i ModerationItem) Cursor() Cursor {
+	return Cursor{Date: i.CreationDate, Id: i.Id}
+}
+
+type ModerationStore interface {
+	InsertModerationItem(ctx context.Context, item ModerationItem) error
+	// Returns nil without error when it doesn't exist
+	FindModerationItem(ctx context.Context, id ModerationItemID) (*ModerationItem, error)
+	// Returns a page of the items with the status, the most recent first
+	FindModerationItems(ctx context.Context, status ModerationStatus, page Page) ([]ModerationItem, error)
+	// Approves or rejects a pending item, false when it doesn't exist or was already reviewed
+	ReviewModerationItem(ctx context.Context, id ModerationItemID, status ModerationStatus, reviewerId UserID, date time.Time) (bool, error)
+	// Takes back the approval of an item that couldn't be delivered, pending clears the review so it can be approved again
+	UndoModerationApproval(ctx context.Context, id ModerationItemID, status ModerationStatus) error
+}
+
+const moderationColumns = `id, kind, status, user_id, author_id, subject_id, title, content, anonymous, signature, reasons,
+	creation_date, review_date, reviewer_id`
+
+func (s *PostgresStore) InsertModerationItem(ctx context.Context, item ModerationItem) error {
+	stmt := fmt.Sprintf("INSERT INTO ModerationItems(%s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)", moderationColumns)
+	_, err := s.exec(
+		ctx, stmt,
+		item.Id, item.Kind, item.Status, item.UserId, item.AuthorId, item.SubjectId, item.Title, item.Content,
+		item.Anonymous, item.Signature, pq.Array(item.Reasons), item.CreationDate, item.ReviewDate, item.ReviewerId,
+	)
+	return err
+}
+
+func (s *PostgresStore) FindModerationItem(ctx context.Context, id ModerationItemID) (*ModerationItem, error) {
+	items, err := s.queryModerationItems(ctx, fmt.Sprintf("SELECT %s FROM ModerationItems WHERE id = $1", moderationColumns), id)
+	if isInvalidId(err) || len(items) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &items[0], nil
+}
+
+func (s *PostgresStore) FindModerationItems(ctx context.Context, status ModerationStatus, page Page) ([]ModerationItem, error) {
+	query := fmt.Sprintf("SELECT %s FROM ModerationItems WHERE status = $1", moderationColumns)
+	args := []any{status}
+
+	if page.After != nil {
+		query += " AND (creation_date, id) < ($2, $3)"
+		args = append(args, page.After.Date, page.After.Id)
+	}
+
+	query += fmt.Sprintf(" ORDER BY creation_date DESC, id DESC LIMIT %d", page.Limit)
+
+	return s.queryModerationItems(ctx, query, args...)
+}
+
+func (s *PostgresStore) ReviewModerationItem(ctx context.Context, id ModerationItemID, status ModerationStatus, reviewerId UserID, date time.Time) (bool, error) {
+	stmt := "UPDATE ModerationItems SET status = $2, reviewer_id = $3, review_date = $4 WHERE id = $1 AND status = 'pending'"
+	result, err := s.exec(ctx, stmt, id, status, reviewerId, date)
+	if isInvalidId(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) UndoModerationApproval(ctx context.Context, id ModerationItemID, status ModerationStatus) error {
+	stmt := `UPDATE ModerationItems SET status = $2,
+		reviewer_id = CASE WHEN $2 = 'pending' THEN NULL ELSE reviewer_id END,
+		review_date = CASE WHEN $2 = 'pending' THEN NULL ELSE review_date END
+		WHERE id = $1 AND status = 'approved'`
+	_, err := s.exec(ctx, stmt, id, status)
+	return err
+}
+
+func (s *PostgresStore) queryModerationItems(ctx context.Context, query string, args ...any) ([]ModerationItem, error) {
+	items := []ModerationItem{}
+
+	cursor, err := s.query(ctx, query, args...)
+	if err != nil {
+		return items, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		item := ModerationItem{}
+		err := cursor.Scan(
+			&item.Id, &item.Kind, &item.Status, &item.UserId, &item.AuthorId, &item.SubjectId, &item.Title, &item.Content,
+			&item.Anonymous, &item.Signature, pq.Array(&item.Reasons), &item.CreationDate, &item.ReviewDate, &item.ReviewerId,
+		)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+
+	return items, cursor.Err()
+}
+
+func (s *MemoryStore) InsertModerationItem(ctx context.Context, item ModerationItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.moderationItems[item.Id]; ok {
+		return apperrors.Conflict("Moderation item already exists")
+	}
+	if _, ok := s.users[item.UserId]; !ok {
+		return apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	item.Reasons = append([]string{}, item.Reasons...)
+	s.moderationItems[item.Id] = item
+	return nil
+}
+
+func (s *MemoryStore) FindModerationItem(ctx context.Context, id ModerationItemID) (*ModerationItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.moderationItems[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &item, nil
+}
+
+func (s *MemoryStore) FindModerationItems(ctx context.Context, status ModerationStatus, page Page) ([]ModerationItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []ModerationItem{}
+	for _, item := range s.moderationItems {
+		if item.Status == status && page.Includes(item.CreationDate, item.Id) {
+			items = append(items, item)
+		}
+	}
+
+	slices.SortFunc(items, func(a, b ModerationItem) int {
+		return a.Cursor().Compare(b.Cursor())
+	})
+
+	if len(items) > page.Limit {
+		items = items[:page.Limit]
+	}
+
+	return items, nil
+}
+
+func (s *MemoryStore) ReviewModerationItem(ctx context.Context, id ModerationItemID, status ModerationStatus, reviewerId UserID, date time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.moderationItems[id]
+	if !ok || item.Status != ModerationPending {
+		return false, nil
+	}
+
+	item.Status = status
+	item.ReviewerId = sql.NullString{String: reviewerId, Valid: true}
+	item.ReviewDate = sql.NullTime{Time: date, Valid: true}
+	s.moderationItems[id] = item
+	return true, nil
+}
+
+func (s *MemoryStore) UndoModerationApproval(ctx context.Context, id ModerationItemID, status ModerationStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.moderationItems[id]
+	if !ok || item.Status != ModerationApproved {
+		return nil
+	}
+
+	item.Status = status
+	if status == ModerationPending {
+		item.ReviewerId = sql.NullString{}
+		item.ReviewDate = sql.NullTime{}
+	}
+	s.moderationItems[id] = item
+	return nil
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type ModeratorActionID = string
+
+type ModeratorActionKind string
+
+const (
+	// Deleting or editing the content of someone else
+	ActionDelete         ModeratorActionKind = "delete"
+	ActionEdit           ModeratorActionKind = "edit"
+	ActionHide           ModeratorActionKind = "hide"
+	ActionUnhide         ModeratorActionKind = "unhide"
+	ActionSuspend        ModeratorActionKind = "suspend"
+	ActionUnsuspend      ModeratorActionKind = "unsuspend"
+	ActionChangeRole     ModeratorActionKind = "change_role"
+	ActionResolveReport  ModeratorActionKind = "resolve_report"
+	ActionDismissReport  ModeratorActionKind = "dismiss_report"
+	ActionApproveContent ModeratorActionKind = "approve_content"
+	ActionRejectContent  ModeratorActionKind = "reject_content"
+)
+
+// Something a moderator or an admin did, kept so their work can be reviewed
+type ModeratorAction struct {
+	Id          ModeratorActionID
+	ModeratorId UserID
+	Action      ModeratorActionKind
+	TargetKind  TargetKind
+	TargetId    string
+	// The report that led to the action, if any
+	ReportId     sql.NullString
+	Note         string
+	CreationDate time.Time
+}
+
+func (a ModeratorAction) Cursor() Cursor {
+	return Cursor{Date: a.CreationDate, Id: a.Id}
+}
+
+type ModeratorActionFilter struct {
+	// Empty for every moderator
+	ModeratorId UserID
+	// Empty for every target
+	TargetId string
+}
+
+func (f ModeratorActionFilter) matches(action ModeratorAction) bool {
+	return (f.ModeratorId == "" || action.ModeratorId == f.ModeratorId) && (f.TargetId == "" || action.TargetId == f.TargetId)
+}
+
+type ModeratorActionStore interface {
+	InsertModeratorAction(ctx context.Context, action ModeratorAction) error
+	// Returns a page of the actions that match the filter, the most recent first
+	FindModeratorActions(ctx context.Context, filter ModeratorActionFilter, page Page) ([]ModeratorAction, error)
+}
+
+func (s *PostgresStore) InsertModeratorAction(ctx context.Context, action ModeratorAction) error {
+	stmt := `INSERT INTO ModeratorActions(id, moderator_id, action, target_kind, target_id, report_id, note, creation_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := s.exec(
+		ctx, stmt,
+		action.Id, action.ModeratorId, action.Action, action.TargetKind, action.TargetId, action.ReportId, action.Note, action.CreationDate,
+	)
+	return err
+}
+
+func (s *PostgresStore) FindModeratorActions(ctx context.Context, filter ModeratorActionFilter, page Page) ([]ModeratorAction, error) {
+	actions := make([]ModeratorAction, 0, page.Limit)
+
+	query := "SELECT id, moderator_id, action, target_kind, target_id, report_id, note, creation_date FROM ModeratorActions WHERE true"
+	args := []any{}
+
+	if filter.ModeratorId != "" {
+		args = append(args, filter.ModeratorId)
+		query += fmt.Sprintf(" AND moderator_id = $%d", len(args))
+	}
+	if filter.TargetId != "" {
+		args = append(args, filter.TargetId)
+		query += fmt.Sprintf(" AND target_id = $%d", len(args))
+	}
+	if page.After != nil {
+		args = append(args, page.After.Date, page.After.Id)
+		query += fmt.Sprintf(" AND (creation_date, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	query += fmt.Sprintf(" ORDER BY creation_date DESC, id DESC LIMIT %d", page.Limit)
+
+	cursor, err := s.query(ctx, query, args...)
+	if isInvalidId(err) {
+		return actions, nil
+	}
+	if err != nil {
+		return actions, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		action := ModeratorAction{}
+		err := cursor.Scan(
+			&action.Id, &action.ModeratorId, &action.Action, &action.TargetKind, &action.TargetId, &action.ReportId, &action.Note, &action.CreationDate,
+		)
+		if err != nil {
+			return actions, err
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, cursor.Err()
+}
+
+func (s *MemoryStore) InsertModeratorAction(ctx context.Context, action ModeratorAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.moderatorActions[action.Id]; ok {
+		return apperrors.Conflict("Moderator action already exists")
+	}
+	if _, ok := s.users[action.ModeratorId]; !ok {
+		return apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	s.moderatorActions[action.Id] = action
+	return nil
+}
+
+func (s *MemoryStore) FindModeratorActions(ctx context.Context, filter ModeratorActionFilter, page Page) ([]ModeratorAction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	actions := make([]ModeratorAction, 0, page.Limit)
+	for _, action := range s.moderatorActions {
+		if filter.matches(action) && page.Includes(action.CreationDate, action.Id) {
+			actions = append(actions, action)
+		}
+	}
+
+	slices.SortFunc(actions, func(a, b ModeratorAction) int {
+		return a.Cursor().Compare(b.Cursor())
+	})
+
+	if len(actions) > page.Limit {
+		actions = actions[:page.Limit]
+	}
+
+	return actions, nil
+}
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type NotificationID = string
+
+type NotificationKind string
+
+const (
+	// Someone asked the user, the subject is the question
+	NotificationQuestion NotificationKind = "question"
+	// A question the user asked was answered, the subject is the question
+	NotificationAnswer NotificationKind = "answer"
+	// Someone followed the user
+	NotificationFollower NotificationKind = "follower"
+)
+
+type Notification struct {
+	Id     NotificationID
+	UserId UserID
+	Kind   NotificationKind
+	// Null when whoever caused it must stay anonymous
+	ActorId      sql.NullString
+	SubjectId    sql.NullString
+	CreationDate time.Time
+	ReadDate     sql.NullTime
+}
+
+type NotificationStore interface {
+	InsertNotification(ctx context.Context, notification Notification) error
+	// Returns a page of the notifications of the user, newest first
+	FindNotifications(ctx context.Context, userId UserID, unreadOnly bool, page Page) ([]Notification, error)
+	CountUnreadNotifications(ctx context.Context, userId UserID) (int, error)
+	// Marks the given notifications as read, or all of them when ids is empty. Returns how many changed
+	MarkNotificationsRead(ctx context.Context, userId UserID, ids []NotificationID, readDate time.Time) (int, error)
+}
+
+func (s *PostgresStore) InsertNotification(ctx context.Context, notification Notification) error {
+	stmt := `
+		INSERT INTO Notifications(id, user_id, kind, actor_id, subject_id, creation_date, read_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := s.exec(
+		ctx, stmt,
+		notification.Id, notification.UserId, notification.Kind, notification.ActorId,
+		notification.SubjectId, notification.CreationDate, notification.ReadDate,
+	)
+	return err
+}
+
+func (s *PostgresStore) FindNotifications(ctx context.Context, userId UserID, unreadOnly bool, page Page) ([]Notification, error) {
+	notifications := make([]Notification, 0, page.Limit)
+
+	query := "SELECT id, user_id, kind, actor_id, subject_id, creation_date, read_date FROM Notifications WHERE user_id = $1"
+	args := []any{userId}
+
+	if unreadOnly {
+		query += " AND read_date IS null"
+	}
+	if page.After != nil {
+		query += " AND (creation_date, id) < ($2, $3)"
+		args = append(args, page.After.Date, page.After.Id)
+	}
+
+	query += fmt.Sprintf(" ORDER BY creation_date DESC, id DESC LIMIT %d", page.Limit)
+
+	cursor, err := s.query(ctx, query, args...)
+	if isInvalidId(err) {
+		return notifications, nil
+	}
+	if err != nil {
+		return notifications, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		n := Notification{}
+
+		err = cursor.Scan(&n.Id, &n.UserId, &n.Kind, &n.ActorId, &n.SubjectId, &n.CreationDate, &n.ReadDate)
+		if err != nil {
+			return notifications, err
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	return notifications, cursor.Err()
+}
+
+func (s *PostgresStore) CountUnreadNotifications(ctx context.Context, userId UserID) (int, error) {
+	count := 0
+
+	query := "SELECT count(*) FROM Notifications WHERE user_id = $1 AND read_date IS null"
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&count)
+	if isInvalidId(err) {
+		return 0, nil
+	}
+
+	return count, translateError(err)
+}
+
+func (s *PostgresStore) MarkNotificationsRead(ctx context.Context, userId UserID, ids []NotificationID, readDate time.Time) (int, error) {
+	stmt := "UPDATE Notifications SET read_date = $2 WHERE user_id = $1 AND read_date IS null"
+	args := []any{userId, readDate}
+
+	if len(ids) > 0 {
+		stmt += " AND id = ANY($3::uuid[])"
+		args = append(args, pq.Array(ids))
+	}
+
+	result, err := s.exec(ctx, stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+func (s *MemoryStore) InsertNotification(ctx context.Context, notification Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notifications[notification.Id]; ok {
+		return apperrors.Conflict("Notification already exists")
+	}
+	if _, ok := s.users[notification.UserId]; !ok {
+		return apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	s.notifications[notification.Id] = notification
+	return nil
+}
+
+func (s *MemoryStore) FindNotifications(ctx context.Context, userId UserID, unreadOnly bool, page Page) ([]Notification, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notifications := make([]Notification, 0, page.Limit)
+	for _, n := range s.notifications {
+		if n.UserId == userId && (!unreadOnly || !n.ReadDate.Valid) && page.Includes(n.CreationDate, n.Id) {
+			notifications = append(notifications, n)
+		}
+	}
+
+	slices.SortFunc(notifications, func(a, b Notification) int {
+		return Cursor{Date: a.CreationDate, Id: a.Id}.Compare(Cursor{Date: b.CreationDate, Id: b.Id})
+	})
+
+	if len(notifications) > page.Limit {
+		notifications = notifications[:page.Limit]
+	}
+
+	return notifications, nil
+}
+
+func (s *MemoryStore) CountUnreadNotifications(ctx context.Context, userId UserID) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, n := range s.notifications {
+		if n.UserId == userId && !n.ReadDate.Valid {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *MemoryStore) MarkNotificationsRead(ctx context.Context, userId UserID, ids []NotificationID, readDate time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for id, n := range s.notifications {
+		if n.UserId != userId || n.ReadDate.Valid || (len(ids) > 0 && !slices.Contains(ids, id)) {
+			continue
+		}
+
+		n.ReadDate = sql.NullTime{Time: readDate, Valid: true}
+		s.notifications[id] = n
+		count++
+	}
+
+	return count, nil
+}
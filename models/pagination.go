@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Position of the last item of a page, listings are ordered from the newest item
+// and the next page starts right after the cursor
+type Cursor struct {
+	Date time.Time
+	Id   string
+}
+
+type Page struct {
+	// Nil for the first page
+	After *Cursor
+	Limit int
+}
+
+// Orders newest first, ties broken by id like the postgres queries do
+func (c Cursor) Compare(other Cursor) int {
+	if c := other.Date.Compare(c.Date); c != 0 {
+		return c
+	}
+	if c.Id > other.Id {
+		return -1
+	}
+	if c.Id < other.Id {
+		return 1
+	}
+	return 0
+}
+
+// Reports whether an item with that date and id belongs after the cursor
+func (p Page) Includes(date time.Time, id string) bool {
+	if p.After == nil {
+		return true
+	}
+
+	return p.After.Compare(Cursor{Date: date, Id: id}) < 0
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strconv"
+	"time"
+)
+
+// A previous version of a post, numbered from 1 for the version it was created with
+type PostRevision struct {
+	PostId  PostID
+	Number  int
+	Title   string
+	Content string
+	// When this version was written, and when an edit replaced it
+	CreationDate    time.Time
+	ReplacementDate time.Time
+	// Replaced by a moderator or admin editing the post, its content isn't shown to everyone nor restored
+	Redacted bool
+}
+
+// Revisions are only paginated within a post, so the number is enough to place them
+func (r PostRevision) Cursor() Cursor {
+	return Cursor{Date: r.CreationDate, Id: strconv.Itoa(r.Number)}
+}
+
+type PostRevisionStore interface {
+	// Returns a page of the revisions of the post, the most recent first
+	FindPostRevisions(ctx context.Context, postId PostID, page Page) ([]PostRevision, error)
+	// Returns nil without error when it doesn't exist
+	FindPostRevision(ctx context.Context, postId PostID, number int) (*PostRevision, error)
+}
+
+// Number of the last revision of the previous page, or one past every revision
+func revisionsBefore(page Page) int {
+	if page.After == nil {
+		return math.MaxInt32
+	}
+
+	number, err := strconv.Atoi(page.After.Id)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+const postRevisionColumns = "post_id, number, title, content, creation_date, replacement_date, redacted"
+
+func scanPostRevision(row interface{ Scan(dest ...any) error }, revision *PostRevision) error {
+	return row.Scan(&revision.PostId, &revision.Number, &revision.Title, &revision.Content, &revision.CreationDate, &revision.ReplacementDate, &revision.Redacted)
+}
+
+func (s *PostgresStore) FindPostRevisions(ctx context.Context, postId PostID, page Page) ([]PostRevision, error) {
+	revisions := make([]PostRevision, 0, page.Limit)
+
+	query := "SELECT " + postRevisionColumns + " FROM PostRevisions WHERE post_id = $1 AND number < $2 ORDER BY number DESC LIMIT $3"
+	cursor, err := s.query(ctx, query, postId, revisionsBefore(page), page.Limit)
+	if isInvalidId(err) {
+		return revisions, nil
+	}
+	if err != nil {
+		return revisions, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		revision := PostRevision{}
+		if err := scanPostRevision(cursor, &revision); err != nil {
+			return revisions, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, cursor.Err()
+}
+
+func (s *PostgresStore) FindPostRevision(ctx context.Context, postId PostID, number int) (*PostRevision, error) {
+	revision := PostRevision{}
+
+	query := "SELECT " + postRevisionColumns + " FROM PostRevisions WHERE post_id = $1 AND number = $2"
+	row := s.db.QueryRowContext(ctx, query, postId, number)
+	if err := scanPostRevision(row, &revision); err != nil {
+		if err == sql.ErrNoRows || isInvalidId(err) {
+			return nil, nil
+		}
+
+		return nil, translateError(err)
+	}
+
+	return &revision, nil
+}
+
+func (s *MemoryStore) FindPostRevisions(ctx context.Context, postId PostID, page Page) ([]PostRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	before := revisionsBefore(page)
+
+	revisions := make([]PostRevision, 0, page.Limit)
+	stored := s.postRevisions[postId]
+	for i := len(stored) - 1; i >= 0 && len(revisions) < page.Limit; i-- {
+		if stored[i].Number < before {
+			revisions = append(revisions, stored[i])
+		}
+	}
+
+	return revisions, nil
+}
+
+func (s *MemoryStore) FindPostRevision(ctx context.Context, postId PostID, number int) (*PostRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := s.postRevisions[postId]
+	if number < 1 || number > len(revisions) {
+		return nil, nil
+	}
+
+	revision := revisions[number-1]
+	return &revision, nil
+}
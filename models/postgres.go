@@ -0,0 +1,67 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+// Store implementation backed by the Postgres tables created by the migrations
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Returns true when the statement modified exactly one row
+func affectedOne(result sql.Result) (bool, error) {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (s *PostgresStore) exec(ctx context.Context, stmt string, args ...any) (sql.Result, error) {
+	result, err := s.db.ExecContext(ctx, stmt, args...)
+	return result, translateError(err)
+}
+
+func (s *PostgresStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	return rows, translateError(err)
+}
+
+// Ids that aren't valid uuids are rejected by postgres, but for us they just don't exist
+func isInvalidId(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "22P02"
+}
+
+// Turns the postgres errors caused by the client input into domain errors
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	// unique_violation
+	case "23505":
+		return apperrors.Conflict("Resource already exists").Wrap(err)
+	// foreign_key_violation
+	case "23503":
+		return apperrors.NotFound("Referenced resource doesn't exist").Wrap(err)
+	// invalid_text_representation, ids that aren't valid uuids can't exist
+	case "22P02":
+		return apperrors.NotFound("Resource doesn't exist").Wrap(err)
+	}
+
+	return err
+}
@@ -1,10 +1,13 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"slices"
 	"time"
 
-	"github.com/preguntame/preguntame-backend/databases"
+	"github.com/preguntame/preguntame-backend/apperrors"
 )
 
 type PostID = string
@@ -16,50 +19,311 @@ type Post struct {
 	Content      string
 	CreationDate time.Time
 	DeletionDate sql.NullTime
+	// Who deleted the post, its owner or a moderator
+	DeleterId sql.NullString
+	// Set when a moderator hides the post, only its owner can still see it
+	HiddenDate sql.NullTime
+	// Date of the last edit, every previous version is kept as a PostRevision
+	EditDate  sql.NullTime
+	EditCount int
 }
 
-func InsertPost(post Post) error {
+type PostStore interface {
+	// Returns a page of the posts of the user, newest first. Soft deleted and hidden posts are only included when asked
+	FindPostsByOwnerId(ctx context.Context, ownerId UserID, includeDeleted bool, page Page) ([]Post, error)
+	// Returns nil when the post doesn't exist or doesn't belong to the user, soft deleted and hidden posts are returned
+	FindPostById(ctx context.Context, ownerId UserID, postId PostID) (*Post, error)
+	// Same as FindPostById for callers that only know the id of the post
+	LookupPost(ctx context.Context, postId PostID) (*Post, error)
+	InsertPost(ctx context.Context, post Post) error
+	// Keeps the current version as a revision before replacing it. Soft deleted posts can't be updated, returns false for them
+	UpdatePost(ctx context.Context, ownerId UserID, postId PostID, content string, title string, editorId UserID, editDate time.Time) (bool, error)
+	SoftDeletePost(ctx context.Context, ownerId UserID, postId PostID, deleterId UserID, deletionTime time.Time) (bool, error)
+	// Takes the post out of the trash if the owner deleted it after since, false otherwise
+	RestorePost(ctx context.Context, ownerId UserID, postId PostID, since time.Time) (bool, error)
+	// Hides the post, or shows it again with a date that isn't valid
+	UpdatePostHidden(ctx context.Context, postId PostID, hiddenDate sql.NullTime) (bool, error)
+}
+
+const postColumns = "id, owner_id, title, content, creation_date, deletion_date, deleter_id, hidden_date, edit_date, edit_count"
+
+func scanPost(row interface{ Scan(dest ...any) error }, post *Post) error {
+	return row.Scan(
+		&post.Id, &post.OwnerId, &post.Title, &post.Content, &post.CreationDate, &post.DeletionDate, &post.DeleterId, &post.HiddenDate,
+		&post.EditDate, &post.EditCount,
+	)
+}
+
+func (s *PostgresStore) FindPostsByOwnerId(ctx context.Context, ownerId UserID, includeDeleted bool, page Page) ([]Post, error) {
+	posts := make([]Post, 0, page.Limit)
+
+	query := "SELECT " + postColumns + " FROM Posts WHERE owner_id = $1"
+	args := []any{ownerId}
+
+	if !includeDeleted {
+		query += " AND deletion_date IS null AND hidden_date IS null"
+	}
+	if page.After != nil {
+		query += " AND (creation_date, id) < ($2, $3)"
+		args = append(args, page.After.Date, page.After.Id)
+	}
+
+	query += fmt.Sprintf(" ORDER BY creation_date DESC, id DESC LIMIT %d", page.Limit)
+
+	cursor, err := s.query(ctx, query, args...)
+	if isInvalidId(err) {
+		return posts, nil
+	}
+	if err != nil {
+		return posts, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		post := Post{}
+
+		err = scanPost(cursor, &post)
+		if err != nil {
+			return posts, err
+		}
+
+		posts = append(posts, post)
+	}
+
+	return posts, cursor.Err()
+}
+
+func (s *PostgresStore) FindPostById(ctx context.Context, ownerId UserID, postId PostID) (*Post, error) {
+	post := Post{}
+
+	query := "SELECT " + postColumns + " FROM Posts WHERE id = $1 AND owner_id = $2"
+	row := s.db.QueryRowContext(ctx, query, postId, ownerId)
+	if err := scanPost(row, &post); err != nil {
+		if err == sql.ErrNoRows || isInvalidId(err) {
+			return nil, nil
+		}
+
+		return nil, translateError(err)
+	}
+
+	return &post, nil
+}
+
+func (s *PostgresStore) LookupPost(ctx context.Context, postId PostID) (*Post, error) {
+	post := Post{}
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+postColumns+" FROM Posts WHERE id = $1", postId)
+	if err := scanPost(row, &post); err != nil {
+		if err == sql.ErrNoRows || isInvalidId(err) {
+			return nil, nil
+		}
+
+		return nil, translateError(err)
+	}
+
+	return &post, nil
+}
+
+func (s *PostgresStore) InsertPost(ctx context.Context, post Post) error {
 	stmt := "INSERT INTO Posts(id, content, title, owner_Id, creation_date, deletion_date) VALUES ($1, $2, $3, $4, $5, $6)"
-	_, err := databases.DbPool.Exec(stmt, post.Id, post.Content, post.Title, post.OwnerId, post.CreationDate, post.DeletionDate)
+	_, err := s.exec(ctx, stmt, post.Id, post.Content, post.Title, post.OwnerId, post.CreationDate, post.DeletionDate)
 	return err
 }
 
 //En sql null no es comparable con ningun otro valor por lo tanto el operador = no es aplicable, en su lugar se utiliza
 //el operador IS.
 
-func UpdatePost(ownerId UserID, postID PostID, content string, title string) (bool, error) {
-	stmt := "UPDATE Posts SET content = $1, title = $2 WHERE id = $3 AND owner_id = $4 AND deletion_date IS null"
-	result, err := databases.DbPool.Exec(stmt, content, title, postID, ownerId)
+func (s *PostgresStore) UpdatePost(ctx context.Context, ownerId UserID, postId PostID, content string, title string, editorId UserID, editDate time.Time) (bool, error) {
+	// The row is locked so concurrent edits get consecutive revision numbers
+	stmt := `
+		WITH previous AS (
+			SELECT id, title, content, COALESCE(edit_date, creation_date) AS version_date, edit_count FROM Posts
+			WHERE id = $3 AND owner_id = $4 AND deletion_date IS null
+			FOR UPDATE
+		), revision AS (
+			INSERT INTO PostRevisions(post_id, number, title, content, creation_date, replacement_date, redacted)
+			SELECT id, edit_count + 1, title, content, version_date, $5, $6 FROM previous
+		)
+		UPDATE Posts SET content = $1, title = $2, edit_date = $5, edit_count = Posts.edit_count + 1
+		FROM previous WHERE Posts.id = previous.id`
+	result, err := s.exec(ctx, stmt, content, title, postId, ownerId, editDate, editorId != ownerId)
 	if err != nil {
 		return false, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) SoftDeletePost(ctx context.Context, ownerId UserID, postId PostID, deleterId UserID, deletionTime time.Time) (bool, error) {
+	stmt := "UPDATE Posts SET deletion_date = $3, deleter_id = $4 WHERE id=$1 AND owner_id =$2 AND deletion_date IS null"
+	result, err := s.exec(ctx, stmt, postId, ownerId, deletionTime, deleterId)
 	if err != nil {
 		return false, err
 	}
-	if rowsAffected != 1 {
-		return false, nil
-	}
 
-	return true, nil
+	return affectedOne(result)
 }
 
-func SoftDeletePost(ownerId UserID, postId PostID, deletionTime time.Time) (bool, error) {
-	stmt := "UPDATE Posts SET deletion_date = $3 WHERE id=$1 AND owner_id =$2 AND deletion_date IS null"
-	result, err := databases.DbPool.Exec(stmt, postId, ownerId, deletionTime)
+func (s *PostgresStore) RestorePost(ctx context.Context, ownerId UserID, postId PostID, since time.Time) (bool, error) {
+	stmt := `UPDATE Posts SET deletion_date = null, deleter_id = null
+		WHERE id = $1 AND owner_id = $2 AND deleter_id = owner_id AND deletion_date >= $3`
+	result, err := s.exec(ctx, stmt, postId, ownerId, since)
+	if isInvalidId(err) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) UpdatePostHidden(ctx context.Context, postId PostID, hiddenDate sql.NullTime) (bool, error) {
+	result, err := s.exec(ctx, "UPDATE Posts SET hidden_date = $1 WHERE id = $2", hiddenDate, postId)
+	if isInvalidId(err) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
-	if rowsAffected != 1 {
+
+	return affectedOne(result)
+}
+
+func (s *MemoryStore) FindPostsByOwnerId(ctx context.Context, ownerId UserID, includeDeleted bool, page Page) ([]Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	posts := make([]Post, 0, page.Limit)
+	for _, post := range s.posts {
+		if post.OwnerId == ownerId && (includeDeleted || !post.DeletionDate.Valid && !post.HiddenDate.Valid) && page.Includes(post.CreationDate, post.Id) {
+			posts = append(posts, post)
+		}
+	}
+
+	slices.SortFunc(posts, func(a, b Post) int {
+		return Cursor{Date: a.CreationDate, Id: a.Id}.Compare(Cursor{Date: b.CreationDate, Id: b.Id})
+	})
+
+	if len(posts) > page.Limit {
+		posts = posts[:page.Limit]
+	}
+
+	return posts, nil
+}
+
+func (s *MemoryStore) FindPostById(ctx context.Context, ownerId UserID, postId PostID) (*Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[postId]
+	if !ok || post.OwnerId != ownerId {
+		return nil, nil
+	}
+
+	return &post, nil
+}
+
+func (s *MemoryStore) LookupPost(ctx context.Context, postId PostID) (*Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[postId]
+	if !ok {
+		return nil, nil
+	}
+
+	return &post, nil
+}
+
+func (s *MemoryStore) InsertPost(ctx context.Context, post Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[post.Id]; ok {
+		return apperrors.Conflict("Post already exists")
+	}
+	if _, ok := s.users[post.OwnerId]; !ok {
+		return apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	s.posts[post.Id] = post
+	s.indexPost(post)
+	return nil
+}
+
+func (s *MemoryStore) UpdatePost(ctx context.Context, ownerId UserID, postId PostID, content string, title string, editorId UserID, editDate time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[postId]
+	if !ok || post.OwnerId != ownerId || post.DeletionDate.Valid {
+		return false, nil
+	}
+
+	versionDate := post.CreationDate
+	if post.EditDate.Valid {
+		versionDate = post.EditDate.Time
+	}
+	s.postRevisions[postId] = append(s.postRevisions[postId], PostRevision{
+		PostId:          postId,
+		Number:          post.EditCount + 1,
+		Title:           post.Title,
+		Content:         post.Content,
+		CreationDate:    versionDate,
+		ReplacementDate: editDate,
+		Redacted:        editorId != ownerId,
+	})
+
+	post.Content = content
+	post.Title = title
+	post.EditDate = sql.NullTime{Time: editDate, Valid: true}
+	post.EditCount++
+	s.posts[postId] = post
+	s.indexPost(post)
+	return true, nil
+}
+
+func (s *MemoryStore) SoftDeletePost(ctx context.Context, ownerId UserID, postId PostID, deleterId UserID, deletionTime time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[postId]
+	if !ok || post.OwnerId != ownerId || post.DeletionDate.Valid {
 		return false, nil
 	}
 
+	post.DeletionDate = sql.NullTime{Time: deletionTime, Valid: true}
+	post.DeleterId = sql.NullString{String: deleterId, Valid: true}
+	s.posts[postId] = post
 	return true, nil
+}
+
+func (s *MemoryStore) RestorePost(ctx context.Context, ownerId UserID, postId PostID, since time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	post, ok := s.posts[postId]
+	if !ok || post.OwnerId != ownerId || post.DeleterId.String != ownerId || !post.DeletionDate.Valid || post.DeletionDate.Time.Before(since) {
+		return false, nil
+	}
+
+	post.DeletionDate = sql.NullTime{}
+	post.DeleterId = sql.NullString{}
+	s.posts[postId] = post
+	return true, nil
+}
+
+func (s *MemoryStore) UpdatePostHidden(ctx context.Context, postId PostID, hiddenDate sql.NullTime) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[postId]
+	if !ok {
+		return false, nil
+	}
+
+	post.HiddenDate = hiddenDate
+	s.posts[postId] = post
+	return true, nil
 }
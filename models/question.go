@@ -1,9 +1,13 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"slices"
+	"time"
 
-	"github.com/preguntame/preguntame-backend/databases"
+	"github.com/preguntame/preguntame-backend/apperrors"
 )
 
 type QuestionID = string
@@ -14,14 +18,100 @@ type Question struct {
 	Message   string
 	Reply     sql.NullString
 	Favourite bool
-	Signature sql.NullString
+	// Who asked, kept even for anonymous questions. Null for questions asked without logging in
+	AskerId   sql.NullString
+	Anonymous bool
+	// Name of the asker when the question was signed
+	Signature    sql.NullString
+	CreationDate time.Time
+	ReplyDate    sql.NullTime
+	// Set when a moderator hides the question, it's left out of every listing
+	HiddenDate sql.NullTime
+	// Deleted questions stay in the trash until they are restored or purged
+	DeletionDate sql.NullTime
+	DeleterId    sql.NullString
 }
 
-func FindQuestionsByUserId(userId UserID) ([]Question, error) {
-	questions := make([]Question, 0, 16)
+type QuestionFilter string
 
-	query := "SELECT id, target_id, message, reply, favourite FROM Questions WHERE target_id = $1"
-	cursor, err := databases.DbPool.Query(query, userId)
+const (
+	QuestionsAll        QuestionFilter = "all"
+	QuestionsAnswered   QuestionFilter = "answered"
+	QuestionsUnanswered QuestionFilter = "unanswered"
+	QuestionsFavourite  QuestionFilter = "favourite"
+)
+
+func (f QuestionFilter) matches(question Question) bool {
+	switch f {
+	case QuestionsAnswered:
+		return question.Reply.Valid
+	case QuestionsUnanswered:
+		return !question.Reply.Valid
+	case QuestionsFavourite:
+		return question.Favourite
+	}
+
+	return true
+}
+
+func (f QuestionFilter) condition() string {
+	switch f {
+	case QuestionsAnswered:
+		return " AND reply IS NOT NULL"
+	case QuestionsUnanswered:
+		return " AND reply IS NULL"
+	case QuestionsFavourite:
+		return " AND favourite"
+	}
+
+	return ""
+}
+
+type QuestionStore interface {
+	// Returns a page of the questions sent to the user, newest first. Hidden and deleted questions are left out
+	FindQuestionsByUserId(ctx context.Context, userId UserID, filter QuestionFilter, page Page) ([]Question, error)
+	// Returns nil without error when there is no question with that id or it was deleted
+	FindQuestionById(ctx context.Context, questionId QuestionID) (*Question, error)
+	InsertQuestion(ctx context.Context, question Question) error
+	// Only replies questions that haven't been replied yet, returns false otherwise
+	UpdateQuestionReply(ctx context.Context, userId UserID, questionId QuestionID, reply string, replyDate time.Time) (bool, error)
+	UpdateQuestionFavourite(ctx context.Context, userId UserID, questionId QuestionID, favourite bool) (bool, error)
+	// Moves the question to the trash, false when it doesn't exist or was already deleted
+	SoftDeleteQuestion(ctx context.Context, userId UserID, questionId QuestionID, deleterId UserID, deletionDate time.Time) (bool, error)
+	// Takes the question out of the trash if the user deleted it after since, false otherwise
+	RestoreQuestion(ctx context.Context, userId UserID, questionId QuestionID, since time.Time) (bool, error)
+	// Hides the question, or shows it again with a date that isn't valid
+	UpdateQuestionHidden(ctx context.Context, questionId QuestionID, hiddenDate sql.NullTime) (bool, error)
+}
+
+const questionColumns = `id, target_id, message, reply, favourite, asker_id, anonymous, signature, creation_date, reply_date, hidden_date,
+	deletion_date, deleter_id`
+
+func scanQuestion(row interface{ Scan(dest ...any) error }, question *Question) error {
+	return row.Scan(
+		&question.Id, &question.UserId, &question.Message, &question.Reply, &question.Favourite,
+		&question.AskerId, &question.Anonymous, &question.Signature, &question.CreationDate, &question.ReplyDate, &question.HiddenDate,
+		&question.DeletionDate, &question.DeleterId,
+	)
+}
+
+func (s *PostgresStore) FindQuestionsByUserId(ctx context.Context, userId UserID, filter QuestionFilter, page Page) ([]Question, error) {
+	questions := make([]Question, 0, page.Limit)
+
+	query := "SELECT " + questionColumns + " FROM Questions WHERE target_id = $1 AND hidden_date IS null AND deletion_date IS null" + filter.condition()
+	args := []any{userId}
+
+	if page.After != nil {
+		query += " AND (creation_date, id) < ($2, $3)"
+		args = append(args, page.After.Date, page.After.Id)
+	}
+
+	query += fmt.Sprintf(" ORDER BY creation_date DESC, id DESC LIMIT %d", page.Limit)
+
+	cursor, err := s.query(ctx, query, args...)
+	if isInvalidId(err) {
+		return questions, nil
+	}
 	if err != nil {
 		return questions, err
 	}
@@ -30,7 +120,7 @@ func FindQuestionsByUserId(userId UserID) ([]Question, error) {
 	for cursor.Next() {
 		question := Question{}
 
-		err = cursor.Scan(&question.Id, &question.UserId, &question.Message, &question.Reply, &question.Favourite)
+		err = scanQuestion(cursor, &question)
 		if err != nil {
 			return questions, err
 		}
@@ -46,62 +136,211 @@ func FindQuestionsByUserId(userId UserID) ([]Question, error) {
 	return questions, nil
 }
 
-func InsertQuestion(question Question) error {
-	stmt := "INSERT INTO Questions(id, target_id, message, reply, favourite, signature) VALUES ($1, $2, $3, $4, $5, $6)"
-	_, err := databases.DbPool.Exec(stmt, question.Id, question.UserId, question.Message, question.Reply, question.Favourite, question.Signature)
+func (s *PostgresStore) FindQuestionById(ctx context.Context, questionId QuestionID) (*Question, error) {
+	question := Question{}
+
+	query := "SELECT " + questionColumns + " FROM Questions WHERE id = $1 AND deletion_date IS null"
+	row := s.db.QueryRowContext(ctx, query, questionId)
+	err := scanQuestion(row, &question)
+	if err != nil {
+		if err == sql.ErrNoRows || isInvalidId(err) {
+			return nil, nil
+		}
+
+		return nil, translateError(err)
+	}
+
+	return &question, nil
+}
+
+func (s *PostgresStore) InsertQuestion(ctx context.Context, question Question) error {
+	stmt := `
+		INSERT INTO Questions(id, target_id, message, reply, favourite, asker_id, anonymous, signature, creation_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := s.exec(
+		ctx, stmt,
+		question.Id, question.UserId, question.Message, question.Reply, question.Favourite,
+		question.AskerId, question.Anonymous, question.Signature, question.CreationDate,
+	)
 	return err
 }
 
-func UpdateQuestionReply(userId UserID, questionId QuestionID, reply string) (bool, error) {
-	stmt := "UPDATE Questions SET reply = $1 WHERE id = $2 AND target_id = $3 AND reply IS NULL"
-	result, err := databases.DbPool.Exec(stmt, reply, questionId, userId)
+func (s *PostgresStore) UpdateQuestionReply(ctx context.Context, userId UserID, questionId QuestionID, reply string, replyDate time.Time) (bool, error) {
+	stmt := "UPDATE Questions SET reply = $1, reply_date = $4 WHERE id = $2 AND target_id = $3 AND reply IS NULL AND deletion_date IS null"
+	result, err := s.exec(ctx, stmt, reply, questionId, userId, replyDate)
 	if err != nil {
 		return false, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) UpdateQuestionFavourite(ctx context.Context, userId UserID, questionId QuestionID, favourite bool) (bool, error) {
+	stmt := "UPDATE Questions SET favourite = $1 WHERE id = $2 AND target_id = $3 AND deletion_date IS null"
+	result, err := s.exec(ctx, stmt, favourite, questionId, userId)
 	if err != nil {
 		return false, err
 	}
-	if rowsAffected != 1 {
-		return false, nil
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) SoftDeleteQuestion(ctx context.Context, userId UserID, questionId QuestionID, deleterId UserID, deletionDate time.Time) (bool, error) {
+	stmt := "UPDATE Questions SET deletion_date = $3, deleter_id = $4 WHERE id = $1 AND target_id = $2 AND deletion_date IS null"
+	result, err := s.exec(ctx, stmt, questionId, userId, deletionDate, deleterId)
+	if err != nil {
+		return false, err
 	}
 
-	return true, nil
+	return affectedOne(result)
 }
-func UpdateQuestionFavourite(userId UserID, questionId QuestionID, favourite bool) (bool, error) {
-	stmt := "UPDATE Questions SET favourite = $1 WHERE id = $2 AND target_id = $3"
-	result, err := databases.DbPool.Exec(stmt, favourite, questionId, userId)
+
+func (s *PostgresStore) RestoreQuestion(ctx context.Context, userId UserID, questionId QuestionID, since time.Time) (bool, error) {
+	stmt := `UPDATE Questions SET deletion_date = null, deleter_id = null
+		WHERE id = $1 AND target_id = $2 AND deleter_id = target_id AND deletion_date >= $3`
+	result, err := s.exec(ctx, stmt, questionId, userId, since)
+	if isInvalidId(err) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) UpdateQuestionHidden(ctx context.Context, questionId QuestionID, hiddenDate sql.NullTime) (bool, error) {
+	result, err := s.exec(ctx, "UPDATE Questions SET hidden_date = $1 WHERE id = $2", hiddenDate, questionId)
+	if isInvalidId(err) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
-	if rowsAffected != 1 {
+
+	return affectedOne(result)
+}
+
+func (s *MemoryStore) FindQuestionsByUserId(ctx context.Context, userId UserID, filter QuestionFilter, page Page) ([]Question, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	questions := make([]Question, 0, page.Limit)
+	for _, question := range s.questions {
+		if question.UserId == userId && !question.HiddenDate.Valid && !question.DeletionDate.Valid && filter.matches(question) && page.Includes(question.CreationDate, question.Id) {
+			questions = append(questions, question)
+		}
+	}
+
+	slices.SortFunc(questions, func(a, b Question) int {
+		return Cursor{Date: a.CreationDate, Id: a.Id}.Compare(Cursor{Date: b.CreationDate, Id: b.Id})
+	})
+
+	if len(questions) > page.Limit {
+		questions = questions[:page.Limit]
+	}
+
+	return questions, nil
+}
+
+func (s *MemoryStore) FindQuestionById(ctx context.Context, questionId QuestionID) (*Question, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	question, ok := s.questions[questionId]
+	if !ok || question.DeletionDate.Valid {
+		return nil, nil
+	}
+
+	return &question, nil
+}
+
+func (s *MemoryStore) InsertQuestion(ctx context.Context, question Question) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.questions[question.Id]; ok {
+		return apperrors.Conflict("Question already exists")
+	}
+	if _, ok := s.users[question.UserId]; !ok {
+		return apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	s.questions[question.Id] = question
+	s.indexQuestion(question)
+	return nil
+}
+
+func (s *MemoryStore) UpdateQuestionReply(ctx context.Context, userId UserID, questionId QuestionID, reply string, replyDate time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	question, ok := s.questions[questionId]
+	if !ok || question.UserId != userId || question.Reply.Valid || question.DeletionDate.Valid {
 		return false, nil
 	}
 
+	question.Reply = sql.NullString{String: reply, Valid: true}
+	question.ReplyDate = sql.NullTime{Time: replyDate, Valid: true}
+	s.questions[questionId] = question
+	s.indexQuestion(question)
 	return true, nil
 }
 
-func DeleteQuestion(userId UserID, questionId QuestionID) (bool, error) {
-	stmt := "DELETE from Questions where id = $1 and target_id =$2"
-	result, err := databases.DbPool.Exec(stmt, questionId, userId)
-	if err != nil {
-		return false, err
+func (s *MemoryStore) UpdateQuestionFavourite(ctx context.Context, userId UserID, questionId QuestionID, favourite bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	question, ok := s.questions[questionId]
+	if !ok || question.UserId != userId || question.DeletionDate.Valid {
+		return false, nil
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return false, err
+	question.Favourite = favourite
+	s.questions[questionId] = question
+	return true, nil
+}
+
+func (s *MemoryStore) SoftDeleteQuestion(ctx context.Context, userId UserID, questionId QuestionID, deleterId UserID, deletionDate time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	question, ok := s.questions[questionId]
+	if !ok || question.UserId != userId || question.DeletionDate.Valid {
+		return false, nil
 	}
-	if rowsAffected != 1 {
+
+	question.DeletionDate = sql.NullTime{Time: deletionDate, Valid: true}
+	question.DeleterId = sql.NullString{String: deleterId, Valid: true}
+	s.questions[questionId] = question
+	return true, nil
+}
+
+func (s *MemoryStore) RestoreQuestion(ctx context.Context, userId UserID, questionId QuestionID, since time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	question, ok := s.questions[questionId]
+	if !ok || question.UserId != userId || question.DeleterId.String != userId || !question.DeletionDate.Valid || question.DeletionDate.Time.Before(since) {
 		return false, nil
 	}
 
+	question.DeletionDate = sql.NullTime{}
+	question.DeleterId = sql.NullString{}
+	s.questions[questionId] = question
 	return true, nil
+}
 
+func (s *MemoryStore) UpdateQuestionHidden(ctx context.Context, questionId QuestionID, hiddenDate sql.NullTime) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	question, ok := s.questions[questionId]
+	if !ok {
+		return false, nil
+	}
+
+	question.HiddenDate = hiddenDate
+	s.questions[questionId] = question
+	return true, nil
 }
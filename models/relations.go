@@ -0,0 +1,219 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type RelationKind string
+
+const (
+	// The target can't ask, follow nor see the content of the user
+	RelationBlock RelationKind = "block"
+	// The content and notifications of the target are hidden from the user
+	RelationMute RelationKind = "mute"
+)
+
+// The target of a block or mute
+type RelationEntry struct {
+	UserId       UserID
+	Name         string
+	CreationDate time.Time
+}
+
+type RelationStore interface {
+	// Returns false when the relation already existed
+	AddRelation(ctx context.Context, kind RelationKind, userId UserID, targetId UserID, date time.Time) (bool, error)
+	// Returns false when there was no relation
+	RemoveRelation(ctx context.Context, kind RelationKind, userId UserID, targetId UserID) (bool, error)
+	// Reports whether the user blocked or muted the target, depending on the kinds
+	HasRelation(ctx context.Context, userId UserID, targetId UserID, kinds ...RelationKind) (bool, error)
+	// Returns a page of the users the user blocked or muted, the most recent first
+	FindRelations(ctx context.Context, kind RelationKind, userId UserID, page Page) ([]RelationEntry, error)
+	FindRelatedIds(ctx context.Context, kind RelationKind, userId UserID) ([]UserID, error)
+}
+
+func (s *PostgresStore) AddRelation(ctx context.Context, kind RelationKind, userId UserID, targetId UserID, date time.Time) (bool, error) {
+	stmt := `INSERT INTO UserRelations(user_id, target_id, kind, creation_date) VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`
+	result, err := s.exec(ctx, stmt, userId, targetId, kind, date)
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) RemoveRelation(ctx context.Context, kind RelationKind, userId UserID, targetId UserID) (bool, error) {
+	stmt := "DELETE FROM UserRelations WHERE user_id = $1 AND target_id = $2 AND kind = $3"
+	result, err := s.exec(ctx, stmt, userId, targetId, kind)
+	if isInvalidId(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) HasRelation(ctx context.Context, userId UserID, targetId UserID, kinds ...RelationKind) (bool, error) {
+	var exists bool
+
+	kindNames := make([]string, len(kinds))
+	for i, kind := range kinds {
+		kindNames[i] = string(kind)
+	}
+
+	query := "SELECT EXISTS(SELECT 1 FROM UserRelations WHERE user_id = $1 AND target_id = $2 AND kind = ANY($3))"
+	err := s.db.QueryRowContext(ctx, query, userId, targetId, pq.Array(kindNames)).Scan(&exists)
+	if isInvalidId(err) {
+		return false, nil
+	}
+
+	return exists, translateError(err)
+}
+
+func (s *PostgresStore) FindRelations(ctx context.Context, kind RelationKind, userId UserID, page Page) ([]RelationEntry, error) {
+	relations := make([]RelationEntry, 0, page.Limit)
+
+	query := `SELECT u.id, u.name, r.creation_date FROM UserRelations r JOIN Users u ON u.id = r.target_id
+		WHERE r.user_id = $1 AND r.kind = $2`
+	args := []any{userId, kind}
+
+	if page.After != nil {
+		query += " AND (r.creation_date, r.target_id) < ($3, $4)"
+		args = append(args, page.After.Date, page.After.Id)
+	}
+
+	query += fmt.Sprintf(" ORDER BY r.creation_date DESC, r.target_id DESC LIMIT %d", page.Limit)
+
+	cursor, err := s.query(ctx, query, args...)
+	if err != nil {
+		return relations, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		relation := RelationEntry{}
+		if err := cursor.Scan(&relation.UserId, &relation.Name, &relation.CreationDate); err != nil {
+			return relations, err
+		}
+		relations = append(relations, relation)
+	}
+
+	return relations, cursor.Err()
+}
+
+func (s *PostgresStore) FindRelatedIds(ctx context.Context, kind RelationKind, userId UserID) ([]UserID, error) {
+	userIds := []UserID{}
+
+	cursor, err := s.query(ctx, "SELECT target_id FROM UserRelations WHERE user_id = $1 AND kind = $2", userId, kind)
+	if err != nil {
+		return userIds, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		var userId UserID
+		if err := cursor.Scan(&userId); err != nil {
+			return userIds, err
+		}
+		userIds = append(userIds, userId)
+	}
+
+	return userIds, cursor.Err()
+}
+
+func (s *MemoryStore) AddRelation(ctx context.Context, kind RelationKind, userId UserID, targetId UserID, date time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return false, apperrors.NotFound("Referenced resource doesn't exist")
+	}
+	if _, ok := s.users[targetId]; !ok {
+		return false, apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	key := relationKey{kind: kind, userId: userId}
+	if _, ok := s.relations[key][targetId]; ok {
+		return false, nil
+	}
+
+	if s.relations[key] == nil {
+		s.relations[key] = map[UserID]time.Time{}
+	}
+	s.relations[key][targetId] = date
+	return true, nil
+}
+
+func (s *MemoryStore) RemoveRelation(ctx context.Context, kind RelationKind, userId UserID, targetId UserID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := relationKey{kind: kind, userId: userId}
+	if _, ok := s.relations[key][targetId]; !ok {
+		return false, nil
+	}
+
+	delete(s.relations[key], targetId)
+	return true, nil
+}
+
+func (s *MemoryStore) HasRelation(ctx context.Context, userId UserID, targetId UserID, kinds ...RelationKind) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.hasRelation(userId, targetId, kinds...), nil
+}
+
+// Must be called with the lock held
+func (s *MemoryStore) hasRelation(userId UserID, targetId UserID, kinds ...RelationKind) bool {
+	for _, kind := range kinds {
+		if _, ok := s.relations[relationKey{kind: kind, userId: userId}][targetId]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *MemoryStore) FindRelations(ctx context.Context, kind RelationKind, userId UserID, page Page) ([]RelationEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	relations := make([]RelationEntry, 0, page.Limit)
+	for targetId, date := range s.relations[relationKey{kind: kind, userId: userId}] {
+		if page.Includes(date, targetId) {
+			relations = append(relations, RelationEntry{UserId: targetId, Name: s.users[targetId].Name, CreationDate: date})
+		}
+	}
+
+	slices.SortFunc(relations, func(a, b RelationEntry) int {
+		return Cursor{Date: a.CreationDate, Id: a.UserId}.Compare(Cursor{Date: b.CreationDate, Id: b.UserId})
+	})
+
+	if len(relations) > page.Limit {
+		relations = relations[:page.Limit]
+	}
+
+	return relations, nil
+}
+
+func (s *MemoryStore) FindRelatedIds(ctx context.Context, kind RelationKind, userId UserID) ([]UserID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userIds := []UserID{}
+	for targetId := range s.relations[relationKey{kind: kind, userId: userId}] {
+		userIds = append(userIds, targetId)
+	}
+
+	return userIds, nil
+}
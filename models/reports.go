@@ -0,0 +1,263 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type ReportID = string
+
+// What a report or a moderator action is about
+type TargetKind string
+
+const (
+	TargetQuestion TargetKind = "question"
+	// The reply of a question, its id is the one of the question
+	TargetReply          TargetKind = "reply"
+	TargetPost           TargetKind = "post"
+	TargetUser           TargetKind = "user"
+	TargetReport         TargetKind = "report"
+	TargetModerationItem TargetKind = "moderation_item"
+)
+
+type ReportReason string
+
+const (
+	ReportSpam          ReportReason = "spam"
+	ReportHarassment    ReportReason = "harassment"
+	ReportHate          ReportReason = "hate"
+	ReportSexual        ReportReason = "sexual"
+	ReportViolence      ReportReason = "violence"
+	ReportSelfHarm      ReportReason = "self_harm"
+	ReportImpersonation ReportReason = "impersonation"
+	ReportOther         ReportReason = "other"
+)
+
+type ReportStatus string
+
+const (
+	ReportOpen ReportStatus = "open"
+	// A moderator acted on the report
+	ReportResolved ReportStatus = "resolved"
+	// A moderator found nothing wrong
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+type Report struct {
+	Id         ReportID
+	ReporterId UserID
+	TargetKind TargetKind
+	TargetId   string
+	// Author of the reported content or the reported user. Null for questions asked without logging in
+	TargetUserId sql.NullString
+	Reason       ReportReason
+	Details      string
+	Status       ReportStatus
+	// Left by the moderator that triaged the report
+	Note string
+
+	CreationDate   time.Time
+	ResolutionDate sql.NullTime
+	ResolverId     sql.NullString
+}
+
+func (r Report) Cursor() Cursor {
+	return Cursor{Date: r.CreationDate, Id: r.Id}
+}
+
+type ReportFilter struct {
+	Status ReportStatus
+	// Empty for every kind
+	TargetKind TargetKind
+	// Empty for every target
+	TargetId string
+}
+
+func (f ReportFilter) matches(report Report) bool {
+	return report.Status == f.Status &&
+		(f.TargetKind == "" || report.TargetKind == f.TargetKind) &&
+		(f.TargetId == "" || report.TargetId == f.TargetId)
+}
+
+type ReportStore interface {
+	// Returns false when the reporter already has an open report of the same target
+	InsertReport(ctx context.Context, report Report) (bool, error)
+	// Returns nil without error when it doesn't exist
+	FindReport(ctx context.Context, id ReportID) (*Report, error)
+	// Returns a page of the reports that match the filter, the most recent first
+	FindReports(ctx context.Context, filter ReportFilter, page Page) ([]Report, error)
+	// Resolves or dismisses an open report, false when it doesn't exist or was already triaged
+	TriageReport(ctx context.Context, id ReportID, status ReportStatus, note string, resolverId UserID, date time.Time) (bool, error)
+}
+
+const reportColumns = `id, reporter_id, target_kind, target_id, target_user_id, reason, details, status, note,
+	creation_date, resolution_date, resolver_id`
+
+func (s *PostgresStore) InsertReport(ctx context.Context, report Report) (bool, error) {
+	stmt := fmt.Sprintf(`INSERT INTO Reports(%s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (reporter_id, target_kind, target_id) WHERE status = 'open' DO NOTHING`, reportColumns)
+	result, err := s.exec(
+		ctx, stmt,
+		report.Id, report.ReporterId, report.TargetKind, report.TargetId, report.TargetUserId, report.Reason, report.Details,
+		report.Status, report.Note, report.CreationDate, report.ResolutionDate, report.ResolverId,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) FindReport(ctx context.Context, id ReportID) (*Report, error) {
+	reports, err := s.queryReports(ctx, fmt.Sprintf("SELECT %s FROM Reports WHERE id = $1", reportColumns), id)
+	if isInvalidId(err) || len(reports) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &reports[0], nil
+}
+
+func (s *PostgresStore) FindReports(ctx context.Context, filter ReportFilter, page Page) ([]Report, error) {
+	query := fmt.Sprintf("SELECT %s FROM Reports WHERE status = $1", reportColumns)
+	args := []any{filter.Status}
+
+	if filter.TargetKind != "" {
+		args = append(args, filter.TargetKind)
+		query += fmt.Sprintf(" AND target_kind = $%d", len(args))
+	}
+	if filter.TargetId != "" {
+		args = append(args, filter.TargetId)
+		query += fmt.Sprintf(" AND target_id = $%d", len(args))
+	}
+	if page.After != nil {
+		args = append(args, page.After.Date, page.After.Id)
+		query += fmt.Sprintf(" AND (creation_date, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	query += fmt.Sprintf(" ORDER BY creation_date DESC, id DESC LIMIT %d", page.Limit)
+
+	reports, err := s.queryReports(ctx, query, args...)
+	if isInvalidId(err) {
+		return []Report{}, nil
+	}
+
+	return reports, err
+}
+
+func (s *PostgresStore) TriageReport(ctx context.Context, id ReportID, status ReportStatus, note string, resolverId UserID, date time.Time) (bool, error) {
+	stmt := "UPDATE Reports SET status = $2, note = $3, resolver_id = $4, resolution_date = $5 WHERE id = $1 AND status = 'open'"
+	result, err := s.exec(ctx, stmt, id, status, note, resolverId, date)
+	if isInvalidId(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) queryReports(ctx context.Context, query string, args ...any) ([]Report, error) {
+	reports := []Report{}
+
+	cursor, err := s.query(ctx, query, args...)
+	if err != nil {
+		return reports, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		report := Report{}
+		err := cursor.Scan(
+			&report.Id, &report.ReporterId, &report.TargetKind, &report.TargetId, &report.TargetUserId, &report.Reason, &report.Details,
+			&report.Status, &report.Note, &report.CreationDate, &report.ResolutionDate, &report.ResolverId,
+		)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, cursor.Err()
+}
+
+func (s *MemoryStore) InsertReport(ctx context.Context, report Report) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.reports[report.Id]; ok {
+		return false, apperrors.Conflict("Report already exists")
+	}
+	if _, ok := s.users[report.ReporterId]; !ok {
+		return false, apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	for _, existing := range s.reports {
+		if existing.Status == ReportOpen && existing.ReporterId == report.ReporterId &&
+			existing.TargetKind == report.TargetKind && existing.TargetId == report.TargetId {
+			return false, nil
+		}
+	}
+
+	s.reports[report.Id] = report
+	return true, nil
+}
+
+func (s *MemoryStore) FindReport(ctx context.Context, id ReportID) (*Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	report, ok := s.reports[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &report, nil
+}
+
+func (s *MemoryStore) FindReports(ctx context.Context, filter ReportFilter, page Page) ([]Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reports := []Report{}
+	for _, report := range s.reports {
+		if filter.matches(report) && page.Includes(report.CreationDate, report.Id) {
+			reports = append(reports, report)
+		}
+	}
+
+	slices.SortFunc(reports, func(a, b Report) int {
+		return a.Cursor().Compare(b.Cursor())
+	})
+
+	if len(reports) > page.Limit {
+		reports = reports[:page.Limit]
+	}
+
+	return reports, nil
+}
+
+func (s *MemoryStore) TriageReport(ctx context.Context, id ReportID, status ReportStatus, note string, resolverId UserID, date time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report, ok := s.reports[id]
+	if !ok || report.Status != ReportOpen {
+		return false, nil
+	}
+
+	report.Status = status
+	report.Note = note
+	report.ResolverId = sql.NullString{String: resolverId, Valid: true}
+	report.ResolutionDate = sql.NullTime{Time: date, Valid: true}
+	s.reports[id] = report
+	return true, nil
+}
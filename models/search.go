@@ -0,0 +1,190 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/search"
+)
+
+type SearchResultKind string
+
+const (
+	SearchQuestion SearchResultKind = "question"
+	SearchPost     SearchResultKind = "post"
+)
+
+// Wrap the matching words of the snippets, they can't appear in the text of the users
+const (
+	SnippetStart = "\x01"
+	SnippetStop  = "\x02"
+)
+
+type SearchQuery struct {
+	Text string
+	// Empty searches every kind
+	Kind   SearchResultKind
+	Limit  int
+	Offset int
+	// The content of the users that blocked the viewer is left out, empty for anonymous searches
+	ViewerId UserID
+}
+
+type SearchResult struct {
+	Kind SearchResultKind
+	Id   string
+	// Recipient of the question or owner of the post
+	UserId UserID
+	// Only for posts
+	Title   string
+	Snippet string
+	Rank    float64
+	// When the question was answered or the post created
+	Date time.Time
+}
+
+type SearchStore interface {
+	// Searches the answered questions and the posts that weren't deleted nor hidden, the best matches first
+	Search(ctx context.Context, query SearchQuery) ([]SearchResult, error)
+}
+
+func (s *PostgresStore) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	results := make([]SearchResult, 0, query.Limit)
+
+	// $3 is null for anonymous searches, so nothing is left out
+	notBlocked := func(userColumn string) string {
+		return fmt.Sprintf(`NOT EXISTS (
+				SELECT 1 FROM UserRelations r WHERE r.user_id = %s AND r.target_id = $3::uuid AND r.kind = 'block'
+			)`, userColumn)
+	}
+
+	branches := []string{}
+	if query.Kind == "" || query.Kind == SearchQuestion {
+		branches = append(branches, `
+			SELECT 'question' AS kind, id, target_id AS user_id, '' AS title, message || ' ' || reply AS body,
+				ts_rank_cd(search_vector, q) AS rank, reply_date AS date
+			FROM Questions, query WHERE search_vector @@ q AND reply IS NOT null AND hidden_date IS null AND deletion_date IS null AND `+notBlocked("target_id"))
+	}
+	if query.Kind == "" || query.Kind == SearchPost {
+		branches = append(branches, `
+			SELECT 'post', id, owner_id, title, title || ' ' || content,
+				ts_rank_cd(search_vector, q), creation_date
+			FROM Posts, query WHERE search_vector @@ q AND deletion_date IS null AND hidden_date IS null AND `+notBlocked("owner_id"))
+	}
+
+	// The snippets are only built for the rows of the page
+	stmt := fmt.Sprintf(`
+		WITH query AS (
+			SELECT websearch_to_tsquery('spanish', $1) || websearch_to_tsquery('english', $1) AS q
+		)
+		SELECT kind, id, user_id, title, ts_headline('spanish', body, q, $2), rank, date FROM (
+			%s
+			ORDER BY rank DESC, date DESC, id DESC LIMIT %d OFFSET %d
+		) results, query
+		ORDER BY rank DESC, date DESC, id DESC`,
+		strings.Join(branches, " UNION ALL "), query.Limit, query.Offset,
+	)
+	options := fmt.Sprintf(`StartSel="%s", StopSel="%s", MinWords=15, MaxWords=35, MaxFragments=2`, SnippetStart, SnippetStop)
+
+	viewerId := sql.NullString{String: query.ViewerId, Valid: query.ViewerId != ""}
+
+	cursor, err := s.query(ctx, stmt, query.Text, options, viewerId)
+	if err != nil {
+		return results, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		result := SearchResult{}
+
+		err = cursor.Scan(&result.Kind, &result.Id, &result.UserId, &result.Title, &result.Snippet, &result.Rank, &result.Date)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, cursor.Err()
+}
+
+func (s *MemoryStore) Search(ctx context.Context, query SearchQuery) ([]SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blockedBy := func(userId UserID) bool {
+		return query.ViewerId != "" && s.hasRelation(userId, query.ViewerId, RelationBlock)
+	}
+
+	results := []SearchResult{}
+	for _, match := range s.searchIndex.Search(query.Text) {
+		if question, ok := s.questions[match.Id]; ok && question.Reply.Valid && !question.HiddenDate.Valid && !question.DeletionDate.Valid && query.Kind != SearchPost && !blockedBy(question.UserId) {
+			results = append(results, SearchResult{
+				Kind:    SearchQuestion,
+				Id:      question.Id,
+				UserId:  question.UserId,
+				Snippet: search.Snippet(question.Message+" "+question.Reply.String, query.Text, SnippetStart, SnippetStop),
+				Rank:    match.Rank,
+				Date:    question.ReplyDate.Time,
+			})
+		}
+
+		if post, ok := s.posts[match.Id]; ok && !post.DeletionDate.Valid && !post.HiddenDate.Valid && query.Kind != SearchQuestion && !blockedBy(post.OwnerId) {
+			results = append(results, SearchResult{
+				Kind:    SearchPost,
+				Id:      post.Id,
+				UserId:  post.OwnerId,
+				Title:   post.Title,
+				Snippet: search.Snippet(post.Title+" "+post.Content, query.Text, SnippetStart, SnippetStop),
+				Rank:    match.Rank,
+				Date:    post.CreationDate,
+			})
+		}
+	}
+
+	slices.SortFunc(results, func(a, b SearchResult) int {
+		if a.Rank != b.Rank {
+			if a.Rank > b.Rank {
+				return -1
+			}
+			return 1
+		}
+		return Cursor{Date: a.Date, Id: a.Id}.Compare(Cursor{Date: b.Date, Id: b.Id})
+	})
+
+	if query.Offset >= len(results) {
+		return []SearchResult{}, nil
+	}
+	results = results[query.Offset:]
+	if len(results) > query.Limit {
+		results = results[:query.Limit]
+	}
+
+	return results, nil
+}
+
+// Weights of the fields, the same that Postgres gives by default to the A and B weights
+const (
+	searchWeightA = 1.0
+	searchWeightB = 0.4
+)
+
+// Must be called with the write lock held
+func (s *MemoryStore) indexQuestion(question Question) {
+	s.searchIndex.Put(search.Document{Id: question.Id, Fields: []search.Field{
+		{Text: question.Reply.String, Weight: searchWeightA},
+		{Text: question.Message, Weight: searchWeightB},
+	}})
+}
+
+// Must be called with the write lock held
+func (s *MemoryStore) indexPost(post Post) {
+	s.searchIndex.Put(search.Document{Id: post.Id, Fields: []search.Field{
+		{Text: post.Title, Weight: searchWeightA},
+		{Text: post.Content, Weight: searchWeightB},
+	}})
+}
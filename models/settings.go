@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// What questions a user accepts
+type QuestionSettings struct {
+	AllowAnonymous    bool
+	AllowNonFollowers bool
+}
+
+func DefaultQuestionSettings() QuestionSettings {
+	return QuestionSettings{AllowAnonymous: true, AllowNonFollowers: true}
+}
+
+type SettingsStore interface {
+	// Returns nil without error when there is no user with that id
+	FindQuestionSettings(ctx context.Context, userId UserID) (*QuestionSettings, error)
+	UpdateQuestionSettings(ctx context.Context, userId UserID, settings QuestionSettings) (bool, error)
+	// Words and phrases the user doesn't want to receive in questions, as the user wrote them
+	FindMutedWords(ctx context.Context, userId UserID) ([]string, error)
+	UpdateMutedWords(ctx context.Context, userId UserID, words []string) (bool, error)
+}
+
+func (s *PostgresStore) FindQuestionSettings(ctx context.Context, userId UserID) (*QuestionSettings, error) {
+	settings := QuestionSettings{}
+
+	query := "SELECT allow_anonymous_questions, allow_non_follower_questions FROM Users WHERE id = $1"
+	row := s.db.QueryRowContext(ctx, query, userId)
+	if err := row.Scan(&settings.AllowAnonymous, &settings.AllowNonFollowers); err != nil {
+		if err == sql.ErrNoRows || isInvalidId(err) {
+			return nil, nil
+		}
+
+		return nil, translateError(err)
+	}
+
+	return &settings, nil
+}
+
+func (s *PostgresStore) UpdateQuestionSettings(ctx context.Context, userId UserID, settings QuestionSettings) (bool, error) {
+	stmt := "UPDATE Users SET allow_anonymous_questions = $1, allow_non_follower_questions = $2 WHERE id = $3"
+	result, err := s.exec(ctx, stmt, settings.AllowAnonymous, settings.AllowNonFollowers, userId)
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) FindMutedWords(ctx context.Context, userId UserID) ([]string, error) {
+	words := []string{}
+
+	row := s.db.QueryRowContext(ctx, "SELECT muted_words FROM Users WHERE id = $1", userId)
+	err := row.Scan(pq.Array(&words))
+	if err == sql.ErrNoRows || isInvalidId(err) {
+		return []string{}, nil
+	}
+
+	return words, translateError(err)
+}
+
+func (s *PostgresStore) UpdateMutedWords(ctx context.Context, userId UserID, words []string) (bool, error) {
+	result, err := s.exec(ctx, "UPDATE Users SET muted_words = $1 WHERE id = $2", pq.Array(words), userId)
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *MemoryStore) FindQuestionSettings(ctx context.Context, userId UserID) (*QuestionSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return nil, nil
+	}
+
+	settings, ok := s.questionSettings[userId]
+	if !ok {
+		settings = DefaultQuestionSettings()
+	}
+
+	return &settings, nil
+}
+
+func (s *MemoryStore) UpdateQuestionSettings(ctx context.Context, userId UserID, settings QuestionSettings) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return false, nil
+	}
+
+	s.questionSettings[userId] = settings
+	return true, nil
+}
+
+func (s *MemoryStore) FindMutedWords(ctx context.Context, userId UserID) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]string{}, s.mutedWords[userId]...), nil
+}
+
+func (s *MemoryStore) UpdateMutedWords(ctx context.Context, userId UserID, words []string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userId]; !ok {
+		return false, nil
+	}
+
+	s.mutedWords[userId] = append([]string{}, words...)
+	return true, nil
+}
@@ -0,0 +1,28 @@
+package models
+
+// Store groups every repository, both PostgresStore and MemoryStore implement it
+type Store interface {
+	UserStore
+	QuestionStore
+	PostStore
+	PostRevisionStore
+	TrashStore
+	TokenStore
+	FollowStore
+	TimelineStore
+	SettingsStore
+	NotificationStore
+	SearchStore
+	LoginStore
+	AccountTokenStore
+	RelationStore
+	ModerationStore
+	ReportStore
+	ModeratorActionStore
+	AuditStore
+}
+
+var (
+	_ Store = (*PostgresStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
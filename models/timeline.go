@@ -0,0 +1,330 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type TimelineItemKind string
+
+const (
+	TimelinePost   TimelineItemKind = "post"
+	TimelineAnswer TimelineItemKind = "answer"
+)
+
+// A post or an answered question in a timeline, dated when it was posted or answered
+type TimelineEntry struct {
+	ItemId   string
+	Kind     TimelineItemKind
+	AuthorId UserID
+	Date     time.Time
+}
+
+// A timeline entry with its content, Post or Question is set depending on the kind
+type TimelineItem struct {
+	TimelineEntry
+	Post     *Post
+	Question *Question
+}
+
+func (e TimelineEntry) Cursor() Cursor {
+	return Cursor{Date: e.Date, Id: e.ItemId}
+}
+
+type TimelineStore interface {
+	// Copies the entry to the timeline of every follower of its author that didn't mute them
+	FanOutTimelineEntry(ctx context.Context, entry TimelineEntry) error
+	InsertTimelineEntries(ctx context.Context, userId UserID, entries []TimelineEntry) error
+	DeleteTimelineEntriesByAuthor(ctx context.Context, userId UserID, authorId UserID) error
+	// Returns a page of the materialized timeline of the user, entries whose content was deleted or hidden are skipped
+	FindTimelineItems(ctx context.Context, userId UserID, page Page) ([]TimelineItem, error)
+	// Returns a page of the posts and answered questions of the authors read from the content itself
+	FindTimelineItemsByAuthors(ctx context.Context, authorIds []UserID, page Page) ([]TimelineItem, error)
+}
+
+// Columns of the timeline queries, in the order queryTimelineItems scans them
+const timelineColumns = `item_id, kind, author_id, date, post_title, post_content, post_creation_date,
+	post_edit_date, post_edit_count, question_message, question_reply, question_asker_id, question_anonymous, question_signature, question_creation_date`
+
+func (s *PostgresStore) FanOutTimelineEntry(ctx context.Context, entry TimelineEntry) error {
+	stmt := `
+		INSERT INTO TimelineEntries(user_id, item_id, kind, author_id, date)
+		SELECT follower_id, $1::uuid, $2::text, $3::uuid, $4::timestamptz FROM Follows f
+		WHERE followee_id = $3::uuid AND NOT EXISTS (
+			SELECT 1 FROM UserRelations r WHERE r.user_id = f.follower_id AND r.target_id = $3::uuid AND r.kind = 'mute'
+		)
+		ON CONFLICT DO NOTHING`
+	_, err := s.exec(ctx, stmt, entry.ItemId, entry.Kind, entry.AuthorId, entry.Date)
+	return err
+}
+
+func (s *PostgresStore) InsertTimelineEntries(ctx context.Context, userId UserID, entries []TimelineEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	itemIds := make([]string, len(entries))
+	kinds := make([]string, len(entries))
+	authorIds := make([]string, len(entries))
+	dates := make([]string, len(entries))
+	for i, entry := range entries {
+		itemIds[i] = entry.ItemId
+		kinds[i] = string(entry.Kind)
+		authorIds[i] = entry.AuthorId
+		dates[i] = entry.Date.Format(time.RFC3339Nano)
+	}
+
+	stmt := `
+		INSERT INTO TimelineEntries(user_id, item_id, kind, author_id, date)
+		SELECT $1::uuid, * FROM unnest($2::uuid[], $3::text[], $4::uuid[], $5::timestamptz[])
+		ON CONFLICT DO NOTHING`
+	_, err := s.exec(ctx, stmt, userId, pq.Array(itemIds), pq.Array(kinds), pq.Array(authorIds), pq.Array(dates))
+	return err
+}
+
+func (s *PostgresStore) DeleteTimelineEntriesByAuthor(ctx context.Context, userId UserID, authorId UserID) error {
+	stmt := "DELETE FROM TimelineEntries WHERE user_id = $1 AND author_id = $2"
+	_, err := s.exec(ctx, stmt, userId, authorId)
+	return err
+}
+
+func (s *PostgresStore) FindTimelineItems(ctx context.Context, userId UserID, page Page) ([]TimelineItem, error) {
+	query := `
+		SELECT t.item_id, t.kind, t.author_id, t.date, p.title AS post_title, p.content AS post_content,
+			p.creation_date AS post_creation_date, p.edit_date AS post_edit_date, p.edit_count AS post_edit_count,
+			q.message AS question_message, q.reply AS question_reply,
+			q.asker_id AS question_asker_id, q.anonymous AS question_anonymous, q.signature AS question_signature,
+			q.creation_date AS question_creation_date
+		FROM TimelineEntries t
+		LEFT JOIN Posts p ON t.kind = 'post' AND p.id = t.item_id AND p.deletion_date IS null AND p.hidden_date IS null
+		LEFT JOIN Questions q ON t.kind = 'answer' AND q.id = t.item_id AND q.reply IS NOT null AND q.hidden_date IS null AND q.deletion_date IS null
+		WHERE t.user_id = $1 AND (p.id IS NOT null OR q.id IS NOT null)`
+	args := []any{userId}
+
+	if page.After != nil {
+		query += " AND (t.date, t.item_id) < ($2, $3)"
+		args = append(args, page.After.Date, page.After.Id)
+	}
+
+	query += fmt.Sprintf(" ORDER BY t.date DESC, t.item_id DESC LIMIT %d", page.Limit)
+
+	return s.queryTimelineItems(ctx, query, args...)
+}
+
+func (s *PostgresStore) FindTimelineItemsByAuthors(ctx context.Context, authorIds []UserID, page Page) ([]TimelineItem, error) {
+	postsAfter, answersAfter := "", ""
+	args := []any{pq.Array(authorIds)}
+
+	if page.After != nil {
+		postsAfter = " AND (creation_date, id) < ($2, $3)"
+		answersAfter = " AND (reply_date, id) < ($2, $3)"
+		args = append(args, page.After.Date, page.After.Id)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s FROM (
+			SELECT id AS item_id, 'post' AS kind, owner_id AS author_id, creation_date AS date,
+				title AS post_title, content AS post_content, creation_date AS post_creation_date,
+				edit_date AS post_edit_date, edit_count AS post_edit_count,
+				NULL::text AS question_message, NULL::text AS question_reply, NULL::uuid AS question_asker_id,
+				NULL::boolean AS question_anonymous, NULL::text AS question_signature, NULL::timestamptz AS question_creation_date
+			FROM Posts WHERE owner_id = ANY($1::uuid[]) AND deletion_date IS null AND hidden_date IS null%s
+			UNION ALL
+			SELECT id, 'answer', target_id, reply_date, NULL, NULL, NULL, NULL, NULL, message, reply, asker_id, anonymous, signature, creation_date
+			FROM Questions WHERE target_id = ANY($1::uuid[]) AND reply_date IS NOT null AND hidden_date IS null AND deletion_date IS null%s
+		) items
+		ORDER BY date DESC, item_id DESC LIMIT %d`,
+		timelineColumns, postsAfter, answersAfter, page.Limit,
+	)
+
+	return s.queryTimelineItems(ctx, query, args...)
+}
+
+func (s *PostgresStore) queryTimelineItems(ctx context.Context, query string, args ...any) ([]TimelineItem, error) {
+	items := []TimelineItem{}
+
+	cursor, err := s.query(ctx, query, args...)
+	if isInvalidId(err) {
+		return items, nil
+	}
+	if err != nil {
+		return items, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		item := TimelineItem{}
+		var title, content, message, reply, askerId, signature sql.NullString
+		var anonymous sql.NullBool
+		var postCreationDate, postEditDate, questionCreationDate sql.NullTime
+		var postEditCount sql.NullInt64
+
+		err = cursor.Scan(
+			&item.ItemId, &item.Kind, &item.AuthorId, &item.Date,
+			&title, &content, &postCreationDate, &postEditDate, &postEditCount,
+			&message, &reply, &askerId, &anonymous, &signature, &questionCreationDate,
+		)
+		if err != nil {
+			return items, err
+		}
+
+		switch item.Kind {
+		case TimelinePost:
+			item.Post = &Post{
+				Id:           item.ItemId,
+				OwnerId:      item.AuthorId,
+				Title:        title.String,
+				Content:      content.String,
+				CreationDate: postCreationDate.Time,
+				EditDate:     postEditDate,
+				EditCount:    int(postEditCount.Int64),
+			}
+		case TimelineAnswer:
+			item.Question = &Question{
+				Id:           item.ItemId,
+				UserId:       item.AuthorId,
+				Message:      message.String,
+				Reply:        reply,
+				AskerId:      askerId,
+				Anonymous:    anonymous.Bool,
+				Signature:    signature,
+				CreationDate: questionCreationDate.Time,
+				ReplyDate:    sql.NullTime{Time: item.Date, Valid: true},
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, cursor.Err()
+}
+
+func (s *MemoryStore) FanOutTimelineEntry(ctx context.Context, entry TimelineEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for followerId, followees := range s.follows {
+		if _, ok := followees[entry.AuthorId]; ok && !s.hasRelation(followerId, entry.AuthorId, RelationMute) {
+			s.insertTimelineEntry(followerId, entry)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) InsertTimelineEntries(ctx context.Context, userId UserID, entries []TimelineEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range entries {
+		s.insertTimelineEntry(userId, entry)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteTimelineEntriesByAuthor(ctx context.Context, userId UserID, authorId UserID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for itemId, entry := range s.timelines[userId] {
+		if entry.AuthorId == authorId {
+			delete(s.timelines[userId], itemId)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) FindTimelineItems(ctx context.Context, userId UserID, page Page) ([]TimelineItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []TimelineItem{}
+	for _, entry := range s.timelines[userId] {
+		if item, ok := s.timelineItem(entry); ok {
+			items = append(items, item)
+		}
+	}
+
+	return pageOfTimelineItems(items, page), nil
+}
+
+func (s *MemoryStore) FindTimelineItemsByAuthors(ctx context.Context, authorIds []UserID, page Page) ([]TimelineItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []TimelineItem{}
+	for _, post := range s.posts {
+		if slices.Contains(authorIds, post.OwnerId) {
+			entry := TimelineEntry{ItemId: post.Id, Kind: TimelinePost, AuthorId: post.OwnerId, Date: post.CreationDate}
+			if item, ok := s.timelineItem(entry); ok {
+				items = append(items, item)
+			}
+		}
+	}
+	for _, question := range s.questions {
+		if slices.Contains(authorIds, question.UserId) && question.ReplyDate.Valid {
+			entry := TimelineEntry{ItemId: question.Id, Kind: TimelineAnswer, AuthorId: question.UserId, Date: question.ReplyDate.Time}
+			if item, ok := s.timelineItem(entry); ok {
+				items = append(items, item)
+			}
+		}
+	}
+
+	return pageOfTimelineItems(items, page), nil
+}
+
+// Must be called with the write lock held
+func (s *MemoryStore) insertTimelineEntry(userId UserID, entry TimelineEntry) {
+	if s.timelines[userId] == nil {
+		s.timelines[userId] = map[string]TimelineEntry{}
+	}
+	if _, ok := s.timelines[userId][entry.ItemId]; !ok {
+		s.timelines[userId][entry.ItemId] = entry
+	}
+}
+
+// Looks up the content of the entry, must be called with the lock held
+func (s *MemoryStore) timelineItem(entry TimelineEntry) (TimelineItem, bool) {
+	item := TimelineItem{TimelineEntry: entry}
+
+	switch entry.Kind {
+	case TimelinePost:
+		post, ok := s.posts[entry.ItemId]
+		if !ok || post.DeletionDate.Valid || post.HiddenDate.Valid {
+			return item, false
+		}
+		item.Post = &post
+
+	case TimelineAnswer:
+		question, ok := s.questions[entry.ItemId]
+		if !ok || !question.Reply.Valid || question.HiddenDate.Valid || question.DeletionDate.Valid {
+			return item, false
+		}
+		item.Question = &question
+	}
+
+	return item, true
+}
+
+func pageOfTimelineItems(items []TimelineItem, page Page) []TimelineItem {
+	items = slices.DeleteFunc(items, func(item TimelineItem) bool {
+		return !page.Includes(item.Date, item.ItemId)
+	})
+
+	slices.SortFunc(items, func(a, b TimelineItem) int {
+		return a.Cursor().Compare(b.Cursor())
+	})
+
+	if len(items) > page.Limit {
+		items = items[:page.Limit]
+	}
+
+	return items
+}
@@ -0,0 +1,244 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+)
+
+type RefreshTokenID = string
+
+// A refresh token is only stored as a hash, the plain value is only known by the client.
+// Every rotation creates a new token in the same family.
+type RefreshToken struct {
+	Id                   RefreshTokenID
+	FamilyId             string
+	UserId               UserID
+	TokenHash            string
+	AccessTokenId        string
+	AccessTokenExpiresAt time.Time
+	CreationDate         time.Time
+	ExpirationDate       time.Time
+	UsedDate             sql.NullTime
+	RevocationDate       sql.NullTime
+}
+
+type TokenStore interface {
+	InsertRefreshToken(ctx context.Context, token RefreshToken) error
+	// Returns nil without error when there is no token with that hash
+	FindRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error)
+	// Only marks tokens that weren't used nor revoked yet, returns false otherwise
+	MarkRefreshTokenUsed(ctx context.Context, tokenId RefreshTokenID, usedDate time.Time) (bool, error)
+	// Revokes every token of the family and denylists the access tokens issued with them
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string, revocationDate time.Time) error
+	// Revokes every token of the user and denylists the access tokens issued with them
+	RevokeUserRefreshTokens(ctx context.Context, userId UserID, revocationDate time.Time) error
+	DenyAccessToken(ctx context.Context, accessTokenId string, expirationDate time.Time) error
+	IsAccessTokenDenied(ctx context.Context, accessTokenId string) (bool, error)
+	// Removes expired refresh tokens and denylist entries, they can't be used anymore anyway
+	PurgeExpiredTokens(ctx context.Context, now time.Time) error
+}
+
+func (s *PostgresStore) InsertRefreshToken(ctx context.Context, token RefreshToken) error {
+	stmt := `INSERT INTO RefreshTokens(id, family_id, user_id, token_hash, access_token_id, access_token_expires_at, creation_date, expiration_date, used_date, revocation_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err := s.exec(ctx, stmt, token.Id, token.FamilyId, token.UserId, token.TokenHash, token.AccessTokenId,
+		token.AccessTokenExpiresAt, token.CreationDate, token.ExpirationDate, token.UsedDate, token.RevocationDate)
+	return err
+}
+
+func (s *PostgresStore) FindRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	token := RefreshToken{}
+
+	query := `SELECT id, family_id, user_id, token_hash, access_token_id, access_token_expires_at, creation_date, expiration_date, used_date, revocation_date
+		FROM RefreshTokens WHERE token_hash = $1`
+	row := s.db.QueryRowContext(ctx, query, tokenHash)
+	err := row.Scan(&token.Id, &token.FamilyId, &token.UserId, &token.TokenHash, &token.AccessTokenId,
+		&token.AccessTokenExpiresAt, &token.CreationDate, &token.ExpirationDate, &token.UsedDate, &token.RevocationDate)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (s *PostgresStore) MarkRefreshTokenUsed(ctx context.Context, tokenId RefreshTokenID, usedDate time.Time) (bool, error) {
+	stmt := "UPDATE RefreshTokens SET used_date = $1 WHERE id = $2 AND used_date IS NULL AND revocation_date IS NULL"
+	result, err := s.exec(ctx, stmt, usedDate, tokenId)
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) RevokeRefreshTokenFamily(ctx context.Context, familyId string, revocationDate time.Time) error {
+	return s.revokeRefreshTokens(ctx, "family_id", familyId, revocationDate)
+}
+
+func (s *PostgresStore) RevokeUserRefreshTokens(ctx context.Context, userId UserID, revocationDate time.Time) error {
+	return s.revokeRefreshTokens(ctx, "user_id", userId, revocationDate)
+}
+
+// column is never user input, it's either family_id or user_id
+func (s *PostgresStore) revokeRefreshTokens(ctx context.Context, column string, value string, revocationDate time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO RevokedAccessTokens(id, expiration_date)
+		SELECT access_token_id, access_token_expires_at FROM RefreshTokens WHERE ` + column + ` = $1 AND access_token_expires_at > $2
+		ON CONFLICT (id) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, stmt, value, revocationDate); err != nil {
+		return err
+	}
+
+	stmt = "UPDATE RefreshTokens SET revocation_date = $1 WHERE " + column + " = $2 AND revocation_date IS NULL"
+	if _, err := tx.ExecContext(ctx, stmt, revocationDate, value); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) DenyAccessToken(ctx context.Context, accessTokenId string, expirationDate time.Time) error {
+	stmt := "INSERT INTO RevokedAccessTokens(id, expiration_date) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING"
+	_, err := s.exec(ctx, stmt, accessTokenId, expirationDate)
+	return err
+}
+
+func (s *PostgresStore) IsAccessTokenDenied(ctx context.Context, accessTokenId string) (bool, error) {
+	var denied bool
+
+	row := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM RevokedAccessTokens WHERE id = $1)", accessTokenId)
+	err := row.Scan(&denied)
+	return denied, err
+}
+
+func (s *PostgresStore) PurgeExpiredTokens(ctx context.Context, now time.Time) error {
+	if _, err := s.exec(ctx, "DELETE FROM RevokedAccessTokens WHERE expiration_date < $1", now); err != nil {
+		return err
+	}
+
+	_, err := s.exec(ctx, "DELETE FROM RefreshTokens WHERE expiration_date < $1", now)
+	return err
+}
+
+func (s *MemoryStore) InsertRefreshToken(ctx context.Context, token RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.refreshTokens[token.Id]; ok {
+		return apperrors.Conflict("Refresh token already exists")
+	}
+	if _, ok := s.users[token.UserId]; !ok {
+		return apperrors.NotFound("Referenced resource doesn't exist")
+	}
+
+	s.refreshTokens[token.Id] = token
+	return nil
+}
+
+func (s *MemoryStore) FindRefreshTokenByHash(ctx context.Context, tokenHash string) (*RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, token := range s.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return &token, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *MemoryStore) MarkRefreshTokenUsed(ctx context.Context, tokenId RefreshTokenID, usedDate time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.refreshTokens[tokenId]
+	if !ok || token.UsedDate.Valid || token.RevocationDate.Valid {
+		return false, nil
+	}
+
+	token.UsedDate = sql.NullTime{Time: usedDate, Valid: true}
+	s.refreshTokens[tokenId] = token
+	return true, nil
+}
+
+func (s *MemoryStore) RevokeRefreshTokenFamily(ctx context.Context, familyId string, revocationDate time.Time) error {
+	s.revokeRefreshTokens(func(token RefreshToken) bool { return token.FamilyId == familyId }, revocationDate)
+	return nil
+}
+
+func (s *MemoryStore) RevokeUserRefreshTokens(ctx context.Context, userId UserID, revocationDate time.Time) error {
+	s.revokeRefreshTokens(func(token RefreshToken) bool { return token.UserId == userId }, revocationDate)
+	return nil
+}
+
+func (s *MemoryStore) revokeRefreshTokens(matches func(RefreshToken) bool, revocationDate time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.refreshTokens {
+		if !matches(token) {
+			continue
+		}
+
+		if token.AccessTokenExpiresAt.After(revocationDate) {
+			if _, ok := s.revokedAccessTokens[token.AccessTokenId]; !ok {
+				s.revokedAccessTokens[token.AccessTokenId] = token.AccessTokenExpiresAt
+			}
+		}
+
+		if !token.RevocationDate.Valid {
+			token.RevocationDate = sql.NullTime{Time: revocationDate, Valid: true}
+			s.refreshTokens[id] = token
+		}
+	}
+}
+
+func (s *MemoryStore) DenyAccessToken(ctx context.Context, accessTokenId string, expirationDate time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revokedAccessTokens[accessTokenId]; !ok {
+		s.revokedAccessTokens[accessTokenId] = expirationDate
+	}
+	return nil
+}
+
+func (s *MemoryStore) IsAccessTokenDenied(ctx context.Context, accessTokenId string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, denied := s.revokedAccessTokens[accessTokenId]
+	return denied, nil
+}
+
+func (s *MemoryStore) PurgeExpiredTokens(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, expirationDate := range s.revokedAccessTokens {
+		if expirationDate.Before(now) {
+			delete(s.revokedAccessTokens, id)
+		}
+	}
+
+	for id, token := range s.refreshTokens {
+		if token.ExpirationDate.Before(now) {
+			delete(s.refreshTokens, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// A question or a post its owner deleted, it can be restored until it's purged
+type TrashItem struct {
+	Kind TargetKind
+	Id   string
+	// Empty for questions
+	Title string
+	// The message of questions and the content of posts
+	Content string
+	// Reply of answered questions
+	Reply        sql.NullString
+	CreationDate time.Time
+	DeletionDate time.Time
+}
+
+func (t TrashItem) Cursor() Cursor {
+	return Cursor{Date: t.DeletionDate, Id: t.Id}
+}
+
+type TrashStore interface {
+	// Returns a page of the questions and posts the user deleted after since, the last deleted first.
+	// Content deleted by a moderator isn't in the trash of its owner
+	FindTrash(ctx context.Context, userId UserID, since time.Time, page Page) ([]TrashItem, error)
+	// Permanently removes up to limit questions and posts deleted before the date and returns how many
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error)
+}
+
+func (s *PostgresStore) FindTrash(ctx context.Context, userId UserID, since time.Time, page Page) ([]TrashItem, error) {
+	items := make([]TrashItem, 0, page.Limit)
+
+	args := []any{userId, since}
+	after := ""
+	if page.After != nil {
+		args = append(args, page.After.Date, page.After.Id)
+		after = " WHERE (deletion_date, id) < ($3, $4)"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT kind, id, title, content, reply, creation_date, deletion_date FROM (
+			SELECT 'post' AS kind, id, title, content, NULL::text AS reply, creation_date, deletion_date
+			FROM Posts WHERE owner_id = $1 AND deleter_id = owner_id AND deletion_date >= $2
+			UNION ALL
+			SELECT 'question', id, '', message, reply, creation_date, deletion_date
+			FROM Questions WHERE target_id = $1 AND deleter_id = target_id AND deletion_date >= $2
+		) items%s
+		ORDER BY deletion_date DESC, id DESC LIMIT %d`, after, page.Limit)
+
+	cursor, err := s.query(ctx, query, args...)
+	if isInvalidId(err) {
+		return items, nil
+	}
+	if err != nil {
+		return items, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		item := TrashItem{}
+		err := cursor.Scan(&item.Kind, &item.Id, &item.Title, &item.Content, &item.Reply, &item.CreationDate, &item.DeletionDate)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+
+	return items, cursor.Err()
+}
+
+/**
+ * Rows locked by another instance purging at the same time are skipped, so every instance
+ * can run the purger and each batch is removed only once.
+ */
+func (s *PostgresStore) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error) {
+	purged := 0
+
+	for _, table := range []string{"Questions", "Posts"} {
+		if purged == limit {
+			break
+		}
+
+		// table is never user input
+		stmt := `DELETE FROM ` + table + ` WHERE id IN (
+			SELECT id FROM ` + table + ` WHERE deletion_date < $1 ORDER BY deletion_date LIMIT $2 FOR UPDATE SKIP LOCKED
+		)`
+		result, err := s.exec(ctx, stmt, before, limit-purged)
+		if err != nil {
+			return purged, err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+		purged += int(rows)
+	}
+
+	return purged, nil
+}
+
+func (s *MemoryStore) FindTrash(ctx context.Context, userId UserID, since time.Time, page Page) ([]TrashItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []TrashItem{}
+	inTrash := func(deletion sql.NullTime, deleterId sql.NullString, id string) bool {
+		return deletion.Valid && deleterId.String == userId && !deletion.Time.Before(since) && page.Includes(deletion.Time, id)
+	}
+
+	for _, question := range s.questions {
+		if question.UserId == userId && inTrash(question.DeletionDate, question.DeleterId, question.Id) {
+			items = append(items, TrashItem{
+				Kind:         TargetQuestion,
+				Id:           question.Id,
+				Content:      question.Message,
+				Reply:        question.Reply,
+				CreationDate: question.CreationDate,
+				DeletionDate: question.DeletionDate.Time,
+			})
+		}
+	}
+	for _, post := range s.posts {
+		if post.OwnerId == userId && inTrash(post.DeletionDate, post.DeleterId, post.Id) {
+			items = append(items, TrashItem{
+				Kind:         TargetPost,
+				Id:           post.Id,
+				Title:        post.Title,
+				Content:      post.Content,
+				CreationDate: post.CreationDate,
+				DeletionDate: post.DeletionDate.Time,
+			})
+		}
+	}
+
+	slices.SortFunc(items, func(a, b TrashItem) int {
+		return a.Cursor().Compare(b.Cursor())
+	})
+
+	if len(items) > page.Limit {
+		items = items[:page.Limit]
+	}
+
+	return items, nil
+}
+
+func (s *MemoryStore) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := 0
+	for id, question := range s.questions {
+		if purged == limit {
+			return purged, nil
+		}
+		if question.DeletionDate.Valid && question.DeletionDate.Time.Before(before) {
+			delete(s.questions, id)
+			s.searchIndex.Remove(id)
+			purged++
+		}
+	}
+	for id, post := range s.posts {
+		if purged == limit {
+			return purged, nil
+		}
+		if post.DeletionDate.Valid && post.DeletionDate.Time.Before(before) {
+			delete(s.posts, id)
+			delete(s.postRevisions, id)
+			s.searchIndex.Remove(id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
@@ -1,41 +1,343 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"slices"
+	"strings"
+	"time"
 
-	// The postgres driver
-	_ "github.com/lib/pq"
-
-	"github.com/preguntame/preguntame-backend/databases"
+	"github.com/preguntame/preguntame-backend/apperrors"
 )
 
 type UserID = string
 
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles ordered from the least to the most privileged
+var Roles = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+// Reports whether the role has at least the privileges of other, unknown roles have none
+func (r Role) AtLeast(other Role) bool {
+	return slices.Index(Roles, r) >= slices.Index(Roles, other)
+}
+
 type User struct {
 	Id       UserID
 	Name     string
 	Email    string
 	Password string
+	// Null until the user opens the link of the verification email
+	EmailVerificationDate sql.NullTime
+	Role                  Role
+	// Null while the user isn't suspended
+	SuspensionDate sql.NullTime
+	// Null for suspensions that last until they are lifted
+	SuspensionEnd    sql.NullTime
+	SuspensionReason string
 }
 
-func FindUserByEmail(email string) (*User, error) {
-	user := User {}
+// Reports whether the user can't log in at that moment
+func (u User) IsSuspended(now time.Time) bool {
+	return u.SuspensionDate.Valid && (!u.SuspensionEnd.Valid || now.Before(u.SuspensionEnd.Time))
+}
 
-	row := databases.DbPool.QueryRow("SELECT id, name, email, password FROM Users WHERE email = $1", email)
-	if err := row.Scan(&user.Id, &user.Name, &user.Email, &user.Password); err != nil {
+type UserStore interface {
+	// Returns nil without error when there is no user with that email
+	FindUserByEmail(ctx context.Context, email string) (*User, error)
+	// Returns nil without error when there is no user with that id
+	FindUserById(ctx context.Context, userId UserID) (*User, error)
+	InsertUser(ctx context.Context, user User) error
+	UpdateUserPassword(ctx context.Context, userId UserID, password string) (bool, error)
+	// Only marks users that weren't verified yet, returns false otherwise
+	MarkEmailVerified(ctx context.Context, userId UserID, verificationDate time.Time) (bool, error)
+	// Returns up to limit users with an id greater than afterId ordered by id, for batch processing
+	FindUsersAfter(ctx context.Context, afterId UserID, limit int) ([]User, error)
+	UpdateUserRole(ctx context.Context, userId UserID, role Role) (bool, error)
+	// An end that isn't valid suspends the user until UnsuspendUser is called
+	SuspendUser(ctx context.Context, userId UserID, date time.Time, end sql.NullTime, reason string) (bool, error)
+	// Returns false when the user doesn't exist or wasn't suspended
+	UnsuspendUser(ctx context.Context, userId UserID) (bool, error)
+}
+
+const userColumns = "id, name, email, password, email_verification_date, role, suspension_date, suspension_end, suspension_reason"
+
+func scanUser(row interface{ Scan(dest ...any) error }, user *User) error {
+	return row.Scan(
+		&user.Id, &user.Name, &user.Email, &user.Password, &user.EmailVerificationDate,
+		&user.Role, &user.SuspensionDate, &user.SuspensionEnd, &user.SuspensionReason,
+	)
+}
+
+func (s *PostgresStore) FindUserByEmail(ctx context.Context, email string) (*User, error) {
+	user := User{}
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM Users WHERE email = $1", email)
+	if err := scanUser(row, &user); err != nil {
 		// No user found
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 
-		return nil, err
+		return nil, translateError(err)
 	}
 
 	return &user, nil
 }
 
-func InsertUser(user User) error {
+func (s *PostgresStore) FindUserById(ctx context.Context, userId UserID) (*User, error) {
+	user := User{}
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM Users WHERE id = $1", userId)
+	if err := scanUser(row, &user); err != nil {
+		if err == sql.ErrNoRows || isInvalidId(err) {
+			return nil, nil
+		}
+
+		return nil, translateError(err)
+	}
+
+	return &user, nil
+}
+
+func (s *PostgresStore) InsertUser(ctx context.Context, user User) error {
 	stmt := "INSERT INTO Users(id, name, email, password) VALUES ($1, $2, $3, $4)"
-	_, err := databases.DbPool.Exec(stmt, user.Id, user.Name, user.Email, user.Password)
+	_, err := s.exec(ctx, stmt, user.Id, user.Name, user.Email, user.Password)
 	return err
-}
\ No newline at end of file
+}
+
+func (s *PostgresStore) UpdateUserPassword(ctx context.Context, userId UserID, password string) (bool, error) {
+	stmt := "UPDATE Users SET password = $1 WHERE id = $2"
+	result, err := s.exec(ctx, stmt, password, userId)
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) MarkEmailVerified(ctx context.Context, userId UserID, verificationDate time.Time) (bool, error) {
+	stmt := "UPDATE Users SET email_verification_date = $1 WHERE id = $2 AND email_verification_date IS null"
+	result, err := s.exec(ctx, stmt, verificationDate, userId)
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) FindUsersAfter(ctx context.Context, afterId UserID, limit int) ([]User, error) {
+	users := make([]User, 0, limit)
+
+	// Every uuid is greater than the nil uuid, so the first batch starts there
+	if afterId == "" {
+		afterId = "00000000-0000-0000-0000-000000000000"
+	}
+
+	query := "SELECT " + userColumns + " FROM Users WHERE id > $1 ORDER BY id LIMIT $2"
+	cursor, err := s.query(ctx, query, afterId, limit)
+	if err != nil {
+		return users, err
+	}
+	defer cursor.Close()
+
+	for cursor.Next() {
+		user := User{}
+
+		err = scanUser(cursor, &user)
+		if err != nil {
+			return users, err
+		}
+
+		users = append(users, user)
+	}
+
+	return users, cursor.Err()
+}
+
+func (s *PostgresStore) UpdateUserRole(ctx context.Context, userId UserID, role Role) (bool, error) {
+	result, err := s.exec(ctx, "UPDATE Users SET role = $1 WHERE id = $2", role, userId)
+	if isInvalidId(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) SuspendUser(ctx context.Context, userId UserID, date time.Time, end sql.NullTime, reason string) (bool, error) {
+	stmt := "UPDATE Users SET suspension_date = $1, suspension_end = $2, suspension_reason = $3 WHERE id = $4"
+	result, err := s.exec(ctx, stmt, date, end, reason, userId)
+	if isInvalidId(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *PostgresStore) UnsuspendUser(ctx context.Context, userId UserID) (bool, error) {
+	stmt := "UPDATE Users SET suspension_date = null, suspension_end = null, suspension_reason = '' WHERE id = $1 AND suspension_date IS NOT null"
+	result, err := s.exec(ctx, stmt, userId)
+	if isInvalidId(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return affectedOne(result)
+}
+
+func (s *MemoryStore) FindUserByEmail(ctx context.Context, email string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (s *MemoryStore) FindUserById(ctx context.Context, userId UserID) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, nil
+	}
+
+	return &user, nil
+}
+
+func (s *MemoryStore) InsertUser(ctx context.Context, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.Id]; ok {
+		return apperrors.Conflict("User already exists")
+	}
+
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return apperrors.Conflict("Email already registered")
+		}
+	}
+
+	if user.Role == "" {
+		user.Role = RoleUser
+	}
+
+	s.users[user.Id] = user
+	return nil
+}
+
+func (s *MemoryStore) UpdateUserPassword(ctx context.Context, userId UserID, password string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return false, nil
+	}
+
+	user.Password = password
+	s.users[userId] = user
+	return true, nil
+}
+
+func (s *MemoryStore) MarkEmailVerified(ctx context.Context, userId UserID, verificationDate time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok || user.EmailVerificationDate.Valid {
+		return false, nil
+	}
+
+	user.EmailVerificationDate = sql.NullTime{Time: verificationDate, Valid: true}
+	s.users[userId] = user
+	return true, nil
+}
+
+func (s *MemoryStore) FindUsersAfter(ctx context.Context, afterId UserID, limit int) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, limit)
+	for _, user := range s.users {
+		if user.Id > afterId {
+			users = append(users, user)
+		}
+	}
+
+	slices.SortFunc(users, func(a, b User) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	if len(users) > limit {
+		users = users[:limit]
+	}
+
+	return users, nil
+}
+
+func (s *MemoryStore) UpdateUserRole(ctx context.Context, userId UserID, role Role) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return false, nil
+	}
+
+	user.Role = role
+	s.users[userId] = user
+	return true, nil
+}
+
+func (s *MemoryStore) SuspendUser(ctx context.Context, userId UserID, date time.Time, end sql.NullTime, reason string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return false, nil
+	}
+
+	user.SuspensionDate = sql.NullTime{Time: date, Valid: true}
+	user.SuspensionEnd = end
+	user.SuspensionReason = reason
+	s.users[userId] = user
+	return true, nil
+}
+
+func (s *MemoryStore) UnsuspendUser(ctx context.Context, userId UserID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok || !user.SuspensionDate.Valid {
+		return false, nil
+	}
+
+	user.SuspensionDate = sql.NullTime{}
+	user.SuspensionEnd = sql.NullTime{}
+	user.SuspensionReason = ""
+	s.users[userId] = user
+	return true, nil
+}
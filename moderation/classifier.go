@@ -0,0 +1,87 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The text being moderated and what it is
+type Content struct {
+	Kind string
+	Text string
+	// Empty for questions of anonymous askers that weren't logged in
+	AuthorId string
+}
+
+type Verdict struct {
+	Flagged bool
+	// Why the content was flagged, shown to the moderators
+	Reason string
+}
+
+/**
+ * Classifier decides whether content needs a review, usually backed by a machine learning model
+ * or a third party moderation service. The word lists run before it, so it only sees content
+ * they let through.
+ */
+type Classifier interface {
+	Classify(ctx context.Context, content Content) (Verdict, error)
+}
+
+/**
+ * HTTPClassifier posts the content as {"kind": "...", "text": "...", "author_id": "..."} to a URL
+ * and expects {"flagged": true, "reason": "..."} back, so any service can be plugged in with a small adapter.
+ */
+type HTTPClassifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPClassifier(url string, timeout time.Duration) *HTTPClassifier {
+	return &HTTPClassifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+type classifyRequest struct {
+	Kind     string `json:"kind"`
+	Text     string `json:"text"`
+	AuthorId string `json:"author_id,omitempty"`
+}
+
+type classifyResponse struct {
+	Flagged bool   `json:"flagged"`
+	Reason  string `json:"reason"`
+}
+
+func (c *HTTPClassifier) Classify(ctx context.Context, content Content) (Verdict, error) {
+	body, err := json.Marshal(classifyRequest{Kind: content.Kind, Text: content.Text, AuthorId: content.AuthorId})
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("classifier answered with status %d", response.StatusCode)
+	}
+
+	result := classifyResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return Verdict{}, fmt.Errorf("decoding classifier response: %w", err)
+	}
+
+	return Verdict{Flagged: result.Flagged, Reason: result.Reason}, nil
+}
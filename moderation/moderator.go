@@ -0,0 +1,129 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/config"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+type Action int
+
+const (
+	// The content is delivered as usual
+	Allow Action = iota
+	// The content waits in the review queue until a moderator approves it
+	Hold
+	// The content matched a muted word of its recipient, it's kept out of the queue and never delivered
+	Mute
+)
+
+type Decision struct {
+	Action Action
+	// Why the content was held, shown to the moderators
+	Reasons []string
+}
+
+/**
+ * Moderator screens questions, replies and posts before they are delivered. Content with words
+ * of the global blocklist or flagged by the classifier is held for review, and questions with
+ * muted words of their recipient are silently dropped.
+ */
+type Moderator struct {
+	blocklist  *Wordlist
+	classifier Classifier
+	settings   models.SettingsStore
+
+	maxMutedWords int
+}
+
+// Longest muted word or phrase, in characters
+const maxMutedWordLength = 100
+
+// The classifier can be nil
+func NewModerator(cfg config.ModerationConfig, blocklist *Wordlist, classifier Classifier, settings models.SettingsStore) *Moderator {
+	return &Moderator{
+		blocklist:  blocklist,
+		classifier: classifier,
+		settings:   settings,
+
+		maxMutedWords: cfg.MaxMutedWords,
+	}
+}
+
+/**
+ * Decides what happens to the content. recipientId is whose muted words apply, empty when
+ * nobody's do. A classifier that fails lets the content through, so an outage of the
+ * service doesn't stop every question.
+ */
+func (m *Moderator) Screen(ctx context.Context, content Content, recipientId models.UserID) (Decision, error) {
+	if found := m.blocklist.Match(content.Text); len(found) > 0 {
+		return Decision{Action: Hold, Reasons: []string{"blocklist: " + strings.Join(found, ", ")}}, nil
+	}
+
+	if recipientId != "" {
+		words, err := m.settings.FindMutedWords(ctx, recipientId)
+		if err != nil {
+			return Decision{}, err
+		}
+		if found := NewWordlist(words).Match(content.Text); len(found) > 0 {
+			return Decision{Action: Mute, Reasons: []string{"muted words: " + strings.Join(found, ", ")}}, nil
+		}
+	}
+
+	if m.classifier != nil {
+		verdict, err := m.classifier.Classify(ctx, content)
+		if err != nil {
+			slog.Error("Error classifying content, letting it through", "kind", content.Kind, "error", err)
+			return Decision{Action: Allow}, nil
+		}
+		if verdict.Flagged {
+			return Decision{Action: Hold, Reasons: []string{fmt.Sprintf("classifier: %s", verdict.Reason)}}, nil
+		}
+	}
+
+	return Decision{Action: Allow}, nil
+}
+
+/**
+ * Cleans a list of muted words before storing it: trims them and drops the empty ones and
+ * those that normalize to the same word as an earlier one. Fails when there are too many or too long.
+ */
+func (m *Moderator) CleanMutedWords(words []string) ([]string, error) {
+	cleaned := []string{}
+	seen := map[string]bool{}
+
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		normalized := Normalize(word)
+		if normalized == "" || seen[normalized] {
+			continue
+		}
+
+		if utf8.RuneCountInString(word) > maxMutedWordLength {
+			return nil, apperrors.Validation("The request has invalid fields", apperrors.FieldError{
+				Field:   "words",
+				Code:    "too_long",
+				Message: fmt.Sprintf("each word must be at most %d characters long", maxMutedWordLength),
+			})
+		}
+
+		seen[normalized] = true
+		cleaned = append(cleaned, word)
+	}
+
+	if len(cleaned) > m.maxMutedWords {
+		return nil, apperrors.Validation("The request has invalid fields", apperrors.FieldError{
+			Field:   "words",
+			Code:    "too_many",
+			Message: fmt.Sprintf("at most %d words can be muted", m.maxMutedWords),
+		})
+	}
+
+	return cleaned, nil
+}
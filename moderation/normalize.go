@@ -0,0 +1,118 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NFKD also turns fullwidth and styled letters, like 𝐛𝐨𝐥𝐝 or ｗｉｄｅ, into plain ones before the accents are removed
+var foldUnicode = transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// Digits commonly used in place of letters, and letters of other scripts that look like latin ones
+var lookalikes = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'ø': 'o', 'ł': 'l', 'đ': 'd', 'ı': 'i',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+}
+
+// Symbols used in place of letters, only replaced before a letter so the punctuation of normal text is still dropped
+var symbolLookalikes = map[rune]rune{
+	'@': 'a', '$': 's', '!': 'i', '|': 'i', '+': 't', '€': 'e',
+}
+
+/**
+ * Normalize reduces the text to lowercase latin words separated by single spaces, so the
+ * usual tricks to get past a filter match the plain word: accents, fullwidth or styled
+ * letters, lookalike letters of other scripts, leetspeak, invisible characters and letters
+ * spelled out one by one ("1d10t", "ídïøt" and "i.d.i.o.t" all become "idiot"). Letters
+ * repeated three or more times are left doubled, since many words have a doubled letter
+ * ("asss" becomes "ass"), Wordlist also tries words without any repeated letter.
+ * The words of the lists are normalized the same way.
+ */
+func Normalize(text string) string {
+	if folded, _, err := transform.String(foldUnicode, text); err == nil {
+		text = folded
+	}
+
+	letters := []rune(strings.ToLower(text))
+	words := []string{}
+	var word []rune
+
+	for i, r := range letters {
+		if replacement, ok := lookalikes[r]; ok {
+			r = replacement
+		} else if replacement, ok := symbolLookalikes[r]; ok && i+1 < len(letters) && isLetter(letters[i+1]) {
+			r = replacement
+		}
+
+		if unicode.IsLetter(r) {
+			word = append(word, r)
+			continue
+		}
+
+		// Anything else ends the word, zero width characters would split it so they are skipped
+		if len(word) > 0 && !unicode.Is(unicode.Cf, r) {
+			words = append(words, string(word))
+			word = nil
+		}
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+
+	// Runs of single letters are joined back, they are usually a word spelled out
+	joined := make([]string, 0, len(words))
+	for i := 0; i < len(words); i++ {
+		spelled := words[i]
+		for len([]rune(words[i])) == 1 && i+1 < len(words) && len([]rune(words[i+1])) == 1 {
+			i++
+			spelled += words[i]
+		}
+		joined = append(joined, capRepeats(spelled))
+	}
+
+	return strings.Join(joined, " ")
+}
+
+// Reports whether the rune is a letter once normalized
+func isLetter(r rune) bool {
+	_, ok := lookalikes[r]
+	return ok || unicode.IsLetter(r)
+}
+
+// Leaves at most two of the same letter in a row
+func capRepeats(word string) string {
+	return limitRepeats(word, 2)
+}
+
+// Leaves a single letter where it was repeated, "iidiot" becomes "idiot"
+func collapseRepeats(word string) string {
+	return limitRepeats(word, 1)
+}
+
+func limitRepeats(word string, limit int) string {
+	var b strings.Builder
+	var last rune
+	run := 0
+
+	for _, r := range word {
+		if r == last {
+			run++
+		} else {
+			last = r
+			run = 1
+		}
+
+		if run <= limit {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
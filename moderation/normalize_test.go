@@ -0,0 +1,66 @@
+package moderation
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hola, ¿Cómo estás?", "hola como estas"},
+		{"1d10t", "idiot"},
+		{"ídïøt", "idiot"},
+		{"ｗｉｄｅ 𝐛𝐨𝐥𝐝", "wide bold"},
+		{"i.d.i.o.t", "idiot"},
+		{"id\u200biot", "idiot"},
+		{"\u0430ss", "ass"},
+		{"$tupid", "stupid"},
+		{"hello!", "hello"},
+		{"iiidiot", "iidiot"},
+		{"asssss", "ass"},
+		{"llamame pass", "llamame pass"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := Normalize(test.text); got != test.want {
+			t.Errorf("Normalize(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestWordlistMatch(t *testing.T) {
+	list := NewWordlist([]string{"ass", "Idiot", "hijo de puta"})
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"as far as I know", []string{}},
+		{"a class about grass", []string{}},
+		{"pass the ball", []string{}},
+		{"what an ass", []string{"ass"}},
+		{"what an asssss", []string{"ass"}},
+		{"you 1d10t", []string{"Idiot"}},
+		{"iiidiot", []string{"Idiot"}},
+		{"i d i o t", []string{"Idiot"}},
+		{"idiot idiot", []string{"Idiot"}},
+		{"hijooo de putaa", []string{"hijo de puta"}},
+		{"hijo de", []string{}},
+	}
+
+	for _, test := range tests {
+		if got := list.Match(test.text); !slices.Equal(got, test.want) {
+			t.Errorf("Match(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestEmptyWordlistMatchesNothing(t *testing.T) {
+	if got := NewWordlist(nil).Match("anything at all"); len(got) != 0 {
+		t.Errorf("Match on an empty list = %q", got)
+	}
+}
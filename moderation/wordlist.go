@@ -0,0 +1,88 @@
+package moderation
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+/**
+ * Wordlist finds words and phrases in texts after normalizing both, see Normalize.
+ * Only whole words match, so "class" doesn't match a list with "ass". Entries without a
+ * doubled letter also match with the repeated letters of the text collapsed, so "iidiot"
+ * matches "idiot" while "as" doesn't match "ass".
+ */
+type Wordlist struct {
+	// Normalized entry -> entry as it was written
+	entries map[string]string
+	// Words of the longest entry, to bound the phrases tried at each position
+	longest int
+}
+
+func NewWordlist(entries []string) *Wordlist {
+	w := &Wordlist{entries: map[string]string{}}
+
+	for _, entry := range entries {
+		normalized := Normalize(entry)
+		if normalized == "" {
+			continue
+		}
+
+		w.entries[normalized] = strings.TrimSpace(entry)
+		w.longest = max(w.longest, len(strings.Fields(normalized)))
+	}
+
+	return w
+}
+
+/**
+ * Reads a list with an entry per line, empty lines and lines starting with # are skipped
+ */
+func LoadWordlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+func (w *Wordlist) Len() int {
+	return len(w.entries)
+}
+
+// Returns the entries found in the text as they were written in the list, each once
+func (w *Wordlist) Match(text string) []string {
+	if len(w.entries) == 0 {
+		return nil
+	}
+
+	words := strings.Fields(Normalize(text))
+	found := []string{}
+	seen := map[string]bool{}
+
+	for i := range words {
+		for n := 1; n <= w.longest && i+n <= len(words); n++ {
+			phrase := strings.Join(words[i:i+n], " ")
+			// A collapsed phrase has no doubled letters, so it only finds entries without them
+			for _, candidate := range []string{phrase, collapseRepeats(phrase)} {
+				if entry, ok := w.entries[candidate]; ok && !seen[candidate] {
+					seen[candidate] = true
+					found = append(found, entry)
+				}
+			}
+		}
+	}
+
+	return found
+}
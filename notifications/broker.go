@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+// Notifications waiting to be written to a slow client before new ones are dropped
+const subscriberBuffer = 16
+
+/**
+ * Broker delivers new notifications to the live streams of their users.
+ * Delivery is best effort: clients that miss something can catch up with the stored notifications.
+ */
+type Broker interface {
+	Publish(ctx context.Context, notification models.Notification) error
+	// Returns the channel where the notifications of the user arrive and a function to stop receiving them
+	Subscribe(userId models.UserID) (<-chan models.Notification, func())
+}
+
+// Broker that only reaches the subscribers of this process
+type LocalBroker struct {
+	mu          sync.RWMutex
+	subscribers map[models.UserID]map[chan models.Notification]struct{}
+}
+
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{subscribers: map[models.UserID]map[chan models.Notification]struct{}{}}
+}
+
+func (b *LocalBroker) Publish(ctx context.Context, notification models.Notification) error {
+	b.Deliver(notification)
+	return nil
+}
+
+// Sends the notification to the local subscribers of its user
+func (b *LocalBroker) Deliver(notification models.Notification) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for subscriber := range b.subscribers[notification.UserId] {
+		select {
+		case subscriber <- notification:
+		default:
+			slog.Warn("Dropping notification for slow subscriber", "user_id", notification.UserId, "notification_id", notification.Id)
+		}
+	}
+}
+
+func (b *LocalBroker) Subscribe(userId models.UserID) (<-chan models.Notification, func()) {
+	subscriber := make(chan models.Notification, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[userId] == nil {
+		b.subscribers[userId] = map[chan models.Notification]struct{}{}
+	}
+	b.subscribers[userId][subscriber] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subscribers[userId], subscriber)
+			if len(b.subscribers[userId]) == 0 {
+				delete(b.subscribers, userId)
+			}
+			close(subscriber)
+		})
+	}
+
+	return subscriber, unsubscribe
+}
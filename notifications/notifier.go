@@ -0,0 +1,62 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/preguntame/preguntame-backend/config"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+// Notifier stores the notifications and publishes them to the live streams
+type Notifier struct {
+	store     models.NotificationStore
+	relations models.RelationStore
+	broker    Broker
+	heartbeat time.Duration
+}
+
+func NewNotifier(cfg config.NotificationsConfig, store models.NotificationStore, relations models.RelationStore, broker Broker) *Notifier {
+	return &Notifier{store: store, relations: relations, broker: broker, heartbeat: cfg.Heartbeat}
+}
+
+// Notifies the user, actorId and subjectId can be empty. Nothing is sent when the user blocked or muted the actor
+func (n *Notifier) Notify(ctx context.Context, userId models.UserID, kind models.NotificationKind, actorId models.UserID, subjectId string) error {
+	if actorId != "" {
+		ignored, err := n.relations.HasRelation(ctx, userId, actorId, models.RelationBlock, models.RelationMute)
+		if err != nil || ignored {
+			return err
+		}
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	notification := models.Notification{
+		Id:           id.String(),
+		UserId:       userId,
+		Kind:         kind,
+		ActorId:      sql.NullString{String: actorId, Valid: actorId != ""},
+		SubjectId:    sql.NullString{String: subjectId, Valid: subjectId != ""},
+		CreationDate: time.Now(),
+	}
+
+	if err := n.store.InsertNotification(ctx, notification); err != nil {
+		return err
+	}
+
+	return n.broker.Publish(ctx, notification)
+}
+
+// How often the live streams send a keep alive message
+func (n *Notifier) Heartbeat() time.Duration {
+	return n.heartbeat
+}
+
+func (n *Notifier) Subscribe(userId models.UserID) (<-chan models.Notification, func()) {
+	return n.broker.Subscribe(userId)
+}
@@ -0,0 +1,84 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+const postgresChannel = "notifications"
+
+/**
+ * PostgresBroker publishes with NOTIFY so every instance listening on the channel
+ * delivers the notification to its own subscribers. Only the metadata of the
+ * notification is sent, NOTIFY payloads are limited to 8000 bytes.
+ */
+type PostgresBroker struct {
+	db       *sql.DB
+	local    *LocalBroker
+	listener *pq.Listener
+}
+
+func NewPostgresBroker(db *sql.DB, dsn string) (*PostgresBroker, error) {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("Notifications listener error", "error", err)
+		}
+	})
+
+	if err := listener.Listen(postgresChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return &PostgresBroker{db: db, local: NewLocalBroker(), listener: listener}, nil
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, notification models.Notification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", postgresChannel, string(payload))
+	return err
+}
+
+func (b *PostgresBroker) Subscribe(userId models.UserID) (<-chan models.Notification, func()) {
+	return b.local.Subscribe(userId)
+}
+
+// Delivers what arrives on the channel to the local subscribers until the context is done
+func (b *PostgresBroker) Run(ctx context.Context) {
+	defer b.listener.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case event := <-b.listener.Notify:
+			// A nil event means the connection was lost and reestablished, anything sent meanwhile is lost
+			if event == nil {
+				slog.Warn("Notifications listener reconnected")
+				continue
+			}
+
+			notification := models.Notification{}
+			if err := json.Unmarshal([]byte(event.Extra), &notification); err != nil {
+				slog.Error("Invalid notification payload", "error", err)
+				continue
+			}
+			b.local.Deliver(notification)
+
+		case <-time.After(90 * time.Second):
+			// Checks the connection is still alive when the channel is quiet
+			go b.listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package policy
+
+import (
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+type Permission string
+
+const (
+	ReplyQuestion     Permission = "questions:reply"
+	FavouriteQuestion Permission = "questions:favourite"
+	DeleteQuestion    Permission = "questions:delete"
+	CreatePost        Permission = "posts:create"
+	EditPost          Permission = "posts:edit"
+	DeletePost        Permission = "posts:delete"
+	// Bringing back a previous revision is only for the author, moderators can delete the post instead
+	RestorePost Permission = "posts:restore"
+	// Taking questions and posts out of the trash, which only has what the owner deleted
+	RestoreDeleted Permission = "trash:restore"
+	// Soft deleted posts and content hidden by a moderator
+	ViewHiddenContent Permission = "content:view_hidden"
+	HideContent       Permission = "content:hide"
+	ReviewContent     Permission = "moderation:review"
+	TriageReports     Permission = "reports:triage"
+	ViewAccounts      Permission = "users:view"
+	SuspendUsers      Permission = "users:suspend"
+	ManageRoles       Permission = "users:manage_roles"
+	ViewActions       Permission = "moderation:view_actions"
+	ViewAuditLog      Permission = "audit:view"
+)
+
+type Scope int
+
+const (
+	// Only on the resources of the user
+	Own Scope = iota + 1
+	// On the resources of anyone, and on those that belong to nobody
+	Any
+)
+
+/**
+ * What each role can do. Every role has the permissions of the roles below it,
+ * and a wider scope replaces a narrower one.
+ */
+var grants = buildGrants(
+	map[models.Role]map[Permission]Scope{
+		models.RoleUser: {
+			ReplyQuestion:     Own,
+			FavouriteQuestion: Own,
+			DeleteQuestion:    Own,
+			CreatePost:        Own,
+			EditPost:          Own,
+			DeletePost:        Own,
+			RestorePost:       Own,
+			RestoreDeleted:    Own,
+			ViewHiddenContent: Own,
+		},
+		models.RoleModerator: {
+			DeleteQuestion:    Any,
+			DeletePost:        Any,
+			ViewHiddenContent: Any,
+			HideContent:       Any,
+			ReviewContent:     Any,
+			TriageReports:     Any,
+			ViewAccounts:      Any,
+			SuspendUsers:      Any,
+		},
+		models.RoleAdmin: {
+			EditPost:     Any,
+			ManageRoles:  Any,
+			ViewActions:  Any,
+			ViewAuditLog: Any,
+		},
+	},
+)
+
+func buildGrants(byRole map[models.Role]map[Permission]Scope) map[models.Role]map[Permission]Scope {
+	built := map[models.Role]map[Permission]Scope{}
+	inherited := map[Permission]Scope{}
+
+	for _, role := range models.Roles {
+		for permission, scope := range byRole[role] {
+			if scope > inherited[permission] {
+				inherited[permission] = scope
+			}
+		}
+
+		built[role] = map[Permission]Scope{}
+		for permission, scope := range inherited {
+			built[role][permission] = scope
+		}
+	}
+
+	return built
+}
+
+/**
+ * Reports whether the principal has the permission on a resource of ownerId. Resources that
+ * belong to nobody have an empty ownerId and need the Any scope. Anonymous requests use the
+ * zero Principal and have no permissions.
+ */
+func Allowed(principal auth.Principal, permission Permission, ownerId models.UserID) bool {
+	if principal.UserId == "" {
+		return false
+	}
+
+	switch grants[principal.Role][permission] {
+	case Any:
+		return true
+	case Own:
+		return ownerId != "" && ownerId == principal.UserId
+	}
+
+	return false
+}
+
+// Reports whether the principal has the permission on at least their own resources
+func Has(principal auth.Principal, permission Permission) bool {
+	return principal.UserId != "" && grants[principal.Role][permission] != 0
+}
+
+// Soft deleted and hidden posts can only be seen by their owner and the moderators
+func CanViewPost(principal auth.Principal, post models.Post) bool {
+	if !post.DeletionDate.Valid && !post.HiddenDate.Valid {
+		return true
+	}
+
+	return Allowed(principal, ViewHiddenContent, post.OwnerId)
+}
+
+// Suspensions only apply to users with a lower role, so moderators can't suspend each other
+func CanSuspend(principal auth.Principal, user models.User) bool {
+	return Allowed(principal, SuspendUsers, "") && !user.Role.AtLeast(principal.Role)
+}
+
+// Nobody changes their own role, so there is always an admin left
+func CanChangeRole(principal auth.Principal, user models.User) bool {
+	return Allowed(principal, ManageRoles, "") && user.Id != principal.UserId
+}
+
+/**
+ * Middleware for routes that need the permission on resources of anyone, like the admin
+ * endpoints. It must run after auth.RequireAuth.
+ */
+func Require(permission Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(e echo.Context) error {
+			principal := auth.CurrentPrincipal(e)
+			if !Allowed(principal, permission, "") {
+				slog.Warn("Missing permission", "user_id", principal.UserId, "role", principal.Role, "permission", permission, "path", e.Request().URL.Path)
+				return apperrors.Forbidden("You don't have permission to do this")
+			}
+
+			return next(e)
+		}
+	}
+}
+
+/**
+ * Middleware for routes on the resources of the user in the path param, like /users/:user_id/posts.
+ * The owner of those resources is the user of the path, so handlers must only act on resources
+ * that belong to them. It must run after auth.RequireAuth.
+ */
+func RequireOn(permission Permission, param string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(e echo.Context) error {
+			principal := auth.CurrentPrincipal(e)
+			if !Allowed(principal, permission, e.Param(param)) {
+				slog.Warn("Can't act on another's resources", "user_id", principal.UserId, "role", principal.Role, "permission", permission, param, e.Param(param), "path", e.Request().URL.Path)
+				return apperrors.Forbidden("Can't act on another's resources")
+			}
+
+			return next(e)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+const (
+	ownerId = "11111111-1111-1111-1111-111111111111"
+	otherId = "22222222-2222-2222-2222-222222222222"
+)
+
+func TestAllowed(t *testing.T) {
+	user := auth.Principal{UserId: ownerId, Role: models.RoleUser}
+	moderator := auth.Principal{UserId: ownerId, Role: models.RoleModerator}
+	admin := auth.Principal{UserId: ownerId, Role: models.RoleAdmin}
+
+	tests := []struct {
+		name       string
+		principal  auth.Principal
+		permission Permission
+		ownerId    models.UserID
+		want       bool
+	}{
+		{"anonymous has nothing", auth.Principal{}, ReplyQuestion, "", false},
+		{"anonymous has nothing on their id", auth.Principal{Role: models.RoleAdmin}, EditPost, "", false},
+		{"user on own resource", user, DeletePost, ownerId, true},
+		{"user on another's resource", user, DeletePost, otherId, false},
+		{"user on nobody's resource", user, DeletePost, "", false},
+		{"user without the permission", user, HideContent, ownerId, false},
+		{"moderator deletes another's post", moderator, DeletePost, otherId, true},
+		{"moderator inherits own scope", moderator, ReplyQuestion, ownerId, true},
+		{"moderator can't reply for another", moderator, ReplyQuestion, otherId, false},
+		{"moderator can't edit another's post", moderator, EditPost, otherId, false},
+		{"moderator can't manage roles", moderator, ManageRoles, "", false},
+		{"admin edits another's post", admin, EditPost, otherId, true},
+		{"admin inherits moderator permissions", admin, SuspendUsers, "", true},
+		{"admin can't restore another's revision", admin, RestorePost, otherId, false},
+		{"admin can't restore another's trash", admin, RestoreDeleted, otherId, false},
+		{"unknown role has nothing", auth.Principal{UserId: ownerId, Role: "owner"}, DeletePost, ownerId, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Allowed(test.principal, test.permission, test.ownerId); got != test.want {
+				t.Errorf("Allowed(%s, %s, %q) = %v, want %v", test.principal.Role, test.permission, test.ownerId, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildGrants(t *testing.T) {
+	built := buildGrants(map[models.Role]map[Permission]Scope{
+		models.RoleUser:      {DeletePost: Own, CreatePost: Own},
+		models.RoleModerator: {DeletePost: Any, HideContent: Any},
+		models.RoleAdmin:     {CreatePost: Own, ManageRoles: Any},
+	})
+
+	tests := []struct {
+		role       models.Role
+		permission Permission
+		want       Scope
+	}{
+		{models.RoleUser, DeletePost, Own},
+		{models.RoleUser, HideContent, 0},
+		{models.RoleModerator, DeletePost, Any},
+		{models.RoleModerator, CreatePost, Own},
+		{models.RoleModerator, ManageRoles, 0},
+		{models.RoleAdmin, DeletePost, Any},
+		{models.RoleAdmin, HideContent, Any},
+		{models.RoleAdmin, CreatePost, Own},
+		{models.RoleAdmin, ManageRoles, Any},
+	}
+
+	for _, test := range tests {
+		if got := built[test.role][test.permission]; got != test.want {
+			t.Errorf("%s %s = %v, want %v", test.role, test.permission, got, test.want)
+		}
+	}
+}
+
+// A narrower scope granted to a higher role never replaces a wider one it inherited
+func TestBuildGrantsKeepsWiderScope(t *testing.T) {
+	built := buildGrants(map[models.Role]map[Permission]Scope{
+		models.RoleModerator: {DeletePost: Any},
+		models.RoleAdmin:     {DeletePost: Own},
+	})
+
+	if got := built[models.RoleAdmin][DeletePost]; got != Any {
+		t.Errorf("admin DeletePost = %v, want Any", got)
+	}
+}
+
+func TestEveryRoleHasTheGrantsOfTheRolesBelow(t *testing.T) {
+	for i := 1; i < len(models.Roles); i++ {
+		lower, higher := models.Roles[i-1], models.Roles[i]
+		for permission, scope := range grants[lower] {
+			if grants[higher][permission] < scope {
+				t.Errorf("%s has %s with scope %v, narrower than %s", higher, permission, grants[higher][permission], lower)
+			}
+		}
+	}
+}
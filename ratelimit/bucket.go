@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+// Outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	// Size of the bucket
+	Limit     int
+	Remaining int
+	// Until a token is available, zero when the request was allowed
+	RetryAfter time.Duration
+	// Until the bucket is full again
+	Reset time.Duration
+}
+
+/**
+ * Backend keeps the buckets of every key. Take must be atomic, two requests for the
+ * same key can't both get the last token.
+ */
+type Backend interface {
+	Take(ctx context.Context, key string, limit config.RateLimit, now time.Time) (Result, error)
+	// Forgets the buckets that are full again, they are the same as a missing one
+	Purge(ctx context.Context, now time.Time) error
+}
+
+/**
+ * Token bucket with room for limit.Requests tokens that refills evenly over limit.Per,
+ * so bursts are allowed but the sustained rate is limit.Requests per limit.Per.
+ */
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// When it's full again and can be forgotten
+	full time.Time
+}
+
+func newBucket(limit config.RateLimit, now time.Time) bucket {
+	return bucket{tokens: float64(limit.Requests), updated: now, full: now}
+}
+
+func (b *bucket) take(limit config.RateLimit, now time.Time) Result {
+	size := float64(limit.Requests)
+	rate := size / limit.Per.Seconds()
+
+	// Clocks of different instances may disagree, time never goes back for a bucket
+	elapsed := max(0, now.Sub(b.updated).Seconds())
+	b.tokens = min(size, b.tokens+elapsed*rate)
+	b.updated = now
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = seconds((size - b.tokens) / rate)
+	b.full = now.Add(result.Reset)
+
+	return result
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
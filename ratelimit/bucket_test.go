@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+var start = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestBucketAllowsBurstThenRejects(t *testing.T) {
+	limit := config.RateLimit{Requests: 3, Per: time.Minute}
+	b := newBucket(limit, start)
+
+	for i := 0; i < 3; i++ {
+		result := b.take(limit, start)
+		if !result.Allowed {
+			t.Fatalf("request %d was rejected", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("request %d: remaining = %d, want %d", i+1, result.Remaining, 2-i)
+		}
+	}
+
+	result := b.take(limit, start)
+	if result.Allowed {
+		t.Fatal("request over the burst was allowed")
+	}
+	// A token comes back every 20 seconds
+	if result.RetryAfter != 20*time.Second {
+		t.Errorf("retry after = %v, want 20s", result.RetryAfter)
+	}
+	if result.Reset != time.Minute {
+		t.Errorf("reset = %v, want 1m", result.Reset)
+	}
+}
+
+func TestBucketRefillsEvenly(t *testing.T) {
+	limit := config.RateLimit{Requests: 3, Per: time.Minute}
+	b := newBucket(limit, start)
+	for i := 0; i < 3; i++ {
+		b.take(limit, start)
+	}
+
+	if result := b.take(limit, start.Add(19*time.Second)); result.Allowed {
+		t.Error("allowed before a token was refilled")
+	}
+	if result := b.take(limit, start.Add(20*time.Second)); !result.Allowed {
+		t.Error("rejected once a token was refilled")
+	}
+
+	// It never holds more than its size, however long it waits
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if result := b.take(limit, later); !result.Allowed {
+			t.Fatalf("request %d after refilling was rejected", i+1)
+		}
+	}
+	if result := b.take(limit, later); result.Allowed {
+		t.Error("the bucket held more tokens than its size")
+	}
+}
+
+func TestBucketIgnoresClockGoingBack(t *testing.T) {
+	limit := config.RateLimit{Requests: 1, Per: time.Minute}
+	b := newBucket(limit, start)
+	b.take(limit, start)
+
+	if result := b.take(limit, start.Add(-time.Hour)); result.Allowed {
+		t.Error("an earlier clock refilled the bucket")
+	}
+}
+
+func TestMemoryBackendKeepsKeysApart(t *testing.T) {
+	backend := NewMemoryBackend()
+	limit := config.RateLimit{Requests: 1, Per: time.Minute}
+	ctx := context.Background()
+
+	if result, _ := backend.Take(ctx, "a", limit, start); !result.Allowed {
+		t.Fatal("first request of a was rejected")
+	}
+	if result, _ := backend.Take(ctx, "a", limit, start); result.Allowed {
+		t.Error("second request of a was allowed")
+	}
+	if result, _ := backend.Take(ctx, "b", limit, start); !result.Allowed {
+		t.Error("first request of b was rejected")
+	}
+}
+
+func TestMemoryBackendPurgesFullBuckets(t *testing.T) {
+	backend := NewMemoryBackend()
+	limit := config.RateLimit{Requests: 2, Per: time.Minute}
+	ctx := context.Background()
+
+	backend.Take(ctx, "a", limit, start)
+
+	backend.Purge(ctx, start.Add(29*time.Second))
+	if len(backend.buckets) != 1 {
+		t.Fatal("purged a bucket that wasn't full yet")
+	}
+
+	backend.Purge(ctx, start.Add(30*time.Second))
+	if len(backend.buckets) != 0 {
+		t.Error("kept a bucket that was full again")
+	}
+}
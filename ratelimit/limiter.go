@@ -0,0 +1,160 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/auth"
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+// Returns the key of the bucket for the request, false when the rule doesn't apply to it
+type KeyFunc func(e echo.Context) (string, bool)
+
+type rule struct {
+	name  string
+	limit config.RateLimit
+	key   KeyFunc
+}
+
+// Limiter has the middlewares that apply the configured budgets to each kind of request
+type Limiter struct {
+	cfg     config.RateLimitsConfig
+	backend Backend
+}
+
+func NewLimiter(cfg config.RateLimitsConfig, backend Backend) *Limiter {
+	return &Limiter{cfg: cfg, backend: backend}
+}
+
+// Login attempts of each IP
+func (l *Limiter) Login(next echo.HandlerFunc) echo.HandlerFunc {
+	return l.middleware(next, rule{"login:ip", l.cfg.Login, ByIP})
+}
+
+// Accounts created from each IP
+func (l *Limiter) Register(next echo.HandlerFunc) echo.HandlerFunc {
+	return l.middleware(next, rule{"register:ip", l.cfg.Register, ByIP})
+}
+
+// Password reset emails requested from each IP
+func (l *Limiter) PasswordForgot(next echo.HandlerFunc) echo.HandlerFunc {
+	return l.middleware(next, rule{"password_forgot:ip", l.cfg.PasswordForgot, ByIP})
+}
+
+/**
+ * Questions sent from each IP, by each logged asker and to each user, so a single sender
+ * can't flood an inbox and many senders together can't bury it either. It must run
+ * after OptionalAuth.
+ */
+func (l *Limiter) Ask(next echo.HandlerFunc) echo.HandlerFunc {
+	return l.middleware(next,
+		rule{"ask:ip", l.cfg.AskPerIP, ByIP},
+		rule{"ask:user", l.cfg.AskPerUser, ByUser},
+		rule{"ask:target", l.cfg.AskPerTarget, ByParam("user_id")},
+	)
+}
+
+/**
+ * Takes a token from the bucket of every rule, in order, and rejects the request on the
+ * first one that is empty. Later rules aren't charged for rejected requests, so whoever
+ * exceeds the budget of their IP doesn't also use up the budget of the user they target.
+ * The X-RateLimit headers describe the rule closest to its limit.
+ */
+func (l *Limiter) middleware(next echo.HandlerFunc, rules ...rule) echo.HandlerFunc {
+	return func(e echo.Context) error {
+		now := time.Now()
+		var closest *Result
+
+		for _, r := range rules {
+			if r.limit.Requests == 0 {
+				continue
+			}
+
+			key, ok := r.key(e)
+			if !ok {
+				continue
+			}
+
+			result, err := l.backend.Take(e.Request().Context(), r.name+":"+key, r.limit, now)
+			if err != nil {
+				// An outage of the backend shouldn't take the whole api down with it
+				slog.Error("Error taking rate limit token", "error", err, "rule", r.name)
+				continue
+			}
+
+			if closest == nil || result.Remaining < closest.Remaining {
+				closest = &result
+			}
+
+			if !result.Allowed {
+				slog.Warn("Rate limit exceeded", "rule", r.name, "key", key, "path", e.Request().URL.Path)
+				setHeaders(e, result)
+				e.Response().Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				return apperrors.TooManyRequests("Too many requests, try again later")
+			}
+		}
+
+		if closest != nil {
+			setHeaders(e, *closest)
+		}
+
+		return next(e)
+	}
+}
+
+func setHeaders(e echo.Context, result Result) {
+	header := e.Response().Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+}
+
+func ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
+
+// Periodically forgets the buckets that are full again until the context is done
+func (l *Limiter) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := l.backend.Purge(ctx, now); err != nil {
+				slog.Error("Error purging rate limit buckets", "error", err)
+			}
+		}
+	}
+}
+
+// The IP of the client, see rate_limits.trust_forwarded_for for how it's extracted
+func ByIP(e echo.Context) (string, bool) {
+	return e.RealIP(), true
+}
+
+// The logged user, anonymous requests are only limited by the other rules
+func ByUser(e echo.Context) (string, bool) {
+	principal, ok := auth.PrincipalFrom(e)
+	return principal.UserId, ok
+}
+
+// The user id of the path, ids that can't exist don't get a bucket
+func ByParam(param string) KeyFunc {
+	return func(e echo.Context) (string, bool) {
+		id, err := uuid.Parse(e.Param(param))
+		if err != nil {
+			return "", false
+		}
+		return id.String(), true
+	}
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+// Backend that only counts the requests of this process
+type MemoryBackend struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{buckets: map[string]*bucket{}}
+}
+
+func (b *MemoryBackend) Take(ctx context.Context, key string, limit config.RateLimit, now time.Time) (Result, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current, ok := b.buckets[key]
+	if !ok {
+		created := newBucket(limit, now)
+		current = &created
+		b.buckets[key] = current
+	}
+
+	return current.take(limit, now), nil
+}
+
+func (b *MemoryBackend) Purge(ctx context.Context, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for key, current := range b.buckets {
+		if !current.full.After(now) {
+			delete(b.buckets, key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+// Backend shared by every instance, the bucket of a key is locked while a token is taken
+type PostgresBackend struct {
+	db *sql.DB
+}
+
+func NewPostgresBackend(db *sql.DB) *PostgresBackend {
+	return &PostgresBackend{db: db}
+}
+
+func (b *PostgresBackend) Take(ctx context.Context, key string, limit config.RateLimit, now time.Time) (Result, error) {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	// The first request of a key creates a full bucket, concurrent ones wait for its lock below
+	created := newBucket(limit, now)
+	stmt := `INSERT INTO RateLimitBuckets(key, tokens, update_date, full_date) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO NOTHING`
+	if _, err := tx.ExecContext(ctx, stmt, key, created.tokens, created.updated, created.full); err != nil {
+		return Result{}, err
+	}
+
+	current := bucket{}
+	row := tx.QueryRowContext(ctx, "SELECT tokens, update_date FROM RateLimitBuckets WHERE key = $1 FOR UPDATE", key)
+	if err := row.Scan(&current.tokens, &current.updated); err != nil {
+		return Result{}, err
+	}
+
+	result := current.take(limit, now)
+
+	stmt = "UPDATE RateLimitBuckets SET tokens = $2, update_date = $3, full_date = $4 WHERE key = $1"
+	if _, err := tx.ExecContext(ctx, stmt, key, current.tokens, current.updated, current.full); err != nil {
+		return Result{}, err
+	}
+
+	return result, tx.Commit()
+}
+
+func (b *PostgresBackend) Purge(ctx context.Context, now time.Time) error {
+	_, err := b.db.ExecContext(ctx, "DELETE FROM RateLimitBuckets WHERE full_date <= $1", now)
+	return err
+}
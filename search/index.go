@@ -0,0 +1,207 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// A searchable text of a document, matches in fields with more weight rank higher
+type Field struct {
+	Text   string
+	Weight float64
+}
+
+type Document struct {
+	Id     string
+	Fields []Field
+}
+
+type Match struct {
+	Id   string
+	Rank float64
+}
+
+/**
+ * Index is an inverted index from stemmed terms to the documents that contain them.
+ * It approximates the Spanish and English text search of Postgres: accents and case
+ * are ignored, common words are skipped and plurals and usual endings are stemmed.
+ *
+ * It isn't safe for concurrent use, callers must hold their own lock.
+ */
+type Index struct {
+	// term -> document id -> weighted frequency of the term in the document
+	postings map[string]map[string]float64
+	// document id -> terms, to remove a document from its postings
+	terms map[string][]string
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[string]float64{},
+		terms:    map[string][]string{},
+	}
+}
+
+// Adds the document, replacing the previous version with the same id
+func (i *Index) Put(doc Document) {
+	i.Remove(doc.Id)
+
+	weights := map[string]float64{}
+	for _, field := range doc.Fields {
+		for _, term := range Terms(field.Text) {
+			weights[term] += field.Weight
+		}
+	}
+
+	for term, weight := range weights {
+		if i.postings[term] == nil {
+			i.postings[term] = map[string]float64{}
+		}
+		i.postings[term][doc.Id] = weight
+		i.terms[doc.Id] = append(i.terms[doc.Id], term)
+	}
+}
+
+func (i *Index) Remove(id string) {
+	for _, term := range i.terms[id] {
+		delete(i.postings[term], id)
+		if len(i.postings[term]) == 0 {
+			delete(i.postings, term)
+		}
+	}
+	delete(i.terms, id)
+}
+
+/**
+ * Returns the documents that contain every term of the query and none of the
+ * terms prefixed with a minus, in no particular order.
+ */
+func (i *Index) Search(query string) []Match {
+	required, excluded := ParseQuery(query)
+	if len(required) == 0 {
+		return nil
+	}
+
+	ranks := map[string]float64{}
+	for id, weight := range i.postings[required[0]] {
+		ranks[id] = weight
+	}
+
+	for _, term := range required[1:] {
+		for id := range ranks {
+			weight, ok := i.postings[term][id]
+			if !ok {
+				delete(ranks, id)
+				continue
+			}
+			ranks[id] += weight
+		}
+	}
+
+	for _, term := range excluded {
+		for id := range i.postings[term] {
+			delete(ranks, id)
+		}
+	}
+
+	matches := make([]Match, 0, len(ranks))
+	for id, rank := range ranks {
+		matches = append(matches, Match{Id: id, Rank: rank})
+	}
+
+	return matches
+}
+
+// Splits the query in the terms that must and must not be in the documents
+func ParseQuery(query string) (required []string, excluded []string) {
+	for _, word := range strings.Fields(query) {
+		if strings.HasPrefix(word, "-") {
+			excluded = append(excluded, Terms(word[1:])...)
+			continue
+		}
+		required = append(required, Terms(word)...)
+	}
+
+	return required, excluded
+}
+
+// Normalized and stemmed words of the text, without stop words
+func Terms(text string) []string {
+	terms := []string{}
+
+	for _, word := range words(text) {
+		if term, ok := normalize(word); ok {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+var removeAccents = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+func normalize(word string) (string, bool) {
+	word = strings.ToLower(word)
+	if stripped, _, err := transform.String(removeAccents, word); err == nil {
+		word = stripped
+	}
+
+	if stopWords[word] {
+		return "", false
+	}
+
+	return stem(word), true
+}
+
+// Longest first, a suffix is only removed when at least three letters remain
+var pluralSuffixes = []string{"ies", "es", "s"}
+
+var suffixes = []string{
+	"amiento", "imiento", "mente", "acion", "iendo", "ando",
+	"ness", "ing", "ed", "a", "o", "e",
+}
+
+func stem(word string) string {
+	// Plurals first, so the singular and the plural share the stem: preguntas -> pregunta -> pregunt
+	if !strings.HasSuffix(word, "ss") {
+		word = trimSuffix(word, pluralSuffixes)
+	}
+
+	return trimSuffix(word, suffixes)
+}
+
+func trimSuffix(word string, suffixes []string) string {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 3 {
+			word = strings.TrimSuffix(word, suffix)
+			// running -> runn -> run
+			if (suffix == "ing" || suffix == "ed") && len(word) >= 4 && word[len(word)-1] == word[len(word)-2] {
+				word = word[:len(word)-1]
+			}
+			return word
+		}
+	}
+
+	return word
+}
+
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`
+		a al algo como con de del el ella ellos en entre era es esa ese eso esta este esto fue ha hay la las le les lo los mas me mi mis muy nada ni no nos o para pero por porque que se si sin sobre su sus tambien te tu un una uno unos unas y ya yo
+		an and are as at be but by for from has have he her his i if in into is it its me my not of on or our she so than that the their them then there they this to was we were what when which who will with you your
+	`) {
+		stopWords[word] = true
+	}
+}
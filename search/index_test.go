@@ -0,0 +1,143 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTermsIgnoreAccentsCaseAndEndings(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"pregunta", []string{"pregunt"}},
+		{"Preguntas", []string{"pregunt"}},
+		{"canción canciones", []string{"cancion", "cancion"}},
+		{"organizaciones organización", []string{"organiz", "organiz"}},
+		{"flores flor", []string{"flor", "flor"}},
+		{"meses mes", []string{"mes", "mes"}},
+		{"caminando camino", []string{"camin", "camin"}},
+		{"running runs", []string{"run", "run"}},
+		{"answered answers", []string{"answer", "answer"}},
+		{"kindness process", []string{"kind", "process"}},
+		{"ÑANDÚ", []string{"nandu"}},
+		{"¡hola,mundo!", []string{"hol", "mund"}},
+		{"el de la the of", []string{}},
+		{"", []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			if got := Terms(test.text); !slices.Equal(got, test.want) {
+				t.Errorf("Terms(%q) = %v, want %v", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseQuerySplitsExcludedTerms(t *testing.T) {
+	required, excluded := ParseQuery("Preguntas -spam de  -Canciones")
+
+	if !slices.Equal(required, []string{"pregunt"}) || !slices.Equal(excluded, []string{"spam", "cancion"}) {
+		t.Errorf("required = %v, excluded = %v", required, excluded)
+	}
+}
+
+func newTestIndex() *Index {
+	index := NewIndex()
+	index.Put(Document{Id: "title", Fields: []Field{{Text: "Canciones de rock", Weight: 2}, {Text: "Una lista", Weight: 1}}})
+	index.Put(Document{Id: "content", Fields: []Field{{Text: "Mi lista", Weight: 2}, {Text: "La mejor canción de rock y de jazz", Weight: 1}}})
+	index.Put(Document{Id: "other", Fields: []Field{{Text: "Preguntas frecuentes", Weight: 2}, {Text: "Nada de música", Weight: 1}}})
+	return index
+}
+
+// Ids of the matches, ranked from the best
+func matchIds(matches []Match) []string {
+	slices.SortFunc(matches, func(a, b Match) int {
+		if a.Rank != b.Rank {
+			if a.Rank > b.Rank {
+				return -1
+			}
+			return 1
+		}
+		if a.Id < b.Id {
+			return -1
+		}
+		return 1
+	})
+
+	ids := []string{}
+	for _, match := range matches {
+		ids = append(ids, match.Id)
+	}
+	return ids
+}
+
+func TestIndexSearch(t *testing.T) {
+	index := newTestIndex()
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"single term, title ranks higher", "canción", []string{"title", "content"}},
+		{"every term is required", "rock jazz", []string{"content"}},
+		{"terms in different fields, same rank", "canciones lista", []string{"content", "title"}},
+		{"excluded term", "rock -jazz", []string{"title"}},
+		{"only excluded terms", "-rock", []string{}},
+		{"only stop words", "de la", []string{}},
+		{"unknown term", "rock blues", []string{}},
+		{"plural matches the singular", "pregunta", []string{"other"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchIds(index.Search(test.query)); !slices.Equal(got, test.want) {
+				t.Errorf("Search(%q) = %v, want %v", test.query, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIndexRanksByWeightedFrequency(t *testing.T) {
+	index := newTestIndex()
+
+	for _, match := range index.Search("rock lista") {
+		// title: rock in the title and lista in the content, content: the other way around
+		if want := 3.0; match.Rank != want {
+			t.Errorf("rank of %s = %v, want %v", match.Id, match.Rank, want)
+		}
+	}
+
+	index.Put(Document{Id: "repeated", Fields: []Field{{Text: "rock, rock y más rock", Weight: 1}}})
+	for _, match := range index.Search("rock") {
+		if match.Id == "repeated" && match.Rank != 3 {
+			t.Errorf("rank of repeated = %v, want 3", match.Rank)
+		}
+	}
+}
+
+func TestIndexPutReplacesAndRemoveDeletes(t *testing.T) {
+	index := newTestIndex()
+
+	index.Put(Document{Id: "title", Fields: []Field{{Text: "Discos de jazz", Weight: 2}}})
+	if got := matchIds(index.Search("rock")); !slices.Equal(got, []string{"content"}) {
+		t.Errorf("after replacing: rock = %v, want the old terms gone", got)
+	}
+	if got := matchIds(index.Search("jazz")); !slices.Equal(got, []string{"title", "content"}) {
+		t.Errorf("after replacing: jazz = %v, want the new terms indexed", got)
+	}
+
+	index.Remove("content")
+	index.Remove("missing")
+	if got := matchIds(index.Search("jazz")); !slices.Equal(got, []string{"title"}) {
+		t.Errorf("after removing: jazz = %v", got)
+	}
+
+	// Terms without documents are dropped from the postings
+	index.Remove("title")
+	if _, ok := index.postings["jazz"]; ok {
+		t.Error("the postings of jazz are still there without documents")
+	}
+}
@@ -0,0 +1,47 @@
+package search
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const snippetWords = 30
+
+/**
+ * Returns a fragment of the text around the first match of the query, with the
+ * matching words wrapped in start and stop. Like ts_headline it returns the
+ * beginning of the text when nothing matches.
+ */
+func Snippet(text string, query string, start string, stop string) string {
+	required, _ := ParseQuery(query)
+
+	tokens := strings.FieldsFunc(text, unicode.IsSpace)
+	matches := make([]bool, len(tokens))
+	first := -1
+
+	for i, token := range tokens {
+		for _, word := range words(token) {
+			if term, ok := normalize(word); ok && slices.Contains(required, term) {
+				matches[i] = true
+			}
+		}
+		if matches[i] && first == -1 {
+			first = i
+		}
+	}
+
+	from := max(0, first-snippetWords/3)
+	to := min(len(tokens), from+snippetWords)
+
+	fragment := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		if matches[i] {
+			fragment = append(fragment, start+tokens[i]+stop)
+		} else {
+			fragment = append(fragment, tokens[i])
+		}
+	}
+
+	return strings.Join(fragment, " ")
+}
@@ -0,0 +1,62 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippetMarksTheMatchingWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  string
+	}{
+		{"single word", "Me gusta el rock nacional", "rock", "Me gusta el [rock] nacional"},
+		{"accents, case and plurals", "Las CANCIONES de la canción", "cancion", "Las [CANCIONES] de la [canción]"},
+		{"punctuation stays inside the mark", "¿Qué es el rock? ¡Rock!", "rock", "¿Qué es el [rock?] [¡Rock!]"},
+		{"every required word", "rock y jazz de los setenta", "jazz rock", "[rock] y [jazz] de los setenta"},
+		{"excluded words aren't marked", "rock y jazz", "rock -jazz", "[rock] y jazz"},
+		{"stop words aren't marked", "el rock de la ciudad", "el rock", "el [rock] de la ciudad"},
+		{"no match", "Me gusta el rock", "jazz", "Me gusta el rock"},
+		{"empty text", "", "rock", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Snippet(test.text, test.query, "[", "]"); got != test.want {
+				t.Errorf("Snippet = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSnippetIsAWindowAroundTheFirstMatch(t *testing.T) {
+	words := make([]string, 100)
+	for i := range words {
+		words[i] = "palabra"
+	}
+	words[50] = "rock"
+	words[90] = "rock"
+	text := strings.Join(words, " ")
+
+	got := strings.Fields(Snippet(text, "rock", "[", "]"))
+	if len(got) != snippetWords {
+		t.Fatalf("snippet has %d words, want %d", len(got), snippetWords)
+	}
+	// Starts a third of the window before the match
+	if got[snippetWords/3] != "[rock]" {
+		t.Errorf("snippet = %v, want the match at %d", got, snippetWords/3)
+	}
+
+	// Without matches it's the beginning of the text
+	if got := strings.Fields(Snippet(text, "jazz", "[", "]")); len(got) != snippetWords || strings.Contains(strings.Join(got, " "), "rock") {
+		t.Errorf("snippet without matches = %v", got)
+	}
+
+	// Close to the start the window isn't moved before the text
+	words[2] = "jazz"
+	if got := strings.Fields(Snippet(strings.Join(words, " "), "jazz", "[", "]")); got[2] != "[jazz]" {
+		t.Errorf("snippet = %v, want the match at 2", got)
+	}
+}
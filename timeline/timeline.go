@@ -0,0 +1,176 @@
+package timeline
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/config"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+/**
+ * Timeline builds the home timeline of the users from the posts and answers of the users they follow.
+ *
+ * The content of most users is copied to the timelines of their followers when it's published
+ * (fan out on write), so reading a timeline is a single indexed query. Users with more followers
+ * than the threshold would make publishing too expensive, so their content is read and merged
+ * when the timeline is requested instead (fan out on read).
+ *
+ * The content of the users muted by the owner of the timeline is left out in both cases.
+ */
+type Timeline struct {
+	follows   models.FollowStore
+	entries   models.TimelineStore
+	relations models.RelationStore
+
+	fanOutThreshold int
+	backfillSize    int
+}
+
+func NewTimeline(cfg config.TimelineConfig, follows models.FollowStore, entries models.TimelineStore, relations models.RelationStore) *Timeline {
+	return &Timeline{
+		follows:   follows,
+		entries:   entries,
+		relations: relations,
+
+		fanOutThreshold: cfg.FanOutThreshold,
+		backfillSize:    cfg.BackfillSize,
+	}
+}
+
+// Adds a new post or answer to the timelines of the followers of its author when it's cheap enough
+func (t *Timeline) Publish(ctx context.Context, entry models.TimelineEntry) error {
+	counts, err := t.follows.CountFollows(ctx, entry.AuthorId)
+	if err != nil {
+		return err
+	}
+
+	if counts.Followers > t.fanOutThreshold {
+		return nil
+	}
+
+	return t.entries.FanOutTimelineEntry(ctx, entry)
+}
+
+// Returns false when the user was already followed
+func (t *Timeline) Follow(ctx context.Context, followerId models.UserID, followeeId models.UserID) (bool, error) {
+	if followerId == followeeId {
+		return false, apperrors.BadRequest("Can't follow yourself")
+	}
+
+	followed, err := t.follows.Follow(ctx, followerId, followeeId, time.Now())
+	if err != nil || !followed {
+		return followed, err
+	}
+
+	// The recent content of the new followee is copied so the timeline doesn't start empty
+	muted, err := t.relations.HasRelation(ctx, followerId, followeeId, models.RelationMute)
+	if err != nil || muted {
+		return true, err
+	}
+
+	return true, t.backfill(ctx, followerId, followeeId)
+}
+
+// Returns false when the user wasn't followed
+func (t *Timeline) Unfollow(ctx context.Context, followerId models.UserID, followeeId models.UserID) (bool, error) {
+	unfollowed, err := t.follows.Unfollow(ctx, followerId, followeeId)
+	if err != nil || !unfollowed {
+		return unfollowed, err
+	}
+
+	return true, t.entries.DeleteTimelineEntriesByAuthor(ctx, followerId, followeeId)
+}
+
+// Removes the content of the muted user from the timeline, call it after storing the mute
+func (t *Timeline) Mute(ctx context.Context, userId models.UserID, mutedId models.UserID) error {
+	return t.entries.DeleteTimelineEntriesByAuthor(ctx, userId, mutedId)
+}
+
+// Brings back the recent content of the unmuted user when it's followed, call it after removing the mute
+func (t *Timeline) Unmute(ctx context.Context, userId models.UserID, unmutedId models.UserID) error {
+	following, err := t.follows.IsFollowing(ctx, userId, unmutedId)
+	if err != nil || !following {
+		return err
+	}
+
+	return t.backfill(ctx, userId, unmutedId)
+}
+
+// Returns a page of the home timeline, merging the materialized timeline with the content of the popular followees
+func (t *Timeline) Home(ctx context.Context, userId models.UserID, page models.Page) ([]models.TimelineItem, error) {
+	items, err := t.entries.FindTimelineItems(ctx, userId, page)
+	if err != nil {
+		return nil, err
+	}
+
+	popular, err := t.follows.FindPopularFollowees(ctx, userId, t.fanOutThreshold)
+	if err != nil || len(popular) == 0 {
+		return items, err
+	}
+
+	muted, err := t.relations.FindRelatedIds(ctx, models.RelationMute, userId)
+	if err != nil {
+		return nil, err
+	}
+	popular = slices.DeleteFunc(popular, func(authorId models.UserID) bool {
+		return slices.Contains(muted, authorId)
+	})
+	if len(popular) == 0 {
+		return items, nil
+	}
+
+	pulled, err := t.entries.FindTimelineItemsByAuthors(ctx, popular, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return merge(items, pulled, page.Limit), nil
+}
+
+// Copies the recent content of the author to the timeline of the user, popular authors are read on demand instead
+func (t *Timeline) backfill(ctx context.Context, userId models.UserID, authorId models.UserID) error {
+	counts, err := t.follows.CountFollows(ctx, authorId)
+	if err != nil || counts.Followers > t.fanOutThreshold || t.backfillSize == 0 {
+		return err
+	}
+
+	recent, err := t.entries.FindTimelineItemsByAuthors(ctx, []models.UserID{authorId}, models.Page{Limit: t.backfillSize})
+	if err != nil {
+		return err
+	}
+
+	entries := make([]models.TimelineEntry, len(recent))
+	for i, item := range recent {
+		entries[i] = item.TimelineEntry
+	}
+
+	return t.entries.InsertTimelineEntries(ctx, userId, entries)
+}
+
+/**
+ * Merges two pages of the same position. The materialized timeline can still have
+ * entries of users that became popular after they were copied, those are kept once.
+ */
+func merge(a []models.TimelineItem, b []models.TimelineItem, limit int) []models.TimelineItem {
+	merged := make([]models.TimelineItem, 0, limit)
+	seen := map[string]bool{}
+
+	for len(merged) < limit && (len(a) > 0 || len(b) > 0) {
+		var next models.TimelineItem
+		if len(b) == 0 || (len(a) > 0 && a[0].Cursor().Compare(b[0].Cursor()) <= 0) {
+			next, a = a[0], a[1:]
+		} else {
+			next, b = b[0], b[1:]
+		}
+
+		if !seen[next.ItemId] {
+			seen[next.ItemId] = true
+			merged = append(merged, next)
+		}
+	}
+
+	return merged
+}
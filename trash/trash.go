@@ -0,0 +1,73 @@
+package trash
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/preguntame/preguntame-backend/config"
+	"github.com/preguntame/preguntame-backend/models"
+)
+
+/**
+ * Trash keeps deleted questions and posts restorable for the retention period of
+ * config.TrashConfig and purges them for good after it.
+ */
+type Trash struct {
+	cfg   config.TrashConfig
+	store models.TrashStore
+}
+
+func New(cfg config.TrashConfig, store models.TrashStore) *Trash {
+	return &Trash{cfg: cfg, store: store}
+}
+
+func (t *Trash) Retention() time.Duration {
+	return t.cfg.Retention
+}
+
+// Content deleted before the returned date can't be restored anymore
+func (t *Trash) RestorableSince(now time.Time) time.Time {
+	return now.Add(-t.cfg.Retention)
+}
+
+/**
+ * Removes everything deleted before the retention period, in batches so a large backlog
+ * doesn't hold locks for long. Returns how many questions and posts were removed.
+ */
+func (t *Trash) Purge(ctx context.Context, now time.Time) (int, error) {
+	before := t.RestorableSince(now)
+	total := 0
+
+	for {
+		purged, err := t.store.PurgeDeleted(ctx, before, t.cfg.PurgeBatchSize)
+		total += purged
+		if err != nil {
+			return total, err
+		}
+		if purged < t.cfg.PurgeBatchSize || ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+	}
+}
+
+// Periodically purges the trash until the context is done, every instance can run it
+func (t *Trash) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := t.Purge(ctx, now)
+			if err != nil {
+				slog.Error("Error purging the trash", "error", err)
+			}
+			if purged > 0 {
+				slog.Info("Purged the trash", "purged", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+/**
+ * Validator checks the `validate` tags of the DTOs and reports every violation at once.
+ * Lengths are counted in runes, so accents and emoji count as a single character.
+ *
+ * Supported rules, separated by commas:
+ *   required        the field can't be empty
+ *   min=N, max=N    length bounds
+ *   length=NAME     bounds taken from the configured limits (question, reply, email, password, post_title, post_content)
+ *   email           an RFC 5322 address without display name
+ *   password        at least one uppercase letter, one lowercase letter and one digit
+ *   uuid            a valid uuid
+ *   oneof=A B C     one of the listed values
+ */
+type Validator struct {
+	lengths map[string]Length
+	rules   sync.Map
+}
+
+type Length struct {
+	Min int
+	// Zero means no maximum
+	Max int
+	// Zero means no maximum, checked on top of Max for values with a limit in bytes
+	MaxBytes int
+}
+
+// bcrypt only hashes the first 72 bytes of a password and x/crypto rejects longer ones
+const bcryptMaxPasswordBytes = 72
+
+type fieldRules struct {
+	index []int
+	name  string
+	rules []rule
+}
+
+type rule struct {
+	name string
+	arg  string
+}
+
+func New(limits config.LimitsConfig, passwords config.PasswordsConfig) *Validator {
+	password := Length{Min: limits.PasswordMinLength, Max: 256}
+	if passwords.Algorithm == config.PasswordBcrypt {
+		password.MaxBytes = bcryptMaxPasswordBytes
+	}
+
+	return &Validator{
+		lengths: map[string]Length{
+			"question":     {Min: limits.QuestionMinLength, Max: limits.QuestionMaxLength},
+			"reply":        {Min: limits.ReplyMinLength, Max: limits.ReplyMaxLength},
+			"email":        {Min: 3, Max: limits.EmailMaxLength},
+			"password":     password,
+			"post_title":   {Min: 1, Max: limits.PostTitleMaxLength},
+			"post_content": {Min: 1, Max: limits.PostContentMaxLength},
+		},
+	}
+}
+
+// Implements echo.Validator, the error is an apperrors validation error with one detail per violation
+func (v *Validator) Validate(i interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(i))
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("can't validate %T, only structs are supported", i)
+	}
+
+	fields, err := v.rulesFor(value.Type())
+	if err != nil {
+		return err
+	}
+
+	details := []apperrors.FieldError{}
+	for _, field := range fields {
+		fieldValue := value.FieldByIndex(field.index)
+		for _, r := range field.rules {
+			if detail, ok := v.check(field.name, fieldValue, r); !ok {
+				details = append(details, detail)
+				// Once a field failed the following rules only add noise
+				break
+			}
+		}
+	}
+
+	if len(details) > 0 {
+		return apperrors.Validation("The request has invalid fields", details...)
+	}
+
+	return nil
+}
+
+func (v *Validator) check(field string, value reflect.Value, r rule) (apperrors.FieldError, bool) {
+	fail := func(code string, format string, args ...any) (apperrors.FieldError, bool) {
+		return apperrors.FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}, false
+	}
+
+	if r.name == "required" {
+		if value.IsZero() {
+			return fail("required", "%s is required", field)
+		}
+		return apperrors.FieldError{}, true
+	}
+
+	// The remaining rules only apply to present strings, required handles empty ones
+	if value.Kind() != reflect.String || value.String() == "" {
+		return apperrors.FieldError{}, true
+	}
+	s := value.String()
+
+	switch r.name {
+	case "min", "max", "length":
+		bounds := v.lengths[r.arg]
+		if r.name == "min" {
+			bounds = Length{Min: mustAtoi(r.arg)}
+		}
+		if r.name == "max" {
+			bounds = Length{Max: mustAtoi(r.arg)}
+		}
+
+		length := utf8.RuneCountInString(s)
+		if length < bounds.Min {
+			return fail("too_short", "%s must be at least %d characters long", field, bounds.Min)
+		}
+		if bounds.Max > 0 && length > bounds.Max {
+			return fail("too_long", "%s must be at most %d characters long", field, bounds.Max)
+		}
+		if bounds.MaxBytes > 0 && len(s) > bounds.MaxBytes {
+			return fail("too_long", "%s must be at most %d bytes long", field, bounds.MaxBytes)
+		}
+
+	case "email":
+		if !isEmail(s) {
+			return fail("invalid_email", "%s must be a valid email address", field)
+		}
+
+	case "password":
+		if !isStrongPassword(s) {
+			return fail("weak_password", "%s must contain at least one uppercase letter, one lowercase letter and one number", field)
+		}
+
+	case "uuid":
+		if _, err := uuid.Parse(s); err != nil {
+			return fail("invalid_uuid", "%s must be a valid id", field)
+		}
+
+	case "oneof":
+		for _, option := range strings.Fields(r.arg) {
+			if s == option {
+				return apperrors.FieldError{}, true
+			}
+		}
+		return fail("invalid_value", "%s must be one of: %s", field, strings.Join(strings.Fields(r.arg), ", "))
+	}
+
+	return apperrors.FieldError{}, true
+}
+
+// Parses the tags of the type once and caches them
+func (v *Validator) rulesFor(t reflect.Type) ([]fieldRules, error) {
+	if cached, ok := v.rules.Load(t); ok {
+		return cached.([]fieldRules), nil
+	}
+
+	fields := []fieldRules{}
+	for _, field := range reflect.VisibleFields(t) {
+		tag, ok := field.Tag.Lookup("validate")
+		if !ok || !field.IsExported() {
+			continue
+		}
+
+		parsed := fieldRules{index: field.Index, name: fieldName(field)}
+		for _, part := range strings.Split(tag, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+			switch name {
+			case "min", "max":
+				if _, err := strconv.Atoi(arg); err != nil {
+					return nil, fmt.Errorf("%s.%s: invalid %s rule %q", t.Name(), field.Name, name, arg)
+				}
+			case "length":
+				if _, ok := v.lengths[arg]; !ok {
+					return nil, fmt.Errorf("%s.%s: unknown length %q", t.Name(), field.Name, arg)
+				}
+			case "required", "email", "password", "uuid", "oneof":
+			default:
+				return nil, fmt.Errorf("%s.%s: unknown rule %q", t.Name(), field.Name, name)
+			}
+
+			parsed.rules = append(parsed.rules, rule{name: name, arg: arg})
+		}
+
+		fields = append(fields, parsed)
+	}
+
+	v.rules.Store(t, fields)
+	return fields, nil
+}
+
+// The name the client used for the field, taken from the binding tags
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "param", "query", "form", "header"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+func isEmail(s string) bool {
+	address, err := mail.ParseAddress(s)
+	// Display names like "Juan <juan@mail.com>" are valid RFC 5322 but not an email for us
+	if err != nil || address.Address != s {
+		return false
+	}
+
+	_, domain, _ := strings.Cut(address.Address, "@")
+	return strings.Contains(domain, ".")
+}
+
+func isStrongPassword(s string) bool {
+	upper, lower, digit := false, false, false
+
+	for _, r := range s {
+		upper = upper || unicode.IsUpper(r)
+		lower = lower || unicode.IsLower(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+
+	return upper && lower && digit
+}
+
+// Only called with arguments already checked by rulesFor
+func mustAtoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,194 @@
+package validation
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/preguntame/preguntame-backend/apperrors"
+	"github.com/preguntame/preguntame-backend/config"
+)
+
+func newTestValidator(algorithm string) *Validator {
+	passwords := config.Default().Passwords
+	passwords.Algorithm = algorithm
+	return New(config.Default().Limits, passwords)
+}
+
+// Field and code of every detail of the validation error, nil when err is nil
+func violations(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	var appErr *apperrors.Error
+	if !errors.As(err, &appErr) || appErr.Code != apperrors.CodeValidation {
+		t.Fatalf("err = %v, want a validation error", err)
+	}
+
+	found := []string{}
+	for _, detail := range appErr.Details {
+		found = append(found, detail.Field+":"+detail.Code)
+	}
+	return found
+}
+
+type lengthsDTO struct {
+	Question string `json:"question" validate:"length=question"`
+	Name     string `json:"name" validate:"min=2,max=5"`
+	Password string `json:"password" validate:"length=password"`
+}
+
+func TestLengthsAreCountedInRunes(t *testing.T) {
+	valid := lengthsDTO{Question: "0123456789", Name: "ana", Password: "Abcdefg1"}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		change    func(dto *lengthsDTO)
+		want      []string
+	}{
+		{"ascii", config.PasswordArgon2id, func(dto *lengthsDTO) {}, nil},
+		{"accents count once", config.PasswordArgon2id, func(dto *lengthsDTO) { dto.Name = "ñáéíó" }, nil},
+		{"emoji count once", config.PasswordArgon2id, func(dto *lengthsDTO) { dto.Name = "🙂🙂🙂🙂🙂" }, nil},
+		{"one rune past max", config.PasswordArgon2id, func(dto *lengthsDTO) { dto.Name = "ñáéíóú" }, []string{"name:too_long"}},
+		{"one rune under min", config.PasswordArgon2id, func(dto *lengthsDTO) { dto.Name = "ñ" }, []string{"name:too_short"}},
+		// 18 bytes but 9 characters
+		{"configured min", config.PasswordArgon2id, func(dto *lengthsDTO) { dto.Question = "ñññññññññ" }, []string{"question:too_short"}},
+		{"configured max", config.PasswordArgon2id, func(dto *lengthsDTO) { dto.Question = strings.Repeat("¿", 1001) }, []string{"question:too_long"}},
+		{"empty values are left to required", config.PasswordArgon2id, func(dto *lengthsDTO) { dto.Name = "" }, nil},
+		// 40 characters but 151 bytes, over the 72 bytes bcrypt hashes
+		{"bcrypt password over 72 bytes", config.PasswordBcrypt, func(dto *lengthsDTO) { dto.Password = "Ab1" + strings.Repeat("🙂", 37) }, []string{"password:too_long"}},
+		{"bcrypt password of 72 bytes", config.PasswordBcrypt, func(dto *lengthsDTO) { dto.Password = "Abcd" + strings.Repeat("🙂", 17) }, nil},
+		{"argon2id password over 72 bytes", config.PasswordArgon2id, func(dto *lengthsDTO) { dto.Password = "Ab1" + strings.Repeat("🙂", 37) }, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dto := valid
+			test.change(&dto)
+
+			if got := violations(t, newTestValidator(test.algorithm).Validate(&dto)); !slices.Equal(got, test.want) {
+				t.Errorf("violations = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+type emailDTO struct {
+	Email string `json:"email" validate:"email"`
+}
+
+func TestEmails(t *testing.T) {
+	tests := []struct {
+		email string
+		valid bool
+	}{
+		{"ana@example.com", true},
+		{"ANA@EXAMPLE.COM", true},
+		{"ana.b+tag@sub.example.com", true},
+		{"ñandú@ejemplo.com", true},
+		{"ana@ejémplo.com", true},
+		{"ana@[127.0.0.1]", true},
+		// Valid RFC 5322 but not a bare address
+		{"Ana <ana@example.com>", false},
+		{"<ana@example.com>", false},
+		{"ana(comment)@example.com", false},
+		{`"ana b"@example.com`, false},
+		{"ana@example.com, bob@example.com", false},
+		{"ana@example.com ", false},
+		// Without a dot the domain can only be local
+		{"ana@localhost", false},
+		{"ana@example.", false},
+		{"ana@.com", false},
+		{"ana@example..com", false},
+		{"ana..b@example.com", false},
+		{".ana@example.com", false},
+		{"ana @example.com", false},
+		{"ana@@example.com", false},
+		{"@example.com", false},
+		{"ana@", false},
+		{"ana", false},
+	}
+
+	validator := newTestValidator(config.PasswordArgon2id)
+	for _, test := range tests {
+		t.Run(test.email, func(t *testing.T) {
+			got := violations(t, validator.Validate(&emailDTO{Email: test.email}))
+			if test.valid && got != nil {
+				t.Errorf("violations = %v, want the email accepted", got)
+			}
+			if !test.valid && !slices.Equal(got, []string{"email:invalid_email"}) {
+				t.Errorf("violations = %v, want email:invalid_email", got)
+			}
+		})
+	}
+}
+
+type registerDTO struct {
+	Name     string `json:"name" validate:"required,min=3"`
+	Email    string `json:"email" validate:"required,length=email,email"`
+	Password string `json:"password" validate:"required,length=password,password"`
+	UserId   string `param:"userId" validate:"uuid"`
+	Type     string `query:"type" validate:"oneof=all questions posts"`
+	Internal string
+}
+
+func TestEveryInvalidFieldIsReported(t *testing.T) {
+	tests := []struct {
+		name string
+		dto  registerDTO
+		want []string
+	}{
+		{"valid", registerDTO{Name: "ana", Email: "ana@example.com", Password: "Abcdefg1", UserId: "0d8a3c3e-4b7f-4a57-9f1e-3a8f6f0e5b21", Type: "posts"}, nil},
+		{"optional fields left empty", registerDTO{Name: "ana", Email: "ana@example.com", Password: "Abcdefg1"}, nil},
+		{
+			"every field, in the order of the struct",
+			registerDTO{Name: "an", Email: "ana", Password: "abcdefg1", UserId: "1", Type: "users", Internal: "anything"},
+			[]string{"name:too_short", "email:invalid_email", "password:weak_password", "userId:invalid_uuid", "type:invalid_value"},
+		},
+		{"missing fields", registerDTO{}, []string{"name:required", "email:required", "password:required"}},
+		// The password is short and weak, only the first failed rule is reported
+		{"one detail per field", registerDTO{Name: "ana", Email: "ana@example.com", Password: "abc"}, []string{"password:too_short"}},
+	}
+
+	validator := newTestValidator(config.PasswordArgon2id)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := violations(t, validator.Validate(test.dto)); !slices.Equal(got, test.want) {
+				t.Errorf("violations = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInvalidRulesAreErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"unknown rule", &struct {
+			Name string `validate:"required,shiny"`
+		}{}},
+		{"min that isn't a number", &struct {
+			Name string `validate:"min=three"`
+		}{}},
+		{"unknown length", &struct {
+			Name string `validate:"length=title"`
+		}{}},
+		{"not a struct", "ana"},
+	}
+
+	validator := newTestValidator(config.PasswordArgon2id)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validator.Validate(test.value)
+			var appErr *apperrors.Error
+			if err == nil || errors.As(err, &appErr) {
+				t.Errorf("err = %v, want an error of the DTO", err)
+			}
+		})
+	}
+}